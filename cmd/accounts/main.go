@@ -1,4 +1,4 @@
-package accounts
+package main
 
 import (
 	"context"
@@ -17,6 +17,30 @@ func main() {
 	// 1) Load & validate config
 	cfg.Init()
 
+	// `accounts migrate up|down|status` manages the schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), cfg.Cfg.Accounts.DSN, os.Args[2:]); err != nil {
+			log.Fatalf("migrate: %v", err)
+		}
+		return
+	}
+
+	// `accounts reconcile` checks the balance projections against the ledger
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		if err := runReconcile(context.Background(), os.Args[2:]); err != nil {
+			log.Fatalf("reconcile: %v", err)
+		}
+		return
+	}
+
+	// `accounts replay` rebuilds projections from the recorded events
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		if err := runReplay(context.Background(), os.Args[2:]); err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		return
+	}
+
 	// 2) Bootstrap the Accounts HTTP server
 	e, dbConn, err := accounts.NewServer()
 	if err != nil {
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"cex/internal/accounts/db"
+)
+
+const migrateUsage = "usage: accounts migrate up|down|status"
+
+// runMigrate applies the embedded schema migrations: up applies all pending
+// migrations, down rolls back the latest one and status lists them all.
+func runMigrate(ctx context.Context, dsn string, args []string) error {
+	if len(args) != 1 {
+		return errors.New(migrateUsage)
+	}
+
+	conn, err := db.Open(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	m, err := db.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := m.Up(ctx)
+		for _, r := range results {
+			fmt.Println(r)
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return nil
+	case "down":
+		r, err := m.Down(ctx)
+		if r != nil {
+			fmt.Println(r)
+		}
+		return err
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tSTATE\tAPPLIED AT\tMIGRATION")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Source.Version, s.State, appliedAt, s.Source.Path)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus/push"
+
+	"cex/internal/accounts/db"
+	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/reconcile"
+	"cex/pkg/cfg"
+)
+
+// errDiscrepancies makes the command exit non-zero when balances disagree.
+var errDiscrepancies = errors.New("balance discrepancies found")
+
+// runReconcile recomputes every balance from the ledger, compares it with the
+// account_balances projection and with the balances rebuilt from the events
+// topic, writes a JSON report and optionally pushes the gauges to a
+// Prometheus Pushgateway.
+func runReconcile(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	skipEvents := fs.Bool("skip-events", false, "do not compare against the events topic")
+	output := fs.String("output", "-", "file to write the JSON report to, - for stdout")
+	pushURL := fs.String("pushgateway", "", "Pushgateway URL to push the reconciliation gauges to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := db.Open(ctx, cfg.Cfg.Accounts.DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Read the topic before the tables so that events published while
+	// reconciling show up as ledger-ahead rather than events-ahead
+	var events reconcile.Balances
+	if !*skipEvents {
+		events, err = reconcile.ConsumeEvents(ctx, cfg.Cfg.Kafka.Brokers, cfg.Cfg.Kafka.TopicAccounts)
+		if err != nil {
+			return fmt.Errorf("consume events: %w", err)
+		}
+	}
+	ledger, err := reconcile.LedgerBalances(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("ledger balances: %w", err)
+	}
+	projected, err := reconcile.ProjectedBalances(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("projected balances: %w", err)
+	}
+
+	report := reconcile.Compare(ledger, projected, events)
+	if err := writeReport(*output, report); err != nil {
+		return err
+	}
+
+	report.Observe()
+	if *pushURL != "" {
+		if err := push.New(*pushURL, "accounts_reconcile").
+			Collector(metrics.ReconcileBalancesChecked).
+			Collector(metrics.ReconcileDiscrepancies).
+			Collector(metrics.ReconcileLastRun).
+			PushContext(ctx); err != nil {
+			return fmt.Errorf("push metrics: %w", err)
+		}
+	}
+
+	if len(report.Discrepancies) > 0 {
+		return fmt.Errorf("%w: %d of %d balances", errDiscrepancies, len(report.Discrepancies), report.Checked)
+	}
+	return nil
+}
+
+// writeReport writes report as indented JSON to path, or stdout for -.
+func writeReport(path string, report any) error {
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
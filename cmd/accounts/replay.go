@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/reconcile"
+	"cex/internal/accounts/replay"
+	"cex/pkg/cfg"
+)
+
+// projections are the read models `accounts replay` can rebuild, by name.
+var projections = map[string]func() replay.Projection{
+	"balances":  func() replay.Projection { return reconcile.NewEventProjection() },
+	"sequences": func() replay.Projection { return replay.NewSequences() },
+}
+
+// replayReport is the JSON output of runReplay.
+type replayReport struct {
+	Progress    replay.Progress `json:"progress"`
+	Projections map[string]any  `json:"projections,omitempty"`
+}
+
+// runReplay reads account events from the Kafka topic or the file backend
+// and feeds them through the selected projections, printing progress to
+// stderr and the rebuilt projections as a JSON report.
+func runReplay(ctx context.Context, args []string) error {
+	defaultSource := queue.BackendKafka
+	if cfg.Cfg.Events.Backend == queue.BackendFile {
+		defaultSource = queue.BackendFile
+	}
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	source := fs.String("source", defaultSource, "where to read events from: kafka or file")
+	file := fs.String("file", cfg.Cfg.Events.File, "NDJSON events file of the file source")
+	topic := fs.String("topic", cfg.Cfg.Kafka.TopicAccounts, "topic of the kafka source")
+	fromOffset := fs.Int64("from-offset", 0, "offset of every partition, or line of the file, to start after")
+	fromTime := fs.String("from-time", "", "RFC 3339 time to start at; overrides -from-offset")
+	names := fs.String("projections", strings.Join(projectionNames(), ","), "comma-separated projections to rebuild")
+	dryRun := fs.Bool("dry-run", false, "read and count events without applying them")
+	interval := fs.Duration("progress", 10*time.Second, "how often to print progress")
+	output := fs.String("output", "-", "file to write the JSON report to, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	from := replay.Start{Offset: *fromOffset}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "from-offset" {
+			from.AfterOffset = true
+		}
+	})
+	if *fromTime != "" {
+		t, err := time.Parse(time.RFC3339, *fromTime)
+		if err != nil {
+			return fmt.Errorf("-from-time: %w", err)
+		}
+		from.Time = t
+	}
+
+	r := replay.New(replay.Options{
+		DryRun:           *dryRun,
+		ProgressInterval: *interval,
+		OnProgress: func(p replay.Progress) {
+			fmt.Fprintf(os.Stderr, "replay: %d events read, %d skipped, at %s after %s\n",
+				p.Read, p.Skipped, p.Position, p.Elapsed.Round(time.Second))
+		},
+	})
+	var selected []replay.Projection
+	for _, name := range strings.Split(*names, ",") {
+		newProjection, ok := projections[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown projection %q (have %s)", name, strings.Join(projectionNames(), ", "))
+		}
+		selected = append(selected, newProjection())
+	}
+	r.Register(selected...)
+
+	var src replay.Source
+	var err error
+	switch *source {
+	case queue.BackendKafka:
+		src, err = replay.NewKafkaSource(ctx, cfg.Cfg.Kafka.Brokers, *topic, from)
+	case queue.BackendFile:
+		src, err = replay.NewFileSource(*file, from)
+	default:
+		err = fmt.Errorf("unknown source %q", *source)
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	progress, runErr := r.Run(ctx, src)
+	report := replayReport{Progress: progress}
+	if !*dryRun {
+		report.Projections = make(map[string]any)
+		for _, p := range selected {
+			if rep, ok := p.(replay.Reporter); ok {
+				report.Projections[p.Name()] = rep.Report()
+			}
+		}
+	}
+	if err := writeReport(*output, report); err != nil {
+		return err
+	}
+	return runErr
+}
+
+func projectionNames() []string {
+	names := make([]string, 0, len(projections))
+	for name := range projections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -12,6 +12,8 @@ import (
 func CRDB(dsn string, logHandler slog.Handler) *gorm.DB {
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: sloggorm.New(sloggorm.WithHandler(logHandler)),
+		// Surface unique violations as gorm.ErrDuplicatedKey
+		TranslateError: true,
 	})
 	if err != nil {
 		panic("failed to connect to database: " + err.Error())
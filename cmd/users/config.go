@@ -1,9 +1,32 @@
 package main
 
+import "time"
+
 type Config struct {
 	IsDev bool
 
 	CockroachDB struct {
 		DSN string
 	}
+
+	JWT struct {
+		// Secret encrypts the signing keys and TOTP secrets stored in the
+		// database.
+		Secret string
+		// Algorithm of the signing keys, EdDSA (default) or RS256.
+		Algorithm string
+		// RotateEvery defaults to 720h and PublishDelay to 5m.
+		RotateEvery  time.Duration
+		PublishDelay time.Duration
+		// Issuer defaults to "users".
+		Issuer string
+		// AccessTTL defaults to 15m and RefreshTTL to 720h.
+		AccessTTL  time.Duration
+		RefreshTTL time.Duration
+	}
+
+	MFA struct {
+		// Issuer names the accounts in authenticator apps, "CEX" by default.
+		Issuer string
+	}
 }
@@ -8,6 +8,7 @@ import (
 
 	"cex/cmd"
 	"cex/internal/users"
+	"cex/internal/users/service"
 	"cex/pkg/cfg"
 	"cex/pkg/otel"
 )
@@ -34,11 +35,31 @@ func main() {
 		err = errors.Join(err, otelShutdown(context.Background()))
 	}()
 
-	app := users.New(users.Opts{
+	app, err := users.New(users.Opts{
 		ListenAddress: "localhost:3000",
 		DB:            db,
 		Log:           logger,
+		Tokens: service.TokenConfig{
+			Issuer:     config.JWT.Issuer,
+			AccessTTL:  config.JWT.AccessTTL,
+			RefreshTTL: config.JWT.RefreshTTL,
+		},
+		Keys: service.KeyConfig{
+			Secret:       []byte(config.JWT.Secret),
+			Algorithm:    config.JWT.Algorithm,
+			RotateEvery:  config.JWT.RotateEvery,
+			PublishDelay: config.JWT.PublishDelay,
+		},
+		MFA: service.MFAConfig{
+			Secret: []byte(config.JWT.Secret),
+			Issuer: config.MFA.Issuer,
+		},
 	})
+	if err != nil {
+		panic(err)
+	}
 
-	app.Run()
+	if err := app.Run(ctx); err != nil {
+		logger.Error("users service stopped", "error", err)
+	}
 }
@@ -1,11 +0,0 @@
--- Create accounts table
-CREATE TABLE accounts (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    owner_id UUID NOT NULL,
-    balance NUMERIC(30,10) NOT NULL DEFAULT 0,
-    currency VARCHAR(3) NOT NULL,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
-);
-
--- Create an index on owner_id
-CREATE INDEX idx_accounts_owner_id ON accounts (owner_id);
@@ -14,9 +14,3 @@ func GetAccount(c echo.Context) error {
 	// TODO: implement fetching by ID
 	return c.JSON(http.StatusOK, map[string]string{"stub": "GetAccount", "id": id})
 }
-
-// TransferFunds moves funds between fiat/spot/futures (placeholder).
-func TransferFunds(c echo.Context) error {
-	// TODO: parse JSON body, call service layer
-	return c.JSON(http.StatusAccepted, map[string]string{"stub": "TransferFunds"})
-}
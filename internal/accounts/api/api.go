@@ -1,10 +1,8 @@
 package api
 
 import (
-	"cex/internal/accounts/queue"
 	"database/sql"
 
-	jwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 
@@ -12,16 +10,20 @@ import (
 
 	"cex/internal/accounts/service"
 	"cex/pkg/apiutil"
-	"cex/pkg/cfg"
 )
 
-var jwtMiddleware = jwt.WithConfig(jwt.Config{
-	SigningKey:  []byte("your-jwt-secret"),
-	ContextKey:  "user",
-	TokenLookup: "header:Authorization",
-})
+// Auth is how the /accounts API authenticates requests.
+type Auth struct {
+	// Middleware runs for every request, e.g. JWT followed by RejectRevoked.
+	Middleware []echo.MiddlewareFunc
+	// MFA additionally guards transfers and adjustments, e.g. RequireMFA.
+	// They are not guarded when it is nil.
+	MFA echo.MiddlewareFunc
+}
 
-func RegisterRoutes(e *echo.Echo, db *sql.DB) {
+// RegisterRoutes mounts the /accounts API. svc carries the balance policy
+// configured for this deployment.
+func RegisterRoutes(e *echo.Echo, db *sql.DB, svc *service.AccountService, authn Auth) {
 	// 1) global middleware for JSON errors
 	e.Use(middleware.Recover())
 	e.HTTPErrorHandler = apiutil.JSONErrorHandler
@@ -30,25 +32,48 @@ func RegisterRoutes(e *echo.Echo, db *sql.DB) {
 	v := validator.New()
 	e.Validator = apiutil.NewEchoValidator(v)
 
-	// Create a Kafka publisher instance
-	publisher := queue.NewPublisher(
-		cfg.Cfg.Kafka.Brokers,       // e.g. []string{"localhost:9092"}
-		cfg.Cfg.Kafka.TopicAccounts, // e.g. "accounts-events"
-	)
-	// Pass the publisher to the service
-	svc := service.NewAccountService(db, publisher)
-	// apply JWT middleware (imported above)
-	g := e.Group("/accounts", jwt.WithConfig(jwt.Config{
-		SigningKey:  []byte("your-jwt-secret"),
-		ContextKey:  "user",
-		TokenLookup: "header:Authorization",
-	}))
+	// 3) authenticate every request
+	g := e.Group("/accounts", authn.Middleware...)
+	// Events produced by a request carry its request ID
+	g.Use(Correlation())
+	// Retried POSTs carrying an Idempotency-Key replay the original response
+	idempotent := Idempotency(service.NewIdempotencyStore(db, service.DefaultIdempotencyTTL))
+	// Moving funds takes a recent second factor
+	mfa := authn.MFA
+	if mfa == nil {
+		mfa = func(next echo.HandlerFunc) echo.HandlerFunc { return next }
+	}
+
 	// 4) POST /accounts
-	g.POST("", CreateAccountHandler(svc))
+	g.POST("", CreateAccountHandler(svc), idempotent)
 
 	// 5) GET /accounts/:id
 	g.GET("/:id", GetAccountHandler(svc))
 
 	// 6) GET /accounts?owner_id=&offset=&limit=
 	g.GET("", ListAccountsHandler(svc))
+
+	// 7) POST /accounts/transfers (two-factor)
+	g.POST("/transfers", TransferHandler(svc), mfa, idempotent)
+
+	// 8) GET /accounts/assets
+	g.GET("/assets", ListAssetsHandler(svc))
+
+	// 9) GET /accounts/:id/holds
+	g.GET("/:id/holds", ListHoldsHandler(svc))
+
+	// 10) POST /accounts/:id/adjustments (admin only, two-factor)
+	g.POST("/:id/adjustments", AdjustBalanceHandler(svc), RequireRole(RoleAdmin), mfa, idempotent)
+
+	// 11) POST /accounts/:id/freeze|unfreeze (admin only) and /close (owner)
+	g.POST("/:id/freeze", ChangeStatusHandler(svc, svc.FreezeAccount, false), RequireRole(RoleAdmin))
+	g.POST("/:id/unfreeze", ChangeStatusHandler(svc, svc.UnfreezeAccount, false), RequireRole(RoleAdmin))
+	g.POST("/:id/close", ChangeStatusHandler(svc, svc.CloseAccount, true))
+
+	// 12) GET /accounts/:id/history and /statement?format=json|csv
+	g.GET("/:id/history", BalanceHistoryHandler(svc))
+	g.GET("/:id/statement", StatementHandler(svc))
+
+	// 13) GET /accounts/:id/balance?at=RFC3339
+	g.GET("/:id/balance", BalanceAtHandler(svc))
 }
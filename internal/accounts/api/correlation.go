@@ -0,0 +1,25 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"cex/pkg/events"
+)
+
+// Correlation tags the events a request produces with its request ID, so
+// consumers can trace an event back to the call that caused it.
+func Correlation() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := c.Response().Header().Get(echo.HeaderXRequestID)
+			if id == "" {
+				id = c.Request().Header.Get(echo.HeaderXRequestID)
+			}
+			if id != "" {
+				req := c.Request()
+				c.SetRequest(req.WithContext(events.WithCorrelationID(req.Context(), id)))
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+	"context"
+	"encoding/csv"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -13,6 +17,7 @@ import (
 	"github.com/shopspring/decimal"
 
 	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/model"
 	"cex/internal/accounts/service"
 	"cex/pkg/apiutil"
 )
@@ -21,12 +26,134 @@ var validate = validator.New()
 
 // accountResponse defines JSON output
 type accountResponse struct {
-	ID        uuid.UUID       `json:"id"`
-	OwnerID   uuid.UUID       `json:"owner_id"`
-	Balance   decimal.Decimal `json:"balance"`
-	Type      string          `json:"type"`
-	CreatedAt string          `json:"created_at"`
-	UpdatedAt string          `json:"updated_at"`
+	ID        uuid.UUID                  `json:"id"`
+	OwnerID   uuid.UUID                  `json:"owner_id"`
+	Balances  map[string]balanceResponse `json:"balances"`
+	Type      string                     `json:"type"`
+	Status    model.AccountStatus        `json:"status"`
+	CreatedAt string                     `json:"created_at"`
+	UpdatedAt string                     `json:"updated_at"`
+}
+
+// balanceResponse splits an asset balance into spendable and held funds.
+type balanceResponse struct {
+	Available decimal.Decimal `json:"available"`
+	Locked    decimal.Decimal `json:"locked"`
+	Total     decimal.Decimal `json:"total"`
+}
+
+// listResponse wraps one page of a list endpoint. NextCursor is passed as the
+// cursor query parameter to fetch the next page and omitted on the last one.
+type listResponse[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// queryLimit parses the optional limit query parameter. Zero means the
+// service default.
+func queryLimit(c echo.Context) (int, error) {
+	raw := c.QueryParam("limit")
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 {
+		return 0, apiutil.NewBadRequestError("limit must be a positive integer")
+	}
+	return limit, nil
+}
+
+// parseAccountQuery reads the list filters from the query string. type and
+// status take comma separated values, created_from and created_to RFC 3339
+// timestamps.
+func parseAccountQuery(c echo.Context) (service.AccountQuery, error) {
+	limit, err := queryLimit(c)
+	if err != nil {
+		return service.AccountQuery{}, err
+	}
+	q := service.AccountQuery{
+		Asset:  c.QueryParam("asset"),
+		Sort:   service.AccountSort(c.QueryParam("sort")),
+		Cursor: c.QueryParam("cursor"),
+		Size:   limit,
+	}
+	if v := c.QueryParam("type"); v != "" {
+		q.Types = strings.Split(v, ",")
+	}
+	if v := c.QueryParam("status"); v != "" {
+		for _, st := range strings.Split(v, ",") {
+			q.Statuses = append(q.Statuses, model.AccountStatus(st))
+		}
+	}
+	for name, dst := range map[string]**decimal.Decimal{"min_balance": &q.MinBalance, "max_balance": &q.MaxBalance} {
+		if v := c.QueryParam(name); v != "" {
+			d, err := decimal.NewFromString(v)
+			if err != nil {
+				return service.AccountQuery{}, apiutil.NewBadRequestError(name + " must be a decimal")
+			}
+			*dst = &d
+		}
+	}
+	if q.CreatedFrom, err = queryTime(c, "created_from"); err != nil {
+		return service.AccountQuery{}, err
+	}
+	if q.CreatedTo, err = queryTime(c, "created_to"); err != nil {
+		return service.AccountQuery{}, err
+	}
+	return q, nil
+}
+
+func newAccountResponse(a model.Account) accountResponse {
+	balances := make(map[string]balanceResponse, len(a.Balances))
+	for asset, b := range a.Balances {
+		balances[asset] = balanceResponse{
+			Available: b.Available(),
+			Locked:    b.Locked,
+			Total:     b.Balance,
+		}
+	}
+	return accountResponse{
+		ID:        a.ID,
+		OwnerID:   a.OwnerID,
+		Balances:  balances,
+		Type:      a.Type,
+		Status:    a.Status,
+		CreatedAt: a.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: a.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// userIDFromToken returns the user UUID from the "sub" claim of the JWT
+// stored by the auth middleware.
+func userIDFromToken(c echo.Context) (uuid.UUID, error) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return uuid.Nil, apiutil.NewUnauthorizedError("missing JWT")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return uuid.Nil, apiutil.NewUnauthorizedError("invalid JWT claims")
+	}
+	sub, _ := claims["sub"].(string) // assume sub = user UUID
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return uuid.Nil, apiutil.NewUnauthorizedError("invalid JWT subject")
+	}
+	return userID, nil
+}
+
+// ownedAccount returns account id if it belongs to userID. Accounts of other
+// users are reported as not found, so callers cannot probe which account IDs
+// exist.
+func ownedAccount(ctx context.Context, svc *service.AccountService, id, userID uuid.UUID) (model.Account, error) {
+	acct, err := svc.GetAccount(ctx, id)
+	if err != nil {
+		return model.Account{}, err
+	}
+	if acct.OwnerID != userID {
+		return model.Account{}, service.ErrAccountNotFound
+	}
+	return acct, nil
 }
 
 func CreateAccountHandler(svc *service.AccountService) echo.HandlerFunc {
@@ -41,16 +168,15 @@ func CreateAccountHandler(svc *service.AccountService) echo.HandlerFunc {
 		if err := validate.Struct(&r); err != nil {
 			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
 		}
-		userID := c.Get("userID").(string)
-		userUUID, err := uuid.Parse(userID)
+		userID, err := userIDFromToken(c)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": "invalid user ID"})
+			return err
 		}
-		acct, err := svc.CreateAccount(c.Request().Context(), userUUID, r.Type)
+		acct, err := svc.CreateAccount(c.Request().Context(), userID, r.Type)
 		if err != nil {
 			return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 		}
-		return c.JSON(http.StatusCreated, acct)
+		return c.JSON(http.StatusCreated, newAccountResponse(acct))
 	}
 }
 
@@ -60,12 +186,9 @@ func GetAccountHandler(svc *service.AccountService) echo.HandlerFunc {
 		defer timer.ObserveDuration()
 
 		// Extract userID from JWT claims
-		token := c.Get("user").(*jwt.Token)
-		claims := token.Claims.(jwt.MapClaims)
-		uidStr := claims["sub"].(string) // assume sub = user UUID
-		userID, err := uuid.Parse(uidStr)
+		userID, err := userIDFromToken(c)
 		if err != nil {
-			return apiutil.NewUnauthorizedError("invalid JWT subject")
+			return err
 		}
 
 		// 1) parse & validate path param
@@ -76,25 +199,13 @@ func GetAccountHandler(svc *service.AccountService) echo.HandlerFunc {
 		}
 
 		// 2) call service
-		acct, err := svc.GetAccount(c.Request().Context(), acctID)
+		acct, err := ownedAccount(c.Request().Context(), svc, acctID, userID)
 		if err != nil {
 			return apiutil.HandleServiceError(c, err)
 		}
 
-		// Check if the account belongs to the user
-		if acct.OwnerID != userID {
-			return apiutil.NewForbiddenError("not your account")
-		}
-
 		// 3) respond
-		res := accountResponse{
-			ID:        acct.ID,
-			OwnerID:   acct.OwnerID,
-			Balance:   acct.Balance,
-			Type:      acct.Type,
-			CreatedAt: acct.CreatedAt.Format(time.RFC3339),
-			UpdatedAt: acct.UpdatedAt.Format(time.RFC3339),
-		}
+		res := newAccountResponse(acct)
 
 		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(c.Response().Status)).Inc()
 		return c.JSON(http.StatusOK, res)
@@ -107,38 +218,395 @@ func ListAccountsHandler(svc *service.AccountService) echo.HandlerFunc {
 		defer timer.ObserveDuration()
 
 		// Extract userID from JWT claims
-		token := c.Get("user").(*jwt.Token)
-		claims := token.Claims.(jwt.MapClaims)
-		uidStr := claims["sub"].(string)
-		userID, err := uuid.Parse(uidStr)
+		userID, err := userIDFromToken(c)
 		if err != nil {
-			return apiutil.NewUnauthorizedError("invalid JWT subject")
+			return err
 		}
 
-		// 1) parse query params offset, limit
-		offset, _ := strconv.Atoi(c.QueryParam("offset"))
-		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		// 1) parse filters, sort, cursor and limit
+		q, err := parseAccountQuery(c)
+		if err != nil {
+			return err
+		}
+		q.OwnerID = userID
 
 		// 2) call service with the userID
-		accts, err := svc.ListAccounts(c.Request().Context(), userID, offset, limit)
+		page, err := svc.ListAccounts(c.Request().Context(), q)
 		if err != nil {
 			return apiutil.HandleServiceError(c, err)
 		}
 
 		// 3) map to []accountResponse
-		var out []accountResponse
-		for _, a := range accts {
-			out = append(out, accountResponse{
-				ID:        a.ID,
-				OwnerID:   a.OwnerID,
-				Balance:   a.Balance,
-				Type:      a.Type,
-				CreatedAt: a.CreatedAt.Format(time.RFC3339),
-				UpdatedAt: a.UpdatedAt.Format(time.RFC3339),
-			})
+		out := listResponse[accountResponse]{
+			Data:       make([]accountResponse, 0, len(page.Accounts)),
+			NextCursor: page.NextCursor,
+		}
+		for _, a := range page.Accounts {
+			out.Data = append(out.Data, newAccountResponse(a))
 		}
 
-		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(c.Response().Status)).Inc()
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
+		return c.JSON(http.StatusOK, out)
+	}
+}
+
+func TransferHandler(svc *service.AccountService) echo.HandlerFunc {
+	type req struct {
+		FromAccountID uuid.UUID       `json:"from_account_id" validate:"required"`
+		ToAccountID   uuid.UUID       `json:"to_account_id" validate:"required"`
+		Asset         string          `json:"asset" validate:"required,max=16"`
+		Amount        decimal.Decimal `json:"amount" validate:"required"`
+	}
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		userID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+
+		// 1) parse & validate body
+		var r req
+		if err := c.Bind(&r); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if err := validate.Struct(&r); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+		}
+
+		// 2) both accounts must belong to the caller
+		ctx := c.Request().Context()
+		for _, id := range []uuid.UUID{r.FromAccountID, r.ToAccountID} {
+			if _, err := ownedAccount(ctx, svc, id, userID); err != nil {
+				return apiutil.HandleServiceError(c, err)
+			}
+		}
+
+		// 3) call service
+		transfer, err := svc.Transfer(ctx, r.FromAccountID, r.ToAccountID, r.Asset, r.Amount)
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusCreated)).Inc()
+		return c.JSON(http.StatusCreated, transfer)
+	}
+}
+
+func ListAssetsHandler(svc *service.AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		assets, err := svc.ListAssets(c.Request().Context())
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+		return c.JSON(http.StatusOK, assets)
+	}
+}
+
+func ListHoldsHandler(svc *service.AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		userID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+
+		ctx := c.Request().Context()
+		if _, err := ownedAccount(ctx, svc, acctID, userID); err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		holds, err := svc.ListHolds(ctx, acctID)
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+		if holds == nil {
+			holds = []model.Hold{}
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
+		return c.JSON(http.StatusOK, holds)
+	}
+}
+
+// AdjustBalanceHandler lets an operator credit or debit any account. The
+// operator is the caller identified by the JWT.
+func AdjustBalanceHandler(svc *service.AccountService) echo.HandlerFunc {
+	type req struct {
+		Asset  string          `json:"asset" validate:"required,max=16"`
+		Amount decimal.Decimal `json:"amount" validate:"required"`
+		Reason string          `json:"reason" validate:"required,oneof=deposit withdrawal fee rebate correction"`
+	}
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		operatorID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+
+		var r req
+		if err := c.Bind(&r); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if err := validate.Struct(&r); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+		}
+
+		adj, err := svc.AdjustBalance(c.Request().Context(), service.AdjustmentRequest{
+			AccountID:  acctID,
+			Asset:      r.Asset,
+			Amount:     r.Amount,
+			Reason:     model.AdjustmentReason(r.Reason),
+			OperatorID: operatorID,
+		})
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusCreated)).Inc()
+		return c.JSON(http.StatusCreated, adj)
+	}
+}
+
+// statusChangeFunc is one of the AccountService status transitions.
+type statusChangeFunc func(ctx context.Context, id, actorID uuid.UUID, reason string) (model.Account, error)
+
+// ChangeStatusHandler applies a status transition with the reason from the
+// request body. With ownerOnly set, callers may only change their own
+// accounts; otherwise the route must be restricted by RequireRole.
+func ChangeStatusHandler(svc *service.AccountService, change statusChangeFunc, ownerOnly bool) echo.HandlerFunc {
+	type req struct {
+		Reason string `json:"reason" validate:"required,max=500"`
+	}
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		actorID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+
+		var r req
+		if err := c.Bind(&r); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if err := validate.Struct(&r); err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, echo.Map{"error": err.Error()})
+		}
+
+		ctx := c.Request().Context()
+		if ownerOnly {
+			if _, err := ownedAccount(ctx, svc, acctID, actorID); err != nil {
+				return apiutil.HandleServiceError(c, err)
+			}
+		}
+
+		acct, err := change(ctx, acctID, actorID, r.Reason)
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
+		return c.JSON(http.StatusOK, newAccountResponse(acct))
+	}
+}
+
+// BalanceHistoryHandler lists the balance changes of one of the caller's
+// accounts, newest first.
+func BalanceHistoryHandler(svc *service.AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		userID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+		limit, err := queryLimit(c)
+		if err != nil {
+			return err
+		}
+		from, err := queryTime(c, "from")
+		if err != nil {
+			return err
+		}
+		to, err := queryTime(c, "to")
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+		if _, err := ownedAccount(ctx, svc, acctID, userID); err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		page, err := svc.BalanceHistory(ctx, service.HistoryQuery{
+			AccountID: acctID,
+			Asset:     c.QueryParam("asset"),
+			From:      from,
+			To:        to,
+			Cursor:    c.QueryParam("cursor"),
+			Size:      limit,
+		})
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+		out := listResponse[model.BalanceChange]{Data: page.Changes, NextCursor: page.NextCursor}
+		if out.Data == nil {
+			out.Data = []model.BalanceChange{}
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
 		return c.JSON(http.StatusOK, out)
 	}
 }
+
+// StatementHandler returns the statement of one asset of the caller's account
+// over [from, to), as JSON or, with format=csv, as a CSV download.
+func StatementHandler(svc *service.AccountService) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		userID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+		from, err := queryTime(c, "from")
+		if err != nil {
+			return err
+		}
+		to, err := queryTime(c, "to")
+		if err != nil {
+			return err
+		}
+		if from.IsZero() || to.IsZero() {
+			return apiutil.NewBadRequestError("from and to are required")
+		}
+		format := c.QueryParam("format")
+		if format != "" && format != "json" && format != "csv" {
+			return apiutil.NewBadRequestError("format must be json or csv")
+		}
+
+		ctx := c.Request().Context()
+		if _, err := ownedAccount(ctx, svc, acctID, userID); err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		st, err := svc.Statement(ctx, acctID, c.QueryParam("asset"), from, to)
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
+		if format == "csv" {
+			return writeStatementCSV(c, st)
+		}
+		return c.JSON(http.StatusOK, st)
+	}
+}
+
+// writeStatementCSV writes one row per change between an opening and a
+// closing balance row.
+func writeStatementCSV(c echo.Context, st model.Statement) error {
+	filename := fmt.Sprintf("statement-%s-%s-%s-%s.csv",
+		st.AccountID, st.Asset, st.From.Format("20060102"), st.To.Format("20060102"))
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"timestamp", "reason", "journal_id", "delta", "old_balance", "new_balance"})
+	w.Write([]string{st.From.Format(time.RFC3339), "opening_balance", "", "", "", st.OpeningBalance.String()})
+	for _, ch := range st.Changes {
+		w.Write([]string{
+			ch.CreatedAt.Format(time.RFC3339Nano), ch.Reason, ch.JournalID.String(),
+			ch.Delta.String(), ch.OldBalance.String(), ch.NewBalance.String(),
+		})
+	}
+	w.Write([]string{st.To.Format(time.RFC3339), "closing_balance", "", "", "", st.ClosingBalance.String()})
+	w.Flush()
+	return w.Error()
+}
+
+// queryTime parses an optional RFC 3339 query parameter.
+func queryTime(c echo.Context, name string) (time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, apiutil.NewBadRequestError(name + " must be an RFC 3339 timestamp")
+	}
+	return t, nil
+}
+
+// BalanceAtHandler returns the balance of every asset of the caller's account
+// as of the required at query parameter.
+func BalanceAtHandler(svc *service.AccountService) echo.HandlerFunc {
+	type resp struct {
+		AccountID uuid.UUID                  `json:"account_id"`
+		At        time.Time                  `json:"at"`
+		Balances  map[string]decimal.Decimal `json:"balances"`
+	}
+	return func(c echo.Context) error {
+		timer := prometheus.NewTimer(metrics.RequestDuration.WithLabelValues(c.Request().Method, c.Path()))
+		defer timer.ObserveDuration()
+
+		userID, err := userIDFromToken(c)
+		if err != nil {
+			return err
+		}
+		acctID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			return apiutil.NewBadRequestError("invalid account ID")
+		}
+		at, err := queryTime(c, "at")
+		if err != nil {
+			return err
+		}
+		if at.IsZero() {
+			return apiutil.NewBadRequestError("at is required")
+		}
+
+		ctx := c.Request().Context()
+		if _, err := ownedAccount(ctx, svc, acctID, userID); err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		balances, err := svc.BalanceAt(ctx, acctID, at)
+		if err != nil {
+			return apiutil.HandleServiceError(c, err)
+		}
+
+		metrics.RequestsTotal.WithLabelValues(c.Request().Method, c.Path(), strconv.Itoa(http.StatusOK)).Inc()
+		return c.JSON(http.StatusOK, resp{AccountID: acctID, At: at, Balances: balances})
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"cex/internal/accounts/service"
+	"cex/pkg/apiutil"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a retriable request.
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on responses replayed from the store.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen = 255
+)
+
+// Idempotency makes a route safe to retry. Requests carrying an
+// Idempotency-Key header are executed once per user and key; retries with the
+// same payload get the original response, retries with a different payload
+// are rejected with 422. Requests without the header pass through unchanged.
+func Idempotency(store *service.IdempotencyStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := c.Request().Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				return apiutil.NewBadRequestError("Idempotency-Key is too long")
+			}
+
+			userID, err := userIDFromToken(c)
+			if err != nil {
+				return err
+			}
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return apiutil.NewBadRequestError("unreadable request body")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+			// The URL rather than the route: the same key and body sent to
+			// another account is another request
+			hash := requestHash(c.Request().Method, c.Request().URL.Path, body)
+
+			ctx := c.Request().Context()
+			token, stored, err := store.Reserve(ctx, userID, key, hash)
+			if err != nil {
+				return apiutil.HandleServiceError(c, err)
+			}
+			if stored != nil {
+				c.Response().Header().Set(IdempotentReplayedHeader, "true")
+				return c.JSONBlob(stored.StatusCode, stored.Body)
+			}
+
+			rec := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = rec
+			err = next(c)
+			// Record the outcome even if the client went away meanwhile, or
+			// the key stays blocked until the lease runs out
+			ctx = context.WithoutCancel(ctx)
+			if err != nil {
+				// Errors are rendered later by the HTTP error handler, so
+				// nothing was recorded: let the client retry the key.
+				store.Release(ctx, userID, key, token)
+				return err
+			}
+
+			status := c.Response().Status
+			if status >= http.StatusInternalServerError {
+				store.Release(ctx, userID, key, token)
+				return nil
+			}
+			if err := store.Complete(ctx, userID, key, token, service.StoredResponse{
+				StatusCode: status,
+				Body:       rec.body.Bytes(),
+			}); err != nil {
+				c.Logger().Error("failed to record idempotent response", "error", err)
+			}
+			return nil
+		}
+	}
+}
+
+// requestHash fingerprints the method, path and body of a request.
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder tees the response body so it can be stored.
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
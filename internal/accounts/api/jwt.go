@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+
+	"cex/pkg/apiutil"
+	"cex/pkg/auth"
+)
+
+// JWT authenticates requests by their "Authorization: Bearer" access token,
+// verified with the key keyfunc returns for it, e.g. a JWKS cache of the
+// users service. Other tokens signed by the same keys, such as login
+// challenges, are rejected. The *jwt.Token is stored under "user" for the
+// handlers.
+func JWT(keyfunc jwt.Keyfunc) echo.MiddlewareFunc {
+	parser := jwt.NewParser(jwt.WithValidMethods(auth.Algorithms))
+	return echojwt.WithConfig(echojwt.Config{
+		ContextKey: "user",
+		// echo-jwt parses with golang-jwt v5; the handlers read v4 tokens
+		ParseTokenFunc: func(c echo.Context, token string) (any, error) {
+			parsed, err := parser.Parse(token, keyfunc)
+			if err != nil {
+				return nil, err
+			}
+			if claims, _ := parsed.Claims.(jwt.MapClaims); claims["token_use"] != auth.TokenUseAccess {
+				return nil, errors.New("not an access token")
+			}
+			return parsed, nil
+		},
+		// echo-jwt answers a missing token with 400
+		ErrorHandler: func(c echo.Context, err error) error {
+			if errors.Is(err, echojwt.ErrJWTMissing) {
+				return apiutil.NewUnauthorizedError("missing JWT")
+			}
+			return apiutil.NewUnauthorizedError("invalid or expired JWT")
+		},
+	})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+
+	"cex/pkg/apiutil"
+	"cex/pkg/auth"
+)
+
+// RequireMFA rejects requests whose JWT does not show two-factor
+// authentication (an "otp" amr) within maxAge of its "auth_time", with any
+// age accepted when maxAge is 0. Users step up with the users service and
+// retry. It must run after the JWT middleware.
+func RequireMFA(maxAge time.Duration) echo.MiddlewareFunc {
+	challenge := `Bearer error="insufficient_user_authentication"`
+	if maxAge > 0 {
+		challenge += fmt.Sprintf(`, max_age=%d`, int64(maxAge/time.Second))
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return apiutil.NewUnauthorizedError("missing JWT")
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				return apiutil.NewUnauthorizedError("invalid JWT claims")
+			}
+			if !hasMFA(claims, maxAge, time.Now()) {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+				return apiutil.NewForbiddenError("two-factor authentication required")
+			}
+			return next(c)
+		}
+	}
+}
+
+func hasMFA(claims jwt.MapClaims, maxAge time.Duration, now time.Time) bool {
+	amr, _ := claims["amr"].([]interface{})
+	otp := false
+	for _, m := range amr {
+		if m == auth.AMROTP {
+			otp = true
+		}
+	}
+	if !otp {
+		return false
+	}
+	if maxAge == 0 {
+		return true
+	}
+	var authTime float64
+	switch v := claims["auth_time"].(type) {
+	case float64:
+		authTime = v
+	case json.Number:
+		authTime, _ = v.Float64()
+	default:
+		return false
+	}
+	return now.Sub(time.Unix(int64(authTime), 0)) <= maxAge
+}
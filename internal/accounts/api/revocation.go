@@ -0,0 +1,31 @@
+package api
+
+import (
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+
+	"cex/pkg/apiutil"
+	"cex/pkg/auth"
+)
+
+// RejectRevoked rejects requests whose JWT was revoked by the users service,
+// e.g. on logout. Tokens without a "jti" claim cannot be revoked and pass.
+// It must run after the JWT middleware.
+func RejectRevoked(denylist *auth.Denylist) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return apiutil.NewUnauthorizedError("missing JWT")
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				return apiutil.NewUnauthorizedError("invalid JWT claims")
+			}
+			if jti, _ := claims["jti"].(string); jti != "" && denylist.IsRevoked(jti) {
+				return apiutil.NewUnauthorizedError("token has been revoked")
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+
+	"cex/pkg/apiutil"
+)
+
+// RoleAdmin is the JWT role allowed to adjust balances.
+const RoleAdmin = "admin"
+
+// RequireRole rejects requests whose JWT "roles" claim does not contain role.
+// It must run after the JWT middleware.
+func RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token, ok := c.Get("user").(*jwt.Token)
+			if !ok {
+				return apiutil.NewUnauthorizedError("missing JWT")
+			}
+			claims, ok := token.Claims.(jwt.MapClaims)
+			if !ok {
+				return apiutil.NewUnauthorizedError("invalid JWT claims")
+			}
+			roles, _ := claims["roles"].([]interface{})
+			for _, r := range roles {
+				if r == role {
+					return next(c)
+				}
+			}
+			return apiutil.NewForbiddenError(role + " role required")
+		}
+	}
+}
@@ -4,19 +4,25 @@ package accounts
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
+	"time"
 
 	"cex/internal/accounts/api"
 	"cex/internal/accounts/db"
 	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/service"
+	"cex/pkg/auth"
 	"cex/pkg/cfg"
+	"cex/pkg/events"
 
 	"github.com/brpaz/echozap"
 	echoprom "github.com/labstack/echo-contrib/echoprometheus"
-	jwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/segmentio/kafka-go"
 	"go.uber.org/zap"
 )
 
@@ -46,32 +52,165 @@ func NewServer() (*echo.Echo, *sql.DB, error) {
 	e.Use(metrics.Middleware())
 	metrics.RegisterMetricsEndpoint(e)
 
-	if err := e.Start(":" + cfg.Cfg.Accounts.Port); err != nil {
-		zapLog.Fatal("failed to start accounts service", zap.Error(err))
-	}
-
 	// Expose /metrics for Prometheus scraping
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 
-	// 5) JWT authentication for all routes under /accounts
-	e.Use(jwt.WithConfig(jwt.Config{
-		SigningKey:  []byte(cfg.Cfg.Users.JWTSecret),
-		ContextKey:  "user",                 // claims stored in c.Get("user")
-		TokenLookup: "header:Authorization", // look for "Authorization: Bearer <token>"
+	// 5) JWT authentication for all routes under /accounts, verified with
+	// the keys the users service publishes
+	if cfg.Cfg.Users.JWKSURL == "" {
+		return nil, nil, errors.New("users.jwks_url is required")
+	}
+	jwksInterval := cfg.Cfg.Users.JWKSInterval
+	if jwksInterval <= 0 {
+		jwksInterval = 5 * time.Minute
+	}
+	jwks := auth.NewJWKSCache(cfg.Cfg.Users.JWKSURL, nil)
+	jwksCtx, stopJWKS := context.WithCancel(context.Background())
+	go jwks.Run(jwksCtx, jwksInterval, zapLog)
+	e.Server.RegisterOnShutdown(stopJWKS)
+	mfaMaxAge := cfg.Cfg.Users.MFAMaxAge
+	if mfaMaxAge <= 0 {
+		mfaMaxAge = 15 * time.Minute
+	}
+	authn := api.Auth{
+		Middleware: []echo.MiddlewareFunc{api.JWT(jwks.Keyfunc)},
+		// Transfers and adjustments take a second factor at most mfaMaxAge old
+		MFA: api.RequireMFA(mfaMaxAge),
+	}
 
-	}))
+	// Reject tokens revoked by the users service, polling its denylist
+	// until the HTTP server shuts down
+	if cfg.Cfg.Users.RevocationURL != "" {
+		interval := cfg.Cfg.Users.RevocationInterval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		denylist := auth.NewDenylist(cfg.Cfg.Users.RevocationURL, nil)
+		denylistCtx, stopDenylist := context.WithCancel(context.Background())
+		go denylist.Run(denylistCtx, interval, zapLog)
+		e.Server.RegisterOnShutdown(stopDenylist)
+		authn.Middleware = append(authn.Middleware, api.RejectRevoked(denylist))
+	}
 
-	// 6) Connect to CockroachDB/Postgres and run migrations
+	policy, err := service.ParseBalancePolicy(cfg.Cfg.Accounts.CreditLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serializer, err := events.ForFormat(cfg.Cfg.Kafka.EventFormat)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The relay marks events published once the backend accepts them, so
+	// the memory backend would lose them on restart
+	if cfg.Cfg.Events.Backend == queue.BackendMemory {
+		return nil, nil, errors.New("events.backend memory is for tests only")
+	}
+	backend, err := queue.NewEventPublisher(queue.PublisherConfig{
+		Backend:    cfg.Cfg.Events.Backend,
+		Brokers:    cfg.Cfg.Kafka.Brokers,
+		Topic:      cfg.Cfg.Kafka.TopicAccounts,
+		Serializer: serializer,
+		File:       cfg.Cfg.Events.File,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Every publish, including dead-lettered commands, goes through one
+	// retry policy and circuit breaker
+	pubCfg := cfg.Cfg.Events.Publish
+	retry := queue.RetryPolicy{
+		MaxAttempts:    pubCfg.MaxAttempts,
+		InitialBackoff: pubCfg.InitialBackoff,
+		MaxBackoff:     pubCfg.MaxBackoff,
+		Jitter:         pubCfg.Jitter,
+	}
+	publisher := queue.NewResilientPublisher("accounts-events", backend, retry, queue.BreakerSettings{
+		FailureThreshold: pubCfg.BreakerFailures,
+		Timeout:          pubCfg.BreakerTimeout,
+		MaxRequests:      pubCfg.BreakerMaxRequests,
+		Interval:         pubCfg.BreakerInterval,
+	}, zapLog)
+
+	// 6) Connect to CockroachDB/Postgres; migrations are applied with
+	// `accounts migrate up`, so refuse to serve an outdated schema
 	ctx := context.Background()
-	dbConn, err := db.OpenAndMigrate(ctx, cfg.Cfg.Accounts.DSN)
+	dbConn, err := db.Open(ctx, cfg.Cfg.Accounts.DSN)
 	if err != nil {
+		publisher.Close()
 		return nil, nil, err
 	}
+	if err := db.CheckSchema(ctx, dbConn); err != nil {
+		publisher.Close()
+		dbConn.Close()
+		return nil, nil, err
+	}
+
+	// 7) Relay outbox events to the configured backend until the HTTP
+	// server shuts down
+	relay := queue.NewRelay(dbConn, publisher, queue.RelayConfig{}, zapLog)
+	relayCtx, stopRelay := context.WithCancel(ctx)
+	go relay.Run(relayCtx)
+	e.Server.RegisterOnShutdown(func() {
+		stopRelay()
+		publisher.Close()
+	})
+
+	// Events are written to the outbox; the relay above publishes them
+	svc := service.NewAccountService(dbConn).WithBalancePolicy(policy)
+
+	// Release expired holds in the background
+	expiryCtx, stopExpiry := context.WithCancel(ctx)
+	go svc.RunHoldExpiry(expiryCtx, time.Minute, zapLog)
+	e.Server.RegisterOnShutdown(stopExpiry)
+
+	// Snapshot balances hourly so point-in-time queries stay cheap
+	snapshotCtx, stopSnapshots := context.WithCancel(ctx)
+	go svc.RunBalanceSnapshots(snapshotCtx, time.Hour, zapLog)
+	e.Server.RegisterOnShutdown(stopSnapshots)
+
+	// Apply credit and debit commands from other services
+	if cfg.Cfg.Kafka.TopicCommands != "" {
+		groupID := cfg.Cfg.Kafka.CommandsGroupID
+		if groupID == "" {
+			groupID = "accounts"
+		}
+		dlqTopic := cfg.Cfg.Kafka.TopicCommandsDLQ
+		if dlqTopic == "" {
+			dlqTopic = cfg.Cfg.Kafka.TopicCommands + ".dlq"
+		}
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.Cfg.Kafka.Brokers,
+			Topic:   cfg.Cfg.Kafka.TopicCommands,
+			GroupID: groupID,
+		})
+		dlq := &kafka.Writer{
+			Addr:  kafka.TCP(cfg.Cfg.Kafka.Brokers...),
+			Topic: dlqTopic,
+		}
+		consumer := queue.NewConsumer(reader, publisher.Writer(dlq), queue.ConsumerConfig{Retry: retry}, zapLog)
+		registerCommandHandlers(consumer, svc)
+
+		consumerCtx, stopConsumer := context.WithCancel(ctx)
+		go func() {
+			if err := consumer.Run(consumerCtx); err != nil {
+				// Leave the group so other replicas take over the
+				// partitions from the last committed offset
+				zapLog.Error("command consumer stopped", zap.Error(err))
+				reader.Close()
+			}
+		}()
+		e.Server.RegisterOnShutdown(func() {
+			stopConsumer()
+			reader.Close()
+			dlq.Close()
+		})
+	}
 
-	// 7) Mount API routes, passing the live *sql.DB
-	api.RegisterRoutes(e, dbConn)
+	// 8) Mount API routes, passing the live *sql.DB
+	api.RegisterRoutes(e, dbConn, svc, authn)
 
-	// 8) Health‐check endpoint
+	// 9) Health‐check endpoint
 	e.GET("/healthz", func(c echo.Context) error {
 		zapLog.Info("health check")
 		return c.JSON(http.StatusOK, map[string]string{"status": "OK"})
@@ -0,0 +1,40 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/service"
+	"cex/pkg/apiutil"
+)
+
+// registerCommandHandlers lets other services credit and debit accounts
+// through the commands topic.
+func registerCommandHandlers(c *queue.Consumer, svc *service.AccountService) {
+	c.Handle(queue.CommandCreditFunds, fundsHandler(svc.CreditFunds))
+	c.Handle(queue.CommandDebitFunds, fundsHandler(svc.DebitFunds))
+}
+
+func fundsHandler(apply func(context.Context, service.FundsCommand) (bool, error)) queue.Handler {
+	return queue.Typed(func(ctx context.Context, id uuid.UUID, p apiutil.FundsCommand) error {
+		amount, err := decimal.NewFromString(p.Amount)
+		if err != nil {
+			return queue.Permanent(fmt.Errorf("invalid amount %q: %w", p.Amount, err))
+		}
+		applied, err := apply(ctx, service.FundsCommand{
+			CommandID: id,
+			AccountID: p.AccountID,
+			Asset:     p.Asset,
+			Amount:    amount,
+			Reason:    p.Reason,
+		})
+		if err == nil && !applied {
+			return queue.ErrDuplicate
+		}
+		return err
+	})
+}
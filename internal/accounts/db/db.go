@@ -3,13 +3,26 @@ package db
 import (
 	"context"
 	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
 
 	_ "github.com/lib/pq"
 	"github.com/pressly/goose/v3"
 )
 
-// OpenAndMigrate opens *sql.DB and runs Goose migrations under db/accounts/migration
-func OpenAndMigrate(ctx context.Context, dsn string) (*sql.DB, error) {
+// migrations holds the versioned schema compiled into the binary.
+//
+//go:embed migration/*.sql
+var migrations embed.FS
+
+// ErrSchemaBehind is returned by CheckSchema when the database has not been
+// migrated to the version this binary expects.
+var ErrSchemaBehind = errors.New("database schema is behind")
+
+// Open opens and pings the accounts database.
+func Open(ctx context.Context, dsn string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
 		return nil, err
@@ -18,8 +31,48 @@ func OpenAndMigrate(ctx context.Context, dsn string) (*sql.DB, error) {
 		db.Close()
 		return nil, err
 	}
-	goose.SetDialect("postgres")
-	if err := goose.Up(db, "internal/accounts/db/migration"); err != nil {
+	return db, nil
+}
+
+// NewMigrator returns a goose provider running the embedded migrations
+// against db.
+func NewMigrator(db *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(migrations, "migration")
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectPostgres, db, fsys)
+}
+
+// CheckSchema returns ErrSchemaBehind unless every embedded migration has
+// been applied to db.
+func CheckSchema(ctx context.Context, db *sql.DB) error {
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	current, target, err := m.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+	if current < target {
+		return fmt.Errorf("%w: at version %d, want %d (run `accounts migrate up`)", ErrSchemaBehind, current, target)
+	}
+	return nil
+}
+
+// OpenAndMigrate opens *sql.DB and applies all pending embedded migrations.
+func OpenAndMigrate(ctx context.Context, dsn string) (*sql.DB, error) {
+	db, err := Open(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := m.Up(ctx); err != nil {
 		db.Close()
 		return nil, err
 	}
@@ -0,0 +1,16 @@
+-- +goose Up
+-- balance is the single pre-asset balance; 000005 moves it to account_balances
+CREATE TABLE accounts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    owner_id UUID NOT NULL,
+    account_type VARCHAR(16) NOT NULL CHECK (account_type IN ('fiat', 'spot', 'futures')),
+    balance NUMERIC(30,10) NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Create an index on owner_id
+CREATE INDEX idx_accounts_owner_id ON accounts (owner_id);
+
+-- +goose Down
+DROP TABLE accounts;
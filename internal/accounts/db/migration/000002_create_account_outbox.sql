@@ -0,0 +1,20 @@
+-- +goose Up
+-- Transactional outbox: events are written in the same transaction as the
+-- account change and drained to Kafka by the queue relay.
+CREATE TABLE account_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    aggregate_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    published_at TIMESTAMPTZ
+);
+
+-- Pending rows are scanned in insertion order by the relay
+CREATE INDEX idx_account_outbox_pending ON account_outbox (id) WHERE published_at IS NULL;
+
+-- +goose Down
+DROP TABLE account_outbox;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Journals group the ledger entries of one balanced posting.
+CREATE TABLE journals (
+    id UUID PRIMARY KEY,
+    reason VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Ledger entries are append-only: the service never updates or deletes them.
+-- Positive amounts credit the account, negative amounts debit it, and the
+-- amounts of one journal always sum to zero. account_id has no foreign key
+-- because the external counter-account only exists in the ledger. Amounts
+-- carry the 18 decimal places assets may have: CockroachDB cannot change the
+-- type of a column later inside a migration transaction.
+CREATE TABLE ledger_entries (
+    id UUID PRIMARY KEY,
+    journal_id UUID NOT NULL REFERENCES journals (id),
+    account_id UUID NOT NULL,
+    amount NUMERIC(38,18) NOT NULL,
+    balance_after NUMERIC(38,18),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_ledger_entries_account ON ledger_entries (account_id, created_at);
+CREATE INDEX idx_ledger_entries_journal ON ledger_entries (journal_id);
+
+-- +goose Down
+DROP TABLE ledger_entries;
+DROP TABLE journals;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Idempotency keys are scoped per user. status_code stays NULL while the
+-- original request is still being processed.
+CREATE TABLE idempotency_keys (
+    owner_id UUID NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INT,
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ,
+    PRIMARY KEY (owner_id, idempotency_key)
+);
+
+-- +goose Down
+DROP TABLE idempotency_keys;
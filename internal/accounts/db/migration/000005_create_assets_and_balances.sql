@@ -0,0 +1,51 @@
+-- +goose Up
+-- Asset registry. precision is the total number of significant digits and
+-- scale the number of decimal places amounts of the asset may carry.
+CREATE TABLE assets (
+    code VARCHAR(16) PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    precision INT NOT NULL,
+    scale INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    CHECK (scale >= 0 AND scale <= 18 AND precision > scale)
+);
+
+INSERT INTO assets (code, name, precision, scale) VALUES
+    ('USD', 'US Dollar', 38, 2),
+    ('EUR', 'Euro', 38, 2),
+    ('BTC', 'Bitcoin', 38, 8),
+    ('ETH', 'Ether', 38, 18),
+    ('USDT', 'Tether USD', 38, 6);
+
+-- One balance per account and asset
+CREATE TABLE account_balances (
+    account_id UUID NOT NULL REFERENCES accounts (id),
+    asset VARCHAR(16) NOT NULL REFERENCES assets (code),
+    balance NUMERIC(38,18) NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (account_id, asset)
+);
+
+-- Existing single balances were implicitly USD
+INSERT INTO account_balances (account_id, asset, balance, updated_at)
+SELECT id, 'USD', balance, updated_at FROM accounts WHERE balance <> 0;
+
+ALTER TABLE accounts DROP COLUMN balance;
+
+ALTER TABLE ledger_entries ADD COLUMN asset VARCHAR(16) NOT NULL DEFAULT 'USD';
+-- A new name: CockroachDB keeps the name of an index dropped in this
+-- transaction in use until it commits
+CREATE INDEX idx_ledger_entries_account_asset ON ledger_entries (account_id, asset, created_at);
+DROP INDEX idx_ledger_entries_account;
+
+-- +goose Down
+CREATE INDEX idx_ledger_entries_account ON ledger_entries (account_id, created_at);
+DROP INDEX idx_ledger_entries_account_asset;
+ALTER TABLE ledger_entries DROP COLUMN asset;
+
+ALTER TABLE accounts ADD COLUMN balance NUMERIC(30,10) NOT NULL DEFAULT 0;
+UPDATE accounts a SET balance = b.balance
+FROM account_balances b WHERE b.account_id = a.id AND b.asset = 'USD';
+
+DROP TABLE account_balances;
+DROP TABLE assets;
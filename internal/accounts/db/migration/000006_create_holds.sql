@@ -0,0 +1,26 @@
+-- +goose Up
+-- locked is the part of balance reserved by active holds;
+-- available = balance - locked.
+ALTER TABLE account_balances ADD COLUMN locked NUMERIC(38,18) NOT NULL DEFAULT 0;
+ALTER TABLE account_balances ADD CONSTRAINT chk_account_balances_locked CHECK (locked >= 0);
+
+CREATE TABLE holds (
+    id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts (id),
+    asset VARCHAR(16) NOT NULL REFERENCES assets (code),
+    amount NUMERIC(38,18) NOT NULL CHECK (amount > 0),
+    captured_amount NUMERIC(38,18),
+    status VARCHAR(16) NOT NULL DEFAULT 'active',
+    reference VARCHAR(128) NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_holds_account ON holds (account_id, status);
+CREATE INDEX idx_holds_expiry ON holds (expires_at) WHERE status = 'active';
+
+-- +goose Down
+DROP TABLE holds;
+ALTER TABLE account_balances DROP CONSTRAINT chk_account_balances_locked;
+ALTER TABLE account_balances DROP COLUMN locked;
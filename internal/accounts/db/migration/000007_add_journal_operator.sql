@@ -0,0 +1,9 @@
+-- +goose Up
+-- Operator who posted a manual adjustment; NULL for journals posted by the system
+ALTER TABLE journals ADD COLUMN operator_id UUID;
+
+CREATE INDEX idx_journals_operator ON journals (operator_id, created_at) WHERE operator_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX idx_journals_operator;
+ALTER TABLE journals DROP COLUMN operator_id;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE accounts ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active'
+    CHECK (status IN ('active', 'frozen', 'closed'));
+
+-- Audit trail of every status transition
+CREATE TABLE account_status_changes (
+    id UUID PRIMARY KEY,
+    account_id UUID NOT NULL REFERENCES accounts (id),
+    from_status VARCHAR(16) NOT NULL,
+    to_status VARCHAR(16) NOT NULL,
+    reason TEXT NOT NULL,
+    actor_id UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_account_status_changes_account ON account_status_changes (account_id, created_at);
+
+-- +goose Down
+DROP TABLE account_status_changes;
+ALTER TABLE accounts DROP COLUMN status;
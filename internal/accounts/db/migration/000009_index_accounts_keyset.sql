@@ -0,0 +1,8 @@
+-- +goose Up
+-- Serves keyset pagination of ListAccounts: owner_id, then (created_at, id) descending
+CREATE INDEX idx_accounts_owner_keyset ON accounts (owner_id, created_at DESC, id DESC);
+DROP INDEX idx_accounts_owner_id;
+
+-- +goose Down
+CREATE INDEX idx_accounts_owner_id ON accounts (owner_id);
+DROP INDEX idx_accounts_owner_keyset;
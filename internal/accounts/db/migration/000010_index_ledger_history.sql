@@ -0,0 +1,6 @@
+-- +goose Up
+-- Serves keyset pagination of the balance history across all assets
+CREATE INDEX idx_ledger_entries_history ON ledger_entries (account_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX idx_ledger_entries_history;
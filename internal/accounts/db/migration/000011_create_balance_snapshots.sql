@@ -0,0 +1,14 @@
+-- +goose Up
+-- Periodic per-asset balances derived from the ledger. A snapshot holds the
+-- sum of every ledger entry created at or before taken_at, so point-in-time
+-- queries only add the entries after the latest snapshot.
+CREATE TABLE balance_snapshots (
+    account_id UUID NOT NULL REFERENCES accounts (id),
+    asset VARCHAR(16) NOT NULL REFERENCES assets (code),
+    taken_at TIMESTAMPTZ NOT NULL,
+    balance NUMERIC(38,18) NOT NULL,
+    PRIMARY KEY (account_id, asset, taken_at)
+);
+
+-- +goose Down
+DROP TABLE balance_snapshots;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- Inbound Kafka commands that were applied. Handlers insert the command in
+-- the same transaction as its effect, so a redelivered command is a no-op.
+CREATE TABLE processed_commands (
+    command_id UUID PRIMARY KEY,
+    command_type VARCHAR(64) NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL
+);
+
+-- +goose Down
+DROP TABLE processed_commands;
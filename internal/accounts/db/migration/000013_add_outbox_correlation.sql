@@ -0,0 +1,7 @@
+-- +goose Up
+-- Correlation id of the request or command that produced the event, carried
+-- into the event envelope.
+ALTER TABLE account_outbox ADD COLUMN correlation_id VARCHAR(128);
+
+-- +goose Down
+ALTER TABLE account_outbox DROP COLUMN correlation_id;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Per-account event counter. Enqueue increments it in the producing
+-- transaction, so the events of an account are numbered 1, 2, 3, ... in
+-- commit order and consumers can detect gaps.
+CREATE TABLE account_event_sequences (
+    account_id UUID PRIMARY KEY,
+    last_sequence BIGINT NOT NULL
+);
+
+ALTER TABLE account_outbox ADD COLUMN sequence BIGINT;
+
+-- +goose Down
+ALTER TABLE account_outbox DROP COLUMN sequence;
+DROP TABLE account_event_sequences;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Relays claim pending rows with a lease and publish them outside any
+-- transaction. A lease that runs out, e.g. because its relay crashed, lets
+-- another relay claim the rows again.
+ALTER TABLE account_outbox ADD COLUMN locked_by UUID;
+ALTER TABLE account_outbox ADD COLUMN locked_until TIMESTAMPTZ;
+
+-- Claims skip accounts with rows leased by another relay
+CREATE INDEX idx_account_outbox_pending_aggregate ON account_outbox (aggregate_id) WHERE published_at IS NULL;
+
+-- +goose Down
+DROP INDEX idx_account_outbox_pending_aggregate;
+ALTER TABLE account_outbox DROP COLUMN locked_until;
+ALTER TABLE account_outbox DROP COLUMN locked_by;
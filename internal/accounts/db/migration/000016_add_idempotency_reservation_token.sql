@@ -0,0 +1,8 @@
+-- +goose Up
+-- Each reservation gets a token, so a request whose reservation was taken
+-- over cannot complete or release the reservation of the request that took
+-- it. Reservations made before stay without one and run out with their lease.
+ALTER TABLE idempotency_keys ADD COLUMN reservation_token UUID;
+
+-- +goose Down
+ALTER TABLE idempotency_keys DROP COLUMN reservation_token;
@@ -20,8 +20,49 @@ var (
 		},
 		[]string{"method", "route"},
 	)
+	OutboxBacklog = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "accounts_outbox_backlog",
+			Help: "Number of account events waiting in the outbox to be published.",
+		},
+	)
+	CommandsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "accounts_commands_total",
+			Help: "Inbound Kafka commands by type and outcome (processed, duplicate, retried, dead_lettered).",
+		},
+		[]string{"type", "outcome"},
+	)
+	BreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "accounts_circuit_breaker_state",
+			Help: "State of each circuit breaker: 0 closed, 1 half-open, 2 open.",
+		},
+		[]string{"name"},
+	)
+
+	// Reconciliation job metrics, pushed by `accounts reconcile`
+	ReconcileBalancesChecked = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "accounts_reconcile_balances_checked",
+			Help: "Number of account asset balances compared by the last reconciliation.",
+		},
+	)
+	ReconcileDiscrepancies = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "accounts_reconcile_discrepancies",
+			Help: "Balances whose ledger total disagrees with a source in the last reconciliation.",
+		},
+		[]string{"source"},
+	)
+	ReconcileLastRun = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "accounts_reconcile_last_run_timestamp_seconds",
+			Help: "Unix time the last reconciliation finished.",
+		},
+	)
 )
 
 func InitMetrics() {
-	prometheus.MustRegister(RequestsTotal, RequestDuration)
+	prometheus.MustRegister(RequestsTotal, RequestDuration, OutboxBacklog, CommandsTotal, BreakerState)
 }
@@ -7,14 +7,76 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+// AccountStatus is the lifecycle state of an account.
+type AccountStatus string
+
+const (
+	// AccountActive accounts accept every balance change.
+	AccountActive AccountStatus = "active"
+	// AccountFrozen accounts accept credits but no debits or new holds.
+	AccountFrozen AccountStatus = "frozen"
+	// AccountClosed accounts accept no balance changes. Closing is final.
+	AccountClosed AccountStatus = "closed"
+)
+
+// accountTransitions lists the statuses each status may move to.
+var accountTransitions = map[AccountStatus][]AccountStatus{
+	AccountActive: {AccountFrozen, AccountClosed},
+	AccountFrozen: {AccountActive},
+}
+
+// CanTransitionTo reports whether an account may move from s to next.
+func (s AccountStatus) CanTransitionTo(next AccountStatus) bool {
+	for _, t := range accountTransitions[s] {
+		if t == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Account is a user account. Balances maps asset codes to the balance held in
+// that asset and is loaded from account_balances.
 type Account struct {
-	ID        uuid.UUID       `db:"id" json:"id"`
-	OwnerID   uuid.UUID       `db:"owner_id" json:"owner_id"`
-	Type      string          `db:"type" json:"type"`
-	Balance   decimal.Decimal `db:"balance" json:"balance"`
-	CreatedAt time.Time       `db:"created_at" json:"created_at"`
-	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+	ID        uuid.UUID          `db:"id" json:"id"`
+	OwnerID   uuid.UUID          `db:"owner_id" json:"owner_id"`
+	Type      string             `db:"type" json:"type"`
+	Status    AccountStatus      `db:"status" json:"status"`
+	Balances  map[string]Balance `db:"-" json:"balances"`
+	CreatedAt time.Time          `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `db:"updated_at" json:"updated_at"`
 }
 
 // TableName is the database table for Account.
 func (Account) TableName() string { return "accounts" }
+
+// Balance is the balance of one account in one asset. Balance is the total,
+// Locked the part reserved by active holds.
+type Balance struct {
+	AccountID uuid.UUID       `db:"account_id" json:"account_id"`
+	Asset     string          `db:"asset" json:"asset"`
+	Balance   decimal.Decimal `db:"balance" json:"balance"`
+	Locked    decimal.Decimal `db:"locked" json:"locked"`
+	UpdatedAt time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// Available is the part of the balance that can be spent or held.
+func (b Balance) Available() decimal.Decimal {
+	return b.Balance.Sub(b.Locked)
+}
+
+// TableName is the database table for Balance.
+func (Balance) TableName() string { return "account_balances" }
+
+// Asset is an entry of the asset registry.
+type Asset struct {
+	Code string `db:"code" json:"code"`
+	Name string `db:"name" json:"name"`
+	// Precision is the total number of significant digits.
+	Precision int32 `db:"precision" json:"precision"`
+	// Scale is the number of decimal places amounts may carry.
+	Scale int32 `db:"scale" json:"scale"`
+}
+
+// TableName is the database table for Asset.
+func (Asset) TableName() string { return "assets" }
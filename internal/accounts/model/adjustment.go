@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// AdjustmentReason classifies a manual balance adjustment made by an operator.
+type AdjustmentReason string
+
+const (
+	AdjustmentDeposit    AdjustmentReason = "deposit"
+	AdjustmentWithdrawal AdjustmentReason = "withdrawal"
+	AdjustmentFee        AdjustmentReason = "fee"
+	AdjustmentRebate     AdjustmentReason = "rebate"
+	AdjustmentCorrection AdjustmentReason = "correction"
+)
+
+// AdjustmentReasons lists every valid adjustment reason.
+var AdjustmentReasons = []AdjustmentReason{
+	AdjustmentDeposit, AdjustmentWithdrawal, AdjustmentFee, AdjustmentRebate, AdjustmentCorrection,
+}
+
+// Valid reports whether r is one of AdjustmentReasons.
+func (r AdjustmentReason) Valid() bool {
+	for _, v := range AdjustmentReasons {
+		if r == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Adjustment is a balance change posted against the external account by an
+// operator. Its ID is the ID of the journal that recorded it.
+type Adjustment struct {
+	ID         uuid.UUID        `json:"id"`
+	AccountID  uuid.UUID        `json:"account_id"`
+	Asset      string           `json:"asset"`
+	Amount     decimal.Decimal  `json:"amount"` // signed: positive credits the account
+	Reason     AdjustmentReason `json:"reason"`
+	OperatorID uuid.UUID        `json:"operator_id"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
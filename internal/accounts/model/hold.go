@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// HoldStatus is the lifecycle state of a hold.
+type HoldStatus string
+
+const (
+	HoldActive   HoldStatus = "active"
+	HoldCaptured HoldStatus = "captured"
+	HoldReleased HoldStatus = "released"
+	HoldExpired  HoldStatus = "expired"
+)
+
+// Hold reserves part of an asset balance, e.g. for an open order or a
+// pending withdrawal. Active holds are counted in account_balances.locked.
+type Hold struct {
+	ID             uuid.UUID           `db:"id" json:"id"`
+	AccountID      uuid.UUID           `db:"account_id" json:"account_id"`
+	Asset          string              `db:"asset" json:"asset"`
+	Amount         decimal.Decimal     `db:"amount" json:"amount"`
+	CapturedAmount decimal.NullDecimal `db:"captured_amount" json:"captured_amount,omitempty"`
+	Status         HoldStatus          `db:"status" json:"status"`
+	Reference      string              `db:"reference" json:"reference"`
+	ExpiresAt      *time.Time          `db:"expires_at" json:"expires_at,omitempty"`
+	CreatedAt      time.Time           `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time           `db:"updated_at" json:"updated_at"`
+}
+
+// TableName is the database table for Hold.
+func (Hold) TableName() string { return "holds" }
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// ExternalAccountID is the ledger-only counter-account for funds entering or
+// leaving the exchange. It has no row in accounts and no projected balance.
+var ExternalAccountID = uuid.MustParse("00000000-0000-0000-0000-000000000001")
+
+// Journal groups the ledger entries of one balanced posting.
+type Journal struct {
+	ID         uuid.UUID     `db:"id" json:"id"`
+	Reason     string        `db:"reason" json:"reason"`
+	OperatorID uuid.NullUUID `db:"operator_id" json:"operator_id"`
+	CreatedAt  time.Time     `db:"created_at" json:"created_at"`
+}
+
+// TableName is the database table for Journal.
+func (Journal) TableName() string { return "journals" }
+
+// LedgerEntry is one immutable leg of a journal. Positive amounts are
+// credits, negative amounts are debits.
+type LedgerEntry struct {
+	ID           uuid.UUID           `db:"id" json:"id"`
+	JournalID    uuid.UUID           `db:"journal_id" json:"journal_id"`
+	AccountID    uuid.UUID           `db:"account_id" json:"account_id"`
+	Asset        string              `db:"asset" json:"asset"`
+	Amount       decimal.Decimal     `db:"amount" json:"amount"`
+	BalanceAfter decimal.NullDecimal `db:"balance_after" json:"balance_after"`
+	CreatedAt    time.Time           `db:"created_at" json:"created_at"`
+}
+
+// TableName is the database table for LedgerEntry.
+func (LedgerEntry) TableName() string { return "ledger_entries" }
+
+// Transfer is a completed movement of funds between two accounts. Its ID is
+// the ID of the journal that recorded it.
+type Transfer struct {
+	ID            uuid.UUID       `json:"id"`
+	FromAccountID uuid.UUID       `json:"from_account_id"`
+	ToAccountID   uuid.UUID       `json:"to_account_id"`
+	Asset         string          `json:"asset"`
+	Amount        decimal.Decimal `json:"amount"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// BalanceChange is one ledger entry of an account seen as a change of its
+// asset balance. JournalID is the journal that caused the change and is
+// shared by the other legs of the same transfer, capture or adjustment.
+type BalanceChange struct {
+	ID         uuid.UUID       `json:"id"`
+	AccountID  uuid.UUID       `json:"account_id"`
+	Asset      string          `json:"asset"`
+	OldBalance decimal.Decimal `json:"old_balance"`
+	NewBalance decimal.Decimal `json:"new_balance"`
+	Delta      decimal.Decimal `json:"delta"`
+	Reason     string          `json:"reason"`
+	JournalID  uuid.UUID       `json:"journal_id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Statement summarises the changes of one asset balance over [From, To).
+type Statement struct {
+	AccountID      uuid.UUID       `json:"account_id"`
+	Asset          string          `json:"asset"`
+	From           time.Time       `json:"from"`
+	To             time.Time       `json:"to"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	TotalCredits   decimal.Decimal `json:"total_credits"`
+	TotalDebits    decimal.Decimal `json:"total_debits"`
+	Changes        []BalanceChange `json:"changes"`
+}
@@ -0,0 +1,246 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/metrics"
+	"cex/pkg/errors"
+	"cex/pkg/events"
+)
+
+// Inbound command types.
+const (
+	CommandCreditFunds = "accounts.credit"
+	CommandDebitFunds  = "accounts.debit"
+)
+
+// Headers added to messages routed to the dead-letter topic.
+const (
+	HeaderDLQError     = "dlq-error"
+	HeaderDLQAttempts  = "dlq-attempts"
+	HeaderDLQTopic     = "dlq-original-topic"
+	HeaderDLQPartition = "dlq-original-partition"
+	HeaderDLQOffset    = "dlq-original-offset"
+)
+
+// Command is the JSON envelope of an inbound command message.
+type Command struct {
+	// ID is chosen by the sender; handlers use it to drop redeliveries.
+	ID      uuid.UUID       `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Handler applies one command. Handlers must be idempotent by command ID:
+// the offset is committed only after Handle returns, so a crash in between
+// redelivers the command. Handlers return ErrDuplicate for commands they had
+// already applied.
+type Handler interface {
+	Handle(ctx context.Context, cmd Command) error
+}
+
+// HandlerFunc adapts a function to a Handler.
+type HandlerFunc func(ctx context.Context, cmd Command) error
+
+func (f HandlerFunc) Handle(ctx context.Context, cmd Command) error {
+	return f(ctx, cmd)
+}
+
+// Typed returns a Handler that decodes the command payload into T before
+// calling fn. Payloads that do not decode are permanent failures.
+func Typed[T any](fn func(ctx context.Context, id uuid.UUID, payload T) error) Handler {
+	return HandlerFunc(func(ctx context.Context, cmd Command) error {
+		var payload T
+		if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+			return Permanent(fmt.Errorf("decode %s payload: %w", cmd.Type, err))
+		}
+		return fn(ctx, cmd.ID, payload)
+	})
+}
+
+// ErrDuplicate reports a command that was already applied. The consumer
+// commits it like a handled command but counts it as a duplicate.
+var ErrDuplicate = errors.New("duplicate_command").Explain("command was already applied")
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not retriable: the command goes straight to the
+// dead-letter topic.
+func Permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether retrying err is pointless. Besides errors
+// marked with Permanent, this covers service errors with a 4xx status such
+// as unknown accounts or insufficient funds.
+func IsPermanent(err error) bool {
+	var p permanentError
+	if errors.As(err, &p) {
+		return true
+	}
+	var status errors.StatusCode
+	return errors.As(err, &status) && status < http.StatusInternalServerError
+}
+
+// MessageReader is the subset of *kafka.Reader the consumer uses.
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// MessageWriter is the subset of *kafka.Writer the consumer uses.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// ConsumerConfig tunes retries of failed commands.
+type ConsumerConfig struct {
+	// Retry paces retries of transient failures. They are retried until
+	// they succeed, so MaxAttempts is ignored.
+	Retry RetryPolicy
+}
+
+// Consumer reads commands of a consumer group and dispatches them to the
+// handler registered for their type. Offsets are committed manually once a
+// command was handled or dead-lettered, so delivery is at-least-once.
+type Consumer struct {
+	reader   MessageReader
+	dlq      MessageWriter
+	handlers map[string]Handler
+	cfg      ConsumerConfig
+	log      *zap.Logger
+}
+
+// NewConsumer returns a consumer reading from r and routing failed commands
+// to dlq. r must not auto-commit (a group reader with CommitInterval 0). dlq
+// should retry failed writes itself, e.g. through ResilientPublisher.Writer:
+// a write it gives up on stops the consumer.
+func NewConsumer(r MessageReader, dlq MessageWriter, cfg ConsumerConfig, log *zap.Logger) *Consumer {
+	cfg.Retry = cfg.Retry.withDefaults()
+	return &Consumer{
+		reader:   r,
+		dlq:      dlq,
+		handlers: make(map[string]Handler),
+		cfg:      cfg,
+		log:      log,
+	}
+}
+
+// Handle registers h for commands of type commandType.
+func (c *Consumer) Handle(commandType string, h Handler) {
+	c.handlers[commandType] = h
+}
+
+// Run consumes commands until ctx is cancelled, the reader fails or a
+// command cannot be dead-lettered. The offset of that command stays
+// uncommitted, so the group delivers it again.
+func (c *Consumer) Run(ctx context.Context) error {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.process(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := c.reader.CommitMessages(ctx, m); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// process handles m, retrying transient failures, and dead-letters it when
+// it fails permanently. It fails when ctx is cancelled or the dead-letter
+// write fails.
+func (c *Consumer) process(ctx context.Context, m kafka.Message) error {
+	var cmd Command
+	var err error
+	attempts, label := 1, "unknown"
+	if err = json.Unmarshal(m.Value, &cmd); err != nil {
+		err = Permanent(fmt.Errorf("decode command: %w", err))
+	} else if h, ok := c.handlers[cmd.Type]; !ok {
+		err = Permanent(fmt.Errorf("no handler for command type %q", cmd.Type))
+	} else {
+		label = cmd.Type
+		// Events the command produces are correlated with it
+		attempts, err = c.handleWithRetry(events.WithCorrelationID(ctx, cmd.ID.String()), h, cmd)
+	}
+	if err == nil {
+		metrics.CommandsTotal.WithLabelValues(label, "processed").Inc()
+		return nil
+	}
+	if errors.Is(err, ErrDuplicate) {
+		metrics.CommandsTotal.WithLabelValues(label, "duplicate").Inc()
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	c.log.Warn("dead-lettering command",
+		zap.String("type", cmd.Type), zap.Stringer("id", cmd.ID),
+		zap.Int64("offset", m.Offset), zap.Error(err))
+	return c.deadLetter(ctx, m, label, attempts, err)
+}
+
+// handleWithRetry calls h until it succeeds, fails permanently or ctx is
+// cancelled, and returns how often it was called. Transient failures, such
+// as the database being unavailable, are retried without limit: the command
+// is valid, so dead-lettering it would drop it for good.
+func (c *Consumer) handleWithRetry(ctx context.Context, h Handler, cmd Command) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := h.Handle(ctx, cmd)
+		if err == nil || errors.Is(err, ErrDuplicate) || IsPermanent(err) {
+			return attempt, err
+		}
+		metrics.CommandsTotal.WithLabelValues(cmd.Type, "retried").Inc()
+		c.log.Info("retrying command",
+			zap.String("type", cmd.Type), zap.Stringer("id", cmd.ID),
+			zap.Int("attempt", attempt), zap.Error(err))
+		if werr := c.cfg.Retry.Wait(ctx, attempt); werr != nil {
+			return attempt, err
+		}
+	}
+}
+
+// deadLetter copies m to the dead-letter topic with the failure attached.
+// The offset must not be committed when the write fails, or the command
+// would be lost.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, label string, attempts int, cause error) error {
+	headers := append([]kafka.Header{}, m.Headers...)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(cause.Error())},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+	)
+	dead := kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+
+	if err := c.dlq.WriteMessages(ctx, dead); err != nil {
+		return fmt.Errorf("dead-letter command at offset %d: %w", m.Offset, err)
+	}
+	metrics.CommandsTotal.WithLabelValues(label, "dead_lettered").Inc()
+	return nil
+}
@@ -0,0 +1,46 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"cex/pkg/events"
+)
+
+// FilePublisher appends envelopes as JSON lines (NDJSON) to a file, so the
+// service can run without a broker and its events can be inspected or
+// replayed later.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFilePublisher opens path for appending, creating it if needed.
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FilePublisher{file: f}, nil
+}
+
+// Publish writes env as one line. Each line is written with a single write
+// call, so concurrent readers never see a partial event.
+func (p *FilePublisher) Publish(ctx context.Context, env events.Envelope) error {
+	line, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err = p.file.Write(line)
+	return err
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
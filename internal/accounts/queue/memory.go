@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"sync"
+
+	"cex/pkg/events"
+)
+
+// TestingT is the part of testing.TB the assertion helpers use.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+	FailNow()
+}
+
+// MemoryPublisher keeps published envelopes in memory. It is meant for tests
+// and local runs: nothing is ever discarded.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []events.Envelope
+	// Err, when set, is returned by Publish instead of recording the event.
+	Err error
+}
+
+// NewMemoryPublisher returns an empty in-memory publisher.
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Err != nil {
+		return p.Err
+	}
+	p.events = append(p.events, env)
+	return nil
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
+
+// Events returns the published envelopes in publish order.
+func (p *MemoryPublisher) Events() []events.Envelope {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]events.Envelope(nil), p.events...)
+}
+
+// EventsOfType returns the published envelopes of one event type.
+func (p *MemoryPublisher) EventsOfType(eventType string) []events.Envelope {
+	var matched []events.Envelope
+	for _, e := range p.Events() {
+		if e.Type == eventType {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Reset forgets every published envelope.
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.events = nil
+}
+
+// AssertCount fails t unless exactly n events of eventType were published.
+func (p *MemoryPublisher) AssertCount(t TestingT, eventType string, n int) bool {
+	t.Helper()
+	if got := len(p.EventsOfType(eventType)); got != n {
+		t.Errorf("published %d %s events, want %d", got, eventType, n)
+		return false
+	}
+	return true
+}
+
+// AssertNonePublished fails t if anything was published.
+func (p *MemoryPublisher) AssertNonePublished(t TestingT) bool {
+	t.Helper()
+	if published := p.Events(); len(published) > 0 {
+		t.Errorf("published %d events, want none; first is %s", len(published), published[0].Type)
+		return false
+	}
+	return true
+}
+
+// RequirePublished decodes the payload of the last event of eventType into
+// payload and returns its envelope. It stops the test if there is none.
+func (p *MemoryPublisher) RequirePublished(t TestingT, eventType string, payload any) events.Envelope {
+	t.Helper()
+	matched := p.EventsOfType(eventType)
+	if len(matched) == 0 {
+		t.Errorf("no %s event published", eventType)
+		t.FailNow()
+	}
+	env := matched[len(matched)-1]
+	if payload != nil {
+		if err := env.DecodePayload(payload); err != nil {
+			t.Errorf("decode %s payload: %v", eventType, err)
+			t.FailNow()
+		}
+	}
+	return env
+}
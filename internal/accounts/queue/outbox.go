@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"cex/pkg/events"
+)
+
+// Outbox event types.
+const (
+	EventAccountCreated    = "account.created"
+	EventBalanceUpdated    = "balance.updated"
+	EventTransferCompleted = "transfer.completed"
+	EventAccountFrozen     = "account.frozen"
+	EventAccountUnfrozen   = "account.unfrozen"
+	EventAccountClosed     = "account.closed"
+)
+
+// eventVersions is the current payload schema version of every event type.
+// Bump a version together with a payload change old consumers cannot read.
+var eventVersions = map[string]int{
+	EventAccountCreated:    1,
+	EventBalanceUpdated:    1,
+	EventTransferCompleted: 1,
+	EventAccountFrozen:     1,
+	EventAccountUnfrozen:   1,
+	EventAccountClosed:     1,
+}
+
+// EventVersion returns the current schema version of eventType.
+func EventVersion(eventType string) int {
+	return eventVersions[eventType]
+}
+
+// OutboxMessage is a pending row of the account_outbox table.
+type OutboxMessage struct {
+	ID          int64
+	EventID     uuid.UUID
+	AggregateID uuid.UUID
+	EventType   string
+	Payload     []byte
+	Attempts    int
+	// CorrelationID is empty for events produced outside a request or command.
+	CorrelationID string
+	// Sequence numbers the events of the aggregate; 0 for rows enqueued
+	// before sequencing.
+	Sequence  uint64
+	CreatedAt time.Time
+}
+
+// Envelope wraps the message in the versioned event envelope.
+func (m OutboxMessage) Envelope() events.Envelope {
+	return events.Envelope{
+		ID:            m.EventID,
+		Type:          m.EventType,
+		Version:       EventVersion(m.EventType),
+		OccurredAt:    m.CreatedAt.UTC(),
+		CorrelationID: m.CorrelationID,
+		AggregateID:   m.AggregateID,
+		Sequence:      m.Sequence,
+		Payload:       m.Payload,
+	}
+}
+
+// Enqueue stores an event in the outbox using the caller's transaction, so the
+// event becomes visible to the relay if and only if the transaction commits.
+// The correlation id of ctx, if any, is stored with it, and the event gets
+// the next sequence number of aggregateID. Taking the number locks the
+// aggregate's counter until tx ends, so callers enqueueing events of several
+// aggregates must do so in a consistent order.
+func Enqueue(ctx context.Context, tx *sql.Tx, eventID, aggregateID uuid.UUID, eventType string, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var seq int64
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO account_event_sequences (account_id, last_sequence) VALUES ($1, 1)
+		ON CONFLICT (account_id) DO UPDATE SET last_sequence = account_event_sequences.last_sequence + 1
+		RETURNING last_sequence`, aggregateID,
+	).Scan(&seq); err != nil {
+		return err
+	}
+
+	correlationID := events.CorrelationID(ctx)
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO account_outbox (event_id, aggregate_id, event_type, payload, correlation_id, sequence)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		eventID, aggregateID, eventType, data, sql.NullString{String: correlationID, Valid: correlationID != ""}, seq,
+	)
+	return err
+}
@@ -2,95 +2,98 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"time"
 
-	"cex/internal/accounts/model"
-	"cex/pkg/apiutil"
+	"cex/pkg/events"
 
 	"github.com/segmentio/kafka-go"
-	"github.com/sony/gobreaker"
 )
 
-type Config struct {
-	Accounts struct {
-		Port string
-		DSN  string
-	}
-	Queue struct {
-		URL    string
-		Topics []string
-	}
+// EventPublisher delivers event envelopes to consumers. The outbox relay
+// publishes through it, so the backend decides whether events go to Kafka, a
+// file or memory.
+type EventPublisher interface {
+	// Publish delivers one envelope. An error leaves the event in the outbox
+	// to be retried.
+	Publish(ctx context.Context, env events.Envelope) error
+	Close() error
 }
 
-var writer *kafka.Writer // Initialize in app.go
-
-type Publisher struct {
-	writer  *kafka.Writer
-	breaker *gobreaker.CircuitBreaker
+// KafkaPublisher publishes envelopes to a Kafka topic. It makes a single
+// attempt per Publish; wrap it in a ResilientPublisher for retries and a
+// circuit breaker.
+type KafkaPublisher struct {
+	writer     *kafka.Writer
+	serializer events.Serializer
 }
 
-// NewPublisher returns a Kafka-based event publisher with circuit breaker and retry logic.
-// brokers: []string{"localhost:9092"}, topic must be non-empty.
-func NewPublisher(brokers []string, topic string) *Publisher {
-	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
-		Name:        "AccountPublisher",
-		MaxRequests: 5,
-		Interval:    60 * time.Second,
-		Timeout:     30 * time.Second,
-	})
-	return &Publisher{
+// NewKafkaPublisher returns a Kafka-based event publisher.
+// brokers: []string{"localhost:9092"}, topic must be non-empty. Envelopes are
+// encoded with s.
+func NewKafkaPublisher(brokers []string, topic string, s events.Serializer) *KafkaPublisher {
+	return &KafkaPublisher{
 		writer: &kafka.Writer{
-			Addr:     kafka.TCP(brokers...),
-			Topic:    topic,
-			Balancer: &kafka.LeastBytes{},
+			Addr:  kafka.TCP(brokers...),
+			Topic: topic,
+			// Hash keys the way the Java client does, so every producer
+			// puts an account's events on the same partition
+			Balancer: &kafka.Murmur2Balancer{},
 		},
-		breaker: cb,
+		serializer: s,
 	}
 }
 
-// PublishAccountCreated sends an AccountCreatedEvent with retry logic and circuit breaker.
-func (p *Publisher) PublishAccountCreated(ctx context.Context, e apiutil.AccountCreatedEvent) error {
-	key := e.EventID.String()
-	msgBytes, _ := json.Marshal(e)
-
-	_, err := p.breaker.Execute(func() (interface{}, error) {
-		for i, backoff := 0, time.Millisecond*100; i < 3; i, backoff = i+1, backoff*2 {
-			if err := p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: msgBytes}); err != nil {
-				time.Sleep(backoff)
-				continue
-			}
-			return nil, nil
-		}
-		return nil, fmt.Errorf("publish AccountCreatedEvent failed after retries")
-	})
-	return err
+// Publish writes an event envelope with its headers, keyed by its aggregate.
+// It is used by the outbox relay.
+func (p *KafkaPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	msg, err := events.Message(env, p.serializer)
+	if err != nil {
+		return err
+	}
+	return p.writer.WriteMessages(ctx, msg)
 }
 
-// PublishBalanceUpdated sends a BalanceUpdatedEvent.
-func (p *Publisher) PublishBalanceUpdated(ctx context.Context, e apiutil.BalanceUpdatedEvent) error {
-	key := e.EventID.String()
-	msg, _ := json.Marshal(e)
-	return p.writer.WriteMessages(ctx, kafka.Message{Key: []byte(key), Value: msg})
+// Close closes the Kafka writer.
+func (p *KafkaPublisher) Close() error {
+	return p.writer.Close()
 }
 
-// PublishAccountCreated publishes an account creation event.
-func PublishAccountCreated(ctx context.Context, acct model.Account) error {
-	msg := apiutil.Event{
-		Type:    "account.created",
-		Payload: acct,
-	}
-	return writer.WriteMessages(ctx, kafka.Message{
-		Key: []byte(acct.ID.String()),
-		Value: func() []byte {
-			data, _ := json.Marshal(msg)
-			return data
-		}(),
-	})
+// Event publisher backends.
+const (
+	BackendKafka  = "kafka"
+	BackendFile   = "file"
+	BackendMemory = "memory"
+)
+
+// PublisherConfig selects and configures an EventPublisher backend.
+type PublisherConfig struct {
+	// Backend is BackendKafka (the default when empty), BackendFile or
+	// BackendMemory, which only tests may use.
+	Backend string
+	// Brokers, Topic and Serializer configure the Kafka backend.
+	Brokers    []string
+	Topic      string
+	Serializer events.Serializer
+	// File is the NDJSON file of the file backend.
+	File string
 }
 
-// Close closes the Kafka writer.
-func (p *Publisher) Close() error {
-	return p.writer.Close()
+// NewEventPublisher returns the backend selected by cfg.
+func NewEventPublisher(cfg PublisherConfig) (EventPublisher, error) {
+	switch cfg.Backend {
+	case "", BackendKafka:
+		if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+			return nil, fmt.Errorf("kafka event backend needs brokers and a topic")
+		}
+		return NewKafkaPublisher(cfg.Brokers, cfg.Topic, cfg.Serializer), nil
+	case BackendFile:
+		if cfg.File == "" {
+			return nil, fmt.Errorf("file event backend needs a file")
+		}
+		return NewFilePublisher(cfg.File)
+	case BackendMemory:
+		return NewMemoryPublisher(), nil
+	default:
+		return nil, fmt.Errorf("unknown event backend %q", cfg.Backend)
+	}
 }
@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/metrics"
+	"cex/pkg/errors"
+)
+
+// RelayConfig tunes how the outbox relay polls the database.
+type RelayConfig struct {
+	// BatchSize is the maximum number of rows claimed per poll.
+	BatchSize int
+	// PollInterval is the delay between polls when the outbox is drained.
+	PollInterval time.Duration
+	// Lease is how long claimed rows are reserved for publishing. It must
+	// exceed the time a batch takes to publish; rows of a relay that
+	// crashed are claimed again once it runs out. 30s by default.
+	Lease time.Duration
+}
+
+// Relay drains the account_outbox table to an EventPublisher. Rows are only
+// marked as published after the publisher accepted them, so delivery is
+// at-least-once.
+//
+// Several relays may run against one database. Each claims a batch with a
+// single statement, leasing every pending row it takes, then publishes
+// without holding locks or a connection. Claims skip accounts that have rows
+// leased by another relay, so the events of an account are published by one
+// relay at a time, in order.
+type Relay struct {
+	db        *sql.DB
+	publisher EventPublisher
+	id        uuid.UUID
+	batchSize int
+	interval  time.Duration
+	lease     time.Duration
+	log       *zap.Logger
+}
+
+// NewRelay returns an outbox relay publishing through pub. Events pub gives
+// up on are tried again on the next poll. Retries pub makes inline hold up
+// the rest of the batch, so they must fit well within the lease.
+func NewRelay(db *sql.DB, pub EventPublisher, cfg RelayConfig, log *zap.Logger) *Relay {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	return &Relay{
+		db:        db,
+		publisher: pub,
+		id:        uuid.New(),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.PollInterval,
+		lease:     cfg.Lease,
+		log:       log,
+	}
+}
+
+// Run polls the outbox until ctx is cancelled.
+func (r *Relay) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			n, err := r.RelayBatch(ctx)
+			if err != nil {
+				r.log.Error("outbox relay failed", zap.Error(err))
+				break
+			}
+			if n < r.batchSize {
+				break
+			}
+		}
+		r.updateBacklog(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayBatch claims one batch of pending messages, publishes them in outbox
+// order and returns how many were published. Once a message of an account
+// fails, later messages of that account are held back so the per-account
+// order is preserved on the next attempt.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	batch, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	// Whatever is left unpublished can be claimed again right away
+	defer r.release(ctx)
+
+	published := 0
+	blocked := make(map[uuid.UUID]bool)
+	for _, m := range batch {
+		if blocked[m.AggregateID] {
+			continue
+		}
+		if pubErr := r.publisher.Publish(ctx, m.Envelope()); pubErr != nil {
+			blocked[m.AggregateID] = true
+			r.log.Warn("outbox publish failed",
+				zap.Int64("id", m.ID), zap.String("type", m.EventType), zap.Error(pubErr))
+			if _, err := r.db.ExecContext(ctx, `
+				UPDATE account_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2`,
+				pubErr.Error(), m.ID,
+			); err != nil {
+				return published, err
+			}
+			continue
+		}
+		if _, err := r.db.ExecContext(ctx, `
+			UPDATE account_outbox SET published_at = $1, locked_by = NULL, locked_until = NULL WHERE id = $2`,
+			time.Now().UTC(), m.ID,
+		); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// claim leases up to batchSize pending rows, oldest first, of accounts with
+// no rows leased by another relay, and returns them in outbox order.
+//
+// Rows another claim is taking are skipped rather than waited for. Two
+// claims taking rows of the same account at once would both pass the lease
+// check, but under serializable isolation, the only one CockroachDB offers,
+// one of them then fails to commit; it claims nothing this poll.
+func (r *Relay) claim(ctx context.Context) ([]OutboxMessage, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE account_outbox SET locked_by = $1, locked_until = now() + $2 * interval '1 millisecond'
+		WHERE id IN (
+			SELECT o.id FROM account_outbox o
+			WHERE o.published_at IS NULL AND NOT EXISTS (
+				SELECT 1 FROM account_outbox l
+				WHERE l.aggregate_id = o.aggregate_id AND l.published_at IS NULL AND l.locked_until > now()
+			)
+			ORDER BY o.id LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event_id, aggregate_id, event_type, payload, attempts, correlation_id, sequence, created_at`,
+		r.id, r.lease.Milliseconds(), r.batchSize,
+	)
+	if isSerializationFailure(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var correlationID sql.NullString
+		var seq sql.NullInt64
+		if err := rows.Scan(
+			&m.ID, &m.EventID, &m.AggregateID, &m.EventType, &m.Payload, &m.Attempts, &correlationID, &seq, &m.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		m.CorrelationID = correlationID.String
+		m.Sequence = uint64(seq.Int64)
+		batch = append(batch, m)
+	}
+	if err := rows.Err(); isSerializationFailure(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	sort.Slice(batch, func(a, b int) bool { return batch[a].ID < batch[b].ID })
+	return batch, nil
+}
+
+// isSerializationFailure reports whether err aborted a transaction that
+// conflicted with a concurrent one (SQLSTATE 40001).
+func isSerializationFailure(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "40001"
+}
+
+// release drops the leases of this relay on rows it did not publish.
+func (r *Relay) release(ctx context.Context) {
+	if _, err := r.db.ExecContext(context.WithoutCancel(ctx), `
+		UPDATE account_outbox SET locked_by = NULL, locked_until = NULL
+		WHERE locked_by = $1 AND published_at IS NULL`, r.id,
+	); err != nil {
+		r.log.Warn("outbox lease release failed", zap.Error(err))
+	}
+}
+
+func (r *Relay) updateBacklog(ctx context.Context) {
+	var n int64
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT count(*) FROM account_outbox WHERE published_at IS NULL`,
+	).Scan(&n); err != nil {
+		r.log.Warn("outbox backlog query failed", zap.Error(err))
+		return
+	}
+	metrics.OutboxBacklog.Set(float64(n))
+}
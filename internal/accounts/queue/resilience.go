@@ -0,0 +1,237 @@
+package queue
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/sony/gobreaker"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/metrics"
+	"cex/pkg/errors"
+	"cex/pkg/events"
+)
+
+// RetryPolicy describes how often and how patiently a failed call is retried.
+type RetryPolicy struct {
+	// MaxAttempts bounds the calls, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; it doubles per
+	// attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction, up to 1, of each delay that is randomized so
+	// that callers failing together do not retry in lockstep. Zero uses the
+	// default.
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used for zero fields of a RetryPolicy.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Jitter:         0.5,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultRetryPolicy.InitialBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = max(DefaultRetryPolicy.MaxBackoff, p.InitialBackoff)
+	}
+	if p.Jitter <= 0 {
+		p.Jitter = DefaultRetryPolicy.Jitter
+	}
+	p.Jitter = min(p.Jitter, 1)
+	return p
+}
+
+// Backoff returns the delay after the given failed attempt (1-based).
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.MaxBackoff)
+	if p.Jitter > 0 {
+		d -= time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// Wait sleeps for the backoff after attempt, returning early with the
+// context's error when ctx is cancelled.
+func (p RetryPolicy) Wait(ctx context.Context, attempt int) error {
+	t := time.NewTimer(p.Backoff(attempt))
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Do calls fn until it succeeds, fails with an error retryable rejects, runs
+// out of attempts or ctx is cancelled. It returns how often fn was called
+// and its last error.
+func (p RetryPolicy) Do(ctx context.Context, retryable func(error) bool, fn func(ctx context.Context) error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return attempt, err
+		}
+		if werr := p.Wait(ctx, attempt); werr != nil {
+			return attempt, err
+		}
+	}
+}
+
+// BreakerSettings configure the circuit breaker in front of a publisher.
+type BreakerSettings struct {
+	// FailureThreshold consecutive failures open the breaker.
+	FailureThreshold uint32
+	// Timeout is how long the breaker stays open before letting trial
+	// requests through (half-open).
+	Timeout time.Duration
+	// MaxRequests trial requests are let through while half-open; the
+	// breaker closes once they all succeed.
+	MaxRequests uint32
+	// Interval clears the failure counts of a closed breaker periodically.
+	Interval time.Duration
+}
+
+// DefaultBreakerSettings is used for zero fields of BreakerSettings.
+var DefaultBreakerSettings = BreakerSettings{
+	FailureThreshold: 5,
+	Timeout:          30 * time.Second,
+	MaxRequests:      1,
+	Interval:         time.Minute,
+}
+
+func (s BreakerSettings) withDefaults() BreakerSettings {
+	if s.FailureThreshold == 0 {
+		s.FailureThreshold = DefaultBreakerSettings.FailureThreshold
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = DefaultBreakerSettings.Timeout
+	}
+	if s.MaxRequests == 0 {
+		s.MaxRequests = DefaultBreakerSettings.MaxRequests
+	}
+	if s.Interval <= 0 {
+		s.Interval = DefaultBreakerSettings.Interval
+	}
+	return s
+}
+
+// ResilientPublisher wraps an EventPublisher with a retry policy and a
+// circuit breaker. Every attempt goes through the breaker; once it opens,
+// publishes fail fast without reaching the backend until it half-opens.
+type ResilientPublisher struct {
+	next    EventPublisher
+	retry   RetryPolicy
+	breaker *gobreaker.CircuitBreaker
+}
+
+// NewResilientPublisher wraps next. name labels the breaker in logs and in
+// the accounts_circuit_breaker_state metric.
+func NewResilientPublisher(name string, next EventPublisher, retry RetryPolicy, settings BreakerSettings, log *zap.Logger) *ResilientPublisher {
+	settings = settings.withDefaults()
+	threshold := settings.FailureThreshold
+	breaker := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:        name,
+		MaxRequests: settings.MaxRequests,
+		Interval:    settings.Interval,
+		Timeout:     settings.Timeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= threshold
+		},
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			metrics.BreakerState.WithLabelValues(name).Set(breakerStateValue(to))
+			log.Warn("circuit breaker state changed",
+				zap.String("breaker", name), zap.Stringer("from", from), zap.Stringer("to", to))
+		},
+	})
+	metrics.BreakerState.WithLabelValues(name).Set(breakerStateValue(gobreaker.StateClosed))
+
+	return &ResilientPublisher{
+		next:    next,
+		retry:   retry.withDefaults(),
+		breaker: breaker,
+	}
+}
+
+// Publish publishes env, retrying failures with jittered backoff. It gives
+// up early when the breaker is open or ctx is cancelled.
+func (p *ResilientPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	return p.call(ctx, func(ctx context.Context) error {
+		return p.next.Publish(ctx, env)
+	})
+}
+
+// Writer returns a MessageWriter writing through w with the retry policy and
+// breaker of p, for messages that are not event envelopes, such as
+// dead-lettered commands.
+func (p *ResilientPublisher) Writer(w MessageWriter) MessageWriter {
+	return resilientWriter{publisher: p, next: w}
+}
+
+// call runs fn through the breaker, retrying failures.
+func (p *ResilientPublisher) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := p.retry.Do(ctx, retryablePublishError, func(ctx context.Context) error {
+		_, err := p.breaker.Execute(func() (any, error) {
+			return nil, fn(ctx)
+		})
+		return err
+	})
+	return err
+}
+
+// State returns the current breaker state.
+func (p *ResilientPublisher) State() gobreaker.State {
+	return p.breaker.State()
+}
+
+func (p *ResilientPublisher) Close() error {
+	return p.next.Close()
+}
+
+type resilientWriter struct {
+	publisher *ResilientPublisher
+	next      MessageWriter
+}
+
+func (w resilientWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	return w.publisher.call(ctx, func(ctx context.Context) error {
+		return w.next.WriteMessages(ctx, msgs...)
+	})
+}
+
+// retryablePublishError rejects errors a retry cannot fix right away.
+func retryablePublishError(err error) bool {
+	return !errors.Is(err, gobreaker.ErrOpenState) &&
+		!errors.Is(err, gobreaker.ErrTooManyRequests) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// breakerStateValue maps breaker states to the metric value: 0 closed,
+// 1 half-open, 2 open.
+func breakerStateValue(s gobreaker.State) float64 {
+	switch s {
+	case gobreaker.StateHalfOpen:
+		return 1
+	case gobreaker.StateOpen:
+		return 2
+	default:
+		return 0
+	}
+}
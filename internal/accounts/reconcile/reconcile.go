@@ -0,0 +1,153 @@
+// Package reconcile compares every account balance recomputed from the
+// ledger with the account_balances projection and with the balances
+// downstream consumers derived from the published events.
+package reconcile
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/model"
+)
+
+// Sources a ledger balance is compared with.
+const (
+	SourceProjection = "projection"
+	SourceEvents     = "events"
+)
+
+// Key identifies one asset balance of an account.
+type Key struct {
+	AccountID uuid.UUID
+	Asset     string
+}
+
+// Balances maps asset balances to their amount.
+type Balances map[Key]decimal.Decimal
+
+// Discrepancy is a balance on which a source disagrees with the ledger.
+type Discrepancy struct {
+	AccountID uuid.UUID       `json:"account_id"`
+	Asset     string          `json:"asset"`
+	Source    string          `json:"source"`
+	Ledger    decimal.Decimal `json:"ledger"`
+	Actual    decimal.Decimal `json:"actual"`
+	// Missing is set when the source has no balance at all.
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Report is the outcome of one reconciliation run.
+type Report struct {
+	GeneratedAt   time.Time     `json:"generated_at"`
+	Checked       int           `json:"checked"`
+	EventsChecked bool          `json:"events_checked"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// LedgerBalances sums the ledger entries of every account and asset.
+func LedgerBalances(ctx context.Context, db *sql.DB) (Balances, error) {
+	return queryBalances(ctx, db, `
+		SELECT account_id, asset, SUM(amount) FROM ledger_entries
+		WHERE account_id <> $1 GROUP BY account_id, asset`, model.ExternalAccountID)
+}
+
+// ProjectedBalances reads the account_balances projection.
+func ProjectedBalances(ctx context.Context, db *sql.DB) (Balances, error) {
+	return queryBalances(ctx, db, `
+		SELECT account_id, asset, balance FROM account_balances`)
+}
+
+func queryBalances(ctx context.Context, db *sql.DB, query string, args ...any) (Balances, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(Balances)
+	for rows.Next() {
+		var k Key
+		var amount decimal.Decimal
+		if err := rows.Scan(&k.AccountID, &k.Asset, &amount); err != nil {
+			return nil, err
+		}
+		balances[k] = amount
+	}
+	return balances, rows.Err()
+}
+
+// Compare checks projected, and events unless it is nil, against the
+// ledger. Balances absent from a source count as zero; a missing non-zero
+// balance is reported as Missing.
+func Compare(ledger, projected, events Balances) Report {
+	keys := make(map[Key]bool)
+	for _, b := range []Balances{ledger, projected, events} {
+		for k := range b {
+			keys[k] = true
+		}
+	}
+
+	report := Report{
+		GeneratedAt:   time.Now().UTC(),
+		Checked:       len(keys),
+		EventsChecked: events != nil,
+		Discrepancies: []Discrepancy{},
+	}
+	for k := range keys {
+		want := ledger[k]
+		for _, src := range []struct {
+			name     string
+			balances Balances
+		}{{SourceProjection, projected}, {SourceEvents, events}} {
+			if src.balances == nil {
+				continue
+			}
+			got, ok := src.balances[k]
+			if got.Equal(want) {
+				continue
+			}
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				AccountID: k.AccountID,
+				Asset:     k.Asset,
+				Source:    src.name,
+				Ledger:    want,
+				Actual:    got,
+				Missing:   !ok,
+			})
+		}
+	}
+
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		a, b := report.Discrepancies[i], report.Discrepancies[j]
+		if a.AccountID != b.AccountID {
+			return a.AccountID.String() < b.AccountID.String()
+		}
+		if a.Asset != b.Asset {
+			return a.Asset < b.Asset
+		}
+		return a.Source < b.Source
+	})
+	return report
+}
+
+// Observe sets the reconciliation gauges from r.
+func (r Report) Observe() {
+	metrics.ReconcileBalancesChecked.Set(float64(r.Checked))
+	counts := map[string]int{SourceProjection: 0}
+	if r.EventsChecked {
+		counts[SourceEvents] = 0
+	}
+	for _, d := range r.Discrepancies {
+		counts[d.Source]++
+	}
+	for source, n := range counts {
+		metrics.ReconcileDiscrepancies.WithLabelValues(source).Set(float64(n))
+	}
+	metrics.ReconcileLastRun.Set(float64(r.GeneratedAt.Unix()))
+}
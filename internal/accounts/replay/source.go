@@ -0,0 +1,236 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"cex/pkg/events"
+)
+
+// Record is one event read from a source with where it was read from.
+type Record struct {
+	Envelope events.Envelope
+	// Position is "partition:offset" for Kafka and "line N" for files; it
+	// is what to resume from after a failure.
+	Position string
+}
+
+// Source yields recorded events in order. Next returns io.EOF once the
+// source is drained.
+type Source interface {
+	Next(ctx context.Context) (Record, error)
+	Close() error
+}
+
+// Start selects where a source begins. A non-zero Time wins over Offset.
+type Start struct {
+	// AfterOffset starts the source after Offset rather than at the
+	// beginning.
+	AfterOffset bool
+	// Offset is the last Kafka offset of every partition, or the last file
+	// line (counted from 1), not to read. Either way the source resumes
+	// after the Position of that record.
+	Offset int64
+	// Time skips events that occurred before it.
+	Time time.Time
+}
+
+// PartitionStart returns the offset to read a partition from, given the
+// first offset the partition retains. Time is not taken into account.
+func (s Start) PartitionStart(first int64) int64 {
+	if !s.AfterOffset {
+		return first
+	}
+	return max(first, s.Offset+1)
+}
+
+// KafkaSource reads every partition of a topic, one after the other, up to
+// the end offsets seen when it was opened. Events of one account share a
+// partition, so they are read in order; events of different accounts are
+// not ordered.
+type KafkaSource struct {
+	brokers    []string
+	topic      string
+	partitions []partitionRange
+	current    int
+	reader     *kafka.Reader
+}
+
+// partitionRange is the offsets [start, end) of a partition to read.
+type partitionRange struct {
+	id         int
+	start, end int64
+}
+
+// NewKafkaSource looks up the partitions of topic and where to start
+// reading each of them.
+func NewKafkaSource(ctx context.Context, brokers []string, topic string, from Start) (*KafkaSource, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, fmt.Errorf("kafka brokers and topic are required")
+	}
+
+	conn, err := kafka.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &KafkaSource{brokers: brokers, topic: topic}
+	for _, p := range partitions {
+		r, err := partitionOffsets(ctx, brokers[0], topic, p.ID, from)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.ID, err)
+		}
+		if r.start < r.end {
+			s.partitions = append(s.partitions, r)
+		}
+	}
+	return s, nil
+}
+
+func partitionOffsets(ctx context.Context, broker, topic string, partition int, from Start) (partitionRange, error) {
+	leader, err := kafka.DialLeader(ctx, "tcp", broker, topic, partition)
+	if err != nil {
+		return partitionRange{}, err
+	}
+	defer leader.Close()
+
+	first, last, err := leader.ReadOffsets()
+	if err != nil {
+		return partitionRange{}, err
+	}
+	start := from.PartitionStart(first)
+	if !from.Time.IsZero() {
+		// The first offset whose broker timestamp is at or after from.Time
+		if start, err = leader.ReadOffset(from.Time); err != nil {
+			return partitionRange{}, err
+		}
+		if start < 0 {
+			// Nothing was written since
+			start = last
+		}
+	}
+	return partitionRange{id: partition, start: start, end: last}, nil
+}
+
+func (s *KafkaSource) Next(ctx context.Context) (Record, error) {
+	for s.current < len(s.partitions) {
+		p := s.partitions[s.current]
+		if s.reader == nil {
+			s.reader = kafka.NewReader(kafka.ReaderConfig{
+				Brokers:   s.brokers,
+				Topic:     s.topic,
+				Partition: p.id,
+			})
+			if err := s.reader.SetOffset(p.start); err != nil {
+				return Record{}, err
+			}
+		}
+
+		m, err := s.reader.ReadMessage(ctx)
+		if err != nil {
+			return Record{}, err
+		}
+		if m.Offset >= p.end-1 {
+			s.reader.Close()
+			s.reader = nil
+			s.current++
+		}
+		if m.Offset >= p.end {
+			continue
+		}
+
+		pos := fmt.Sprintf("%d:%d", m.Partition, m.Offset)
+		env, err := events.FromMessage(m)
+		if err != nil {
+			return Record{Position: pos}, fmt.Errorf("%s: %w", pos, err)
+		}
+		return Record{Envelope: env, Position: pos}, nil
+	}
+	return Record{}, io.EOF
+}
+
+func (s *KafkaSource) Close() error {
+	if s.reader != nil {
+		return s.reader.Close()
+	}
+	return nil
+}
+
+// FileSource reads envelopes written by the file event backend, one JSON
+// object per line.
+type FileSource struct {
+	file    *os.File
+	scanner *bufio.Scanner
+	from    Start
+	line    int64
+}
+
+// maxLine bounds the size of one event line.
+const maxLine = 4 << 20
+
+// NewFileSource opens path for reading.
+func NewFileSource(path string, from Start) (*FileSource, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	s := NewReaderSource(f, from)
+	s.file = f
+	return s, nil
+}
+
+// NewReaderSource reads envelopes from r, which is not closed.
+func NewReaderSource(r io.Reader, from Start) *FileSource {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), maxLine)
+	return &FileSource{scanner: sc, from: from}
+}
+
+func (s *FileSource) Next(ctx context.Context) (Record, error) {
+	for s.scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return Record{}, err
+		}
+		s.line++
+		if s.from.AfterOffset && s.line <= s.from.Offset && s.from.Time.IsZero() {
+			continue
+		}
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		pos := fmt.Sprintf("line %d", s.line)
+		var env events.Envelope
+		if err := json.Unmarshal(line, &env); err != nil {
+			return Record{Position: pos}, fmt.Errorf("%s: %w", pos, err)
+		}
+		if !s.from.Time.IsZero() && env.OccurredAt.Before(s.from.Time) {
+			continue
+		}
+		return Record{Envelope: env, Position: pos}, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (s *FileSource) Close() error {
+	if s.file != nil {
+		return s.file.Close()
+	}
+	return nil
+}
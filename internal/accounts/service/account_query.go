@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+
+	"cex/internal/accounts/model"
+)
+
+// AccountSort orders ListAccounts results. A leading '-' sorts descending.
+type AccountSort string
+
+const (
+	SortCreatedDesc AccountSort = "-created_at"
+	SortCreatedAsc  AccountSort = "created_at"
+	SortBalanceDesc AccountSort = "-balance"
+	SortBalanceAsc  AccountSort = "balance"
+)
+
+// sortKeys maps each sort to the column it orders by. Only these identifiers
+// are ever written into the SQL text.
+var sortKeys = map[AccountSort]struct {
+	column string
+	desc   bool
+}{
+	SortCreatedDesc: {"a.created_at", true},
+	SortCreatedAsc:  {"a.created_at", false},
+	SortBalanceDesc: {"b.balance", true},
+	SortBalanceAsc:  {"b.balance", false},
+}
+
+// AccountQuery selects a page of an owner's accounts. Zero fields do not
+// filter. Balance filters and the balance sorts apply to the balance in
+// Asset, which is then required; setting Asset alone lists the accounts that
+// hold a balance row in that asset.
+type AccountQuery struct {
+	OwnerID     uuid.UUID
+	Types       []string
+	Statuses    []model.AccountStatus
+	Asset       string
+	MinBalance  *decimal.Decimal
+	MaxBalance  *decimal.Decimal
+	CreatedFrom time.Time // inclusive
+	CreatedTo   time.Time // exclusive
+	Sort        AccountSort
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor string
+	// Size is clamped to MaxPageSize and defaults to DefaultPageSize.
+	Size int
+}
+
+// AccountPage is one page of ListAccounts. NextCursor is empty on the last
+// page.
+type AccountPage struct {
+	Accounts   []model.Account
+	NextCursor string
+}
+
+func (q *AccountQuery) validate() error {
+	if q.Sort == "" {
+		q.Sort = SortCreatedDesc
+	}
+	if _, ok := sortKeys[q.Sort]; !ok {
+		return ErrInvalidFilter.Explain("unknown sort %q", q.Sort)
+	}
+	for _, t := range q.Types {
+		switch t {
+		case "fiat", "spot", "futures":
+		default:
+			return ErrInvalidFilter.Explain("unknown account type %q", t)
+		}
+	}
+	for _, st := range q.Statuses {
+		switch st {
+		case model.AccountActive, model.AccountFrozen, model.AccountClosed:
+		default:
+			return ErrInvalidFilter.Explain("unknown account status %q", st)
+		}
+	}
+	byBalance := q.MinBalance != nil || q.MaxBalance != nil || sortKeys[q.Sort].column == "b.balance"
+	if byBalance && q.Asset == "" {
+		return ErrInvalidFilter.Explain("balance filters and sorts require an asset")
+	}
+	if q.MinBalance != nil && q.MaxBalance != nil && q.MinBalance.GreaterThan(*q.MaxBalance) {
+		return ErrInvalidFilter.Explain("min_balance exceeds max_balance")
+	}
+	if !q.CreatedFrom.IsZero() && !q.CreatedTo.IsZero() && !q.CreatedFrom.Before(q.CreatedTo) {
+		return ErrInvalidFilter.Explain("created_from must be before created_to")
+	}
+	return nil
+}
+
+// ListAccounts returns one page of accounts matching q.
+func (s *AccountService) ListAccounts(ctx context.Context, q AccountQuery) (AccountPage, error) {
+	if err := q.validate(); err != nil {
+		return AccountPage{}, err
+	}
+	after, err := DecodeCursor(q.Cursor)
+	if err != nil {
+		return AccountPage{}, err
+	}
+	if !after.IsZero() && after.Sort != q.Sort {
+		return AccountPage{}, ErrInvalidCursor.Explain("cursor belongs to a different sort")
+	}
+	size := pageSize(q.Size)
+
+	query, args, err := buildAccountQuery(q, after, size+1) // one extra row tells whether another page follows
+	if err != nil {
+		return AccountPage{}, err
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return AccountPage{}, err
+	}
+	defer rows.Close()
+
+	var accounts []model.Account
+	var balances []decimal.Decimal
+	for rows.Next() {
+		var account model.Account
+		dest := []any{
+			&account.ID,
+			&account.OwnerID,
+			&account.Type,
+			&account.Status,
+			&account.CreatedAt,
+			&account.UpdatedAt,
+		}
+		var balance decimal.Decimal
+		if q.Asset != "" {
+			dest = append(dest, &balance)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return AccountPage{}, err
+		}
+		accounts = append(accounts, account)
+		balances = append(balances, balance)
+	}
+	if err := rows.Err(); err != nil {
+		return AccountPage{}, err
+	}
+
+	var page AccountPage
+	if len(accounts) > size {
+		accounts = accounts[:size]
+		last := accounts[size-1]
+		next := Cursor{Sort: q.Sort, CreatedAt: last.CreatedAt, ID: last.ID}
+		if sortKeys[q.Sort].column == "b.balance" {
+			next.Balance = &balances[size-1]
+		}
+		page.NextCursor = next.Encode()
+	}
+	if err := s.loadBalances(ctx, accounts); err != nil {
+		return AccountPage{}, err
+	}
+	page.Accounts = accounts
+	return page, nil
+}
+
+// buildAccountQuery returns the statement selecting up to limit accounts of
+// q after the keyset position after.
+func buildAccountQuery(q AccountQuery, after Cursor, limit int) (string, []any, error) {
+	var b queryBuilder
+	key := sortKeys[q.Sort]
+
+	sel := "SELECT a.id, a.owner_id, a.account_type, a.status, a.created_at, a.updated_at"
+	from := "FROM accounts a"
+	if q.Asset != "" {
+		sel += ", b.balance"
+		from += " JOIN account_balances b ON b.account_id = a.id AND b.asset = " + b.arg(q.Asset)
+	}
+
+	b.where("a.owner_id = " + b.arg(q.OwnerID))
+	if len(q.Types) > 0 {
+		b.where("a.account_type = ANY(" + b.arg(pq.Array(q.Types)) + ")")
+	}
+	if len(q.Statuses) > 0 {
+		statuses := make([]string, len(q.Statuses))
+		for i, st := range q.Statuses {
+			statuses[i] = string(st)
+		}
+		b.where("a.status = ANY(" + b.arg(pq.Array(statuses)) + ")")
+	}
+	if q.MinBalance != nil {
+		b.where("b.balance >= " + b.arg(*q.MinBalance))
+	}
+	if q.MaxBalance != nil {
+		b.where("b.balance <= " + b.arg(*q.MaxBalance))
+	}
+	if !q.CreatedFrom.IsZero() {
+		b.where("a.created_at >= " + b.arg(q.CreatedFrom))
+	}
+	if !q.CreatedTo.IsZero() {
+		b.where("a.created_at < " + b.arg(q.CreatedTo))
+	}
+
+	// Ties on the sort key are broken by (created_at, id) in the same direction
+	op, dir := ">", "ASC"
+	if key.desc {
+		op, dir = "<", "DESC"
+	}
+	if !after.IsZero() {
+		if key.column == "b.balance" {
+			if after.Balance == nil {
+				return "", nil, ErrInvalidCursor
+			}
+			b.where("(b.balance, a.created_at, a.id) " + op + " (" +
+				b.arg(*after.Balance) + ", " + b.arg(after.CreatedAt) + ", " + b.arg(after.ID) + ")")
+		} else {
+			b.where("(a.created_at, a.id) " + op + " (" + b.arg(after.CreatedAt) + ", " + b.arg(after.ID) + ")")
+		}
+	}
+
+	order := "a.created_at " + dir + ", a.id " + dir
+	if key.column != "a.created_at" {
+		order = key.column + " " + dir + ", " + order
+	}
+
+	query := sel + " " + from + b.whereClause() +
+		" ORDER BY " + order +
+		" LIMIT " + b.arg(limit)
+	return query, b.args, nil
+}
@@ -12,16 +12,27 @@ import (
 	"cex/internal/accounts/queue"
 	"cex/pkg/apiutil"
 
+	"github.com/lib/pq"
 	"go.opentelemetry.io/otel"
 )
 
+// AccountService owns the accounts table. Events are written to the
+// transactional outbox and published by queue.Relay.
 type AccountService struct {
-	db        *sql.DB
-	publisher *queue.Publisher
+	db     *sql.DB
+	policy BalancePolicy
 }
 
-func NewAccountService(db *sql.DB, pub *queue.Publisher) *AccountService {
-	return &AccountService{db: db, publisher: pub}
+// NewAccountService returns a service enforcing non-negative balances for
+// every account type; see WithBalancePolicy.
+func NewAccountService(db *sql.DB) *AccountService {
+	return &AccountService{db: db, policy: BalancePolicy{}}
+}
+
+// WithBalancePolicy sets the overdraft policy applied to debits.
+func (s *AccountService) WithBalancePolicy(p BalancePolicy) *AccountService {
+	s.policy = p
+	return s
 }
 
 func (s *AccountService) CreateAccount(ctx context.Context, ownerID uuid.UUID, accountType string) (model.Account, error) {
@@ -37,14 +48,16 @@ func (s *AccountService) CreateAccount(ctx context.Context, ownerID uuid.UUID, a
 	var account model.Account
 	account.ID = uuid.New()
 	account.OwnerID = ownerID
-	account.Balance = decimal.Zero
+	account.Type = accountType
+	account.Status = model.AccountActive
+	account.Balances = map[string]model.Balance{}
 	account.CreatedAt = time.Now().UTC()
 	account.UpdatedAt = account.CreatedAt
 
 	_, err = tx.ExecContext(ctx, `
-		INSERT INTO accounts (id, owner_id, balance, account_type, created_at, updated_at)
+		INSERT INTO accounts (id, owner_id, account_type, status, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6)`,
-		account.ID, account.OwnerID, account.Balance, accountType, account.CreatedAt, account.UpdatedAt,
+		account.ID, account.OwnerID, accountType, account.Status, account.CreatedAt, account.UpdatedAt,
 	)
 	if err != nil {
 		tx.Rollback()
@@ -58,102 +71,94 @@ func (s *AccountService) CreateAccount(ctx context.Context, ownerID uuid.UUID, a
 		AccountType: accountType,
 		Timestamp:   time.Now().UTC(),
 	}
-	_ = s.publisher.PublishAccountCreated(ctx, ev)
+	if err := queue.Enqueue(ctx, tx, ev.EventID, account.ID, queue.EventAccountCreated, ev); err != nil {
+		tx.Rollback()
+		return model.Account{}, err
+	}
 
-	return account, tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return model.Account{}, err
+	}
+	return account, nil
 }
 
 func (s *AccountService) GetAccount(ctx context.Context, id uuid.UUID) (model.Account, error) {
 	var account model.Account
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, owner_id, balance, account_type, created_at, updated_at 
+		SELECT id, owner_id, account_type, status, created_at, updated_at
 		FROM accounts WHERE id = $1`, id,
 	).Scan(
 		&account.ID,
 		&account.OwnerID,
-		&account.Balance,
 		&account.Type,
+		&account.Status,
 		&account.CreatedAt,
 		&account.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return model.Account{}, err
+		return model.Account{}, ErrAccountNotFound
 	}
 	if err != nil {
 		return model.Account{}, err
 	}
-	return account, nil
+
+	accounts := []model.Account{account}
+	if err := s.loadBalances(ctx, accounts); err != nil {
+		return model.Account{}, err
+	}
+	return accounts[0], nil
 }
 
-func (s *AccountService) ListAccounts(ctx context.Context, ownerID uuid.UUID, offset, limit int) ([]model.Account, error) {
+// loadBalances fills the Balances map of each account with one query.
+func (s *AccountService) loadBalances(ctx context.Context, accounts []model.Account) error {
+	if len(accounts) == 0 {
+		return nil
+	}
+	ids := make([]string, len(accounts))
+	index := make(map[uuid.UUID]int, len(accounts))
+	for i := range accounts {
+		accounts[i].Balances = map[string]model.Balance{}
+		ids[i] = accounts[i].ID.String()
+		index[accounts[i].ID] = i
+	}
+
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, owner_id, balance, account_type, created_at, updated_at 
-		FROM accounts WHERE owner_id = $1 
-		ORDER BY created_at DESC OFFSET $2 LIMIT $3`,
-		ownerID, offset, limit,
+		SELECT account_id, asset, balance, locked, updated_at FROM account_balances
+		WHERE account_id = ANY($1)`, pq.Array(ids),
 	)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
-	var accounts []model.Account
 	for rows.Next() {
-		var account model.Account
-		if err := rows.Scan(
-			&account.ID,
-			&account.OwnerID,
-			&account.Balance,
-			&account.Type,
-			&account.CreatedAt,
-			&account.UpdatedAt,
-		); err != nil {
-			return nil, err
+		var b model.Balance
+		if err := rows.Scan(&b.AccountID, &b.Asset, &b.Balance, &b.Locked, &b.UpdatedAt); err != nil {
+			return err
+		}
+		if i, ok := index[b.AccountID]; ok {
+			accounts[i].Balances[b.Asset] = b
 		}
-		accounts = append(accounts, account)
 	}
-	return accounts, nil
+	return rows.Err()
 }
 
-func (s *AccountService) UpdateBalance(ctx context.Context, id uuid.UUID, delta decimal.Decimal) error {
+// UpdateBalance credits (positive delta) or debits (negative delta) the asset
+// balance of an account by posting a journal against the external
+// counter-account.
+func (s *AccountService) UpdateBalance(ctx context.Context, id uuid.UUID, asset string, delta decimal.Decimal) error {
 	tracer := otel.Tracer("accounts-service")
 	ctx, span := tracer.Start(ctx, "AccountService.UpdateBalance")
 	defer span.End()
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		return err
-	}
-
-	var oldBalance decimal.Decimal
-	err = tx.QueryRowContext(ctx, `
-		SELECT balance FROM accounts WHERE id = $1 FOR UPDATE`, id,
-	).Scan(&oldBalance)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	newBalance := oldBalance.Add(delta)
-	_, err = tx.ExecContext(ctx, `
-		UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3`,
-		newBalance, time.Now().UTC(), id,
-	)
-	if err != nil {
-		tx.Rollback()
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, _, err := s.postJournal(ctx, tx, Journal{
+			Reason: "manual-update",
+			Postings: []Posting{
+				{AccountID: id, Asset: asset, Amount: delta},
+				{AccountID: model.ExternalAccountID, Asset: asset, Amount: delta.Neg()},
+			},
+		})
 		return err
-	}
-
-	ev := apiutil.BalanceUpdatedEvent{
-		EventID:    uuid.New(),
-		AccountID:  id,
-		OldBalance: oldBalance.String(),
-		NewBalance: newBalance.String(),
-		Delta:      delta.String(),
-		Reason:     "manual-update",
-		Timestamp:  time.Now().UTC(),
-	}
-	_ = s.publisher.PublishBalanceUpdated(ctx, ev)
-
-	return tx.Commit()
+	})
 }
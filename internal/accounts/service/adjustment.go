@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+)
+
+// AdjustmentRequest describes a manual balance adjustment.
+type AdjustmentRequest struct {
+	AccountID uuid.UUID
+	Asset     string
+	// Amount is positive for deposits and rebates, negative for withdrawals
+	// and fees, and either sign for corrections.
+	Amount     decimal.Decimal
+	Reason     model.AdjustmentReason
+	OperatorID uuid.UUID
+}
+
+// AdjustBalance posts an operator adjustment against the external account.
+// The reason code becomes the journal reason and, together with the operator,
+// is carried by the resulting BalanceUpdatedEvent.
+func (s *AccountService) AdjustBalance(ctx context.Context, req AdjustmentRequest) (model.Adjustment, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.AdjustBalance")
+	defer span.End()
+
+	if err := req.validate(); err != nil {
+		return model.Adjustment{}, err
+	}
+
+	adj := model.Adjustment{
+		AccountID:  req.AccountID,
+		Asset:      req.Asset,
+		Amount:     req.Amount,
+		Reason:     req.Reason,
+		OperatorID: req.OperatorID,
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		journalID, postedAt, err := s.postJournal(ctx, tx, Journal{
+			Reason: string(req.Reason),
+			Postings: []Posting{
+				{AccountID: req.AccountID, Asset: req.Asset, Amount: req.Amount},
+				{AccountID: model.ExternalAccountID, Asset: req.Asset, Amount: req.Amount.Neg()},
+			},
+			OperatorID: req.OperatorID,
+		})
+		adj.ID, adj.CreatedAt = journalID, postedAt
+		return err
+	})
+	if err != nil {
+		return model.Adjustment{}, err
+	}
+	return adj, nil
+}
+
+func (req AdjustmentRequest) validate() error {
+	if !req.Reason.Valid() {
+		return ErrInvalidAdjustment.Explain("unknown reason %q", req.Reason)
+	}
+	if req.OperatorID == uuid.Nil {
+		return ErrInvalidAdjustment.Explain("operator is required")
+	}
+	if req.AccountID == model.ExternalAccountID {
+		return ErrInvalidAdjustment.Explain("cannot adjust the external account")
+	}
+	if req.Amount.IsZero() {
+		return ErrInvalidAdjustment.Explain("amount must not be zero")
+	}
+	switch req.Reason {
+	case model.AdjustmentDeposit, model.AdjustmentRebate:
+		if req.Amount.IsNegative() {
+			return ErrInvalidAdjustment.Explain("%s must credit the account", req.Reason)
+		}
+	case model.AdjustmentWithdrawal, model.AdjustmentFee:
+		if req.Amount.IsPositive() {
+			return ErrInvalidAdjustment.Explain("%s must debit the account", req.Reason)
+		}
+	}
+	return nil
+}
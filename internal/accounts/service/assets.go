@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"cex/internal/accounts/model"
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ListAssets returns the asset registry ordered by code.
+func (s *AccountService) ListAssets(ctx context.Context) ([]model.Asset, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT code, name, precision, scale FROM assets ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var assets []model.Asset
+	for rows.Next() {
+		var a model.Asset
+		if err := rows.Scan(&a.Code, &a.Name, &a.Precision, &a.Scale); err != nil {
+			return nil, err
+		}
+		assets = append(assets, a)
+	}
+	return assets, rows.Err()
+}
+
+// getAsset looks up one asset of the registry.
+func getAsset(ctx context.Context, q queryer, code string) (model.Asset, error) {
+	var a model.Asset
+	err := q.QueryRowContext(ctx, `
+		SELECT code, name, precision, scale FROM assets WHERE code = $1`, code,
+	).Scan(&a.Code, &a.Name, &a.Precision, &a.Scale)
+	if err == sql.ErrNoRows {
+		return model.Asset{}, ErrUnknownAsset.Explain("unknown asset %q", code)
+	}
+	return a, err
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+)
+
+// FundsCommand asks accounts to credit or debit an account on behalf of
+// another service, e.g. trade settlement from matching or a confirmed
+// deposit from wallets.
+type FundsCommand struct {
+	// CommandID is chosen by the sender and deduplicates redeliveries.
+	CommandID uuid.UUID
+	AccountID uuid.UUID
+	Asset     string
+	// Amount is always positive; the command type gives the direction.
+	Amount decimal.Decimal
+	// Reason becomes the journal reason, e.g. "trade-settlement".
+	Reason string
+}
+
+// CreditFunds credits an account against the external account. It returns
+// applied == false when the command was already processed.
+func (s *AccountService) CreditFunds(ctx context.Context, cmd FundsCommand) (applied bool, err error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.CreditFunds")
+	defer span.End()
+
+	return s.applyFunds(ctx, "credit", cmd, cmd.Amount)
+}
+
+// DebitFunds debits an account against the external account, subject to the
+// same status and balance checks as any other debit. It returns
+// applied == false when the command was already processed.
+func (s *AccountService) DebitFunds(ctx context.Context, cmd FundsCommand) (applied bool, err error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.DebitFunds")
+	defer span.End()
+
+	return s.applyFunds(ctx, "debit", cmd, cmd.Amount.Neg())
+}
+
+func (s *AccountService) applyFunds(ctx context.Context, kind string, cmd FundsCommand, amount decimal.Decimal) (bool, error) {
+	if err := cmd.validate(); err != nil {
+		return false, err
+	}
+
+	applied := false
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO processed_commands (command_id, command_type, processed_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (command_id) DO NOTHING`,
+			cmd.CommandID, kind, time.Now().UTC(),
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		if _, _, err := s.postJournal(ctx, tx, Journal{
+			Reason: cmd.Reason,
+			Postings: []Posting{
+				{AccountID: cmd.AccountID, Asset: cmd.Asset, Amount: amount},
+				{AccountID: model.ExternalAccountID, Asset: cmd.Asset, Amount: amount.Neg()},
+			},
+		}); err != nil {
+			return err
+		}
+		applied = true
+		return nil
+	})
+	return applied, err
+}
+
+func (cmd FundsCommand) validate() error {
+	if cmd.CommandID == uuid.Nil {
+		return ErrInvalidFundsCommand.Explain("command id is required")
+	}
+	if cmd.AccountID == model.ExternalAccountID {
+		return ErrInvalidFundsCommand.Explain("cannot move funds of the external account")
+	}
+	if cmd.Reason == "" {
+		return ErrInvalidFundsCommand.Explain("reason is required")
+	}
+	if !cmd.Amount.IsPositive() {
+		return ErrInvalidFundsCommand.Explain("amount must be positive")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import "cex/pkg/errors"
+
+var (
+	// ErrAccountNotFound is returned when a referenced account does not exist.
+	ErrAccountNotFound = errors.NotFound.Reason("AccountNotFound").Explain("account not found")
+	// ErrAccountFrozen is returned when debiting or holding funds of a frozen account.
+	ErrAccountFrozen = errors.Conflict.Reason("AccountFrozen").Explain("account is frozen")
+	// ErrAccountClosed is returned when changing the balance of a closed account.
+	ErrAccountClosed = errors.Conflict.Reason("AccountClosed").Explain("account is closed")
+	// ErrInvalidStatusTransition is returned for status changes the account lifecycle does not allow.
+	ErrInvalidStatusTransition = errors.Conflict.Reason("InvalidStatusTransition")
+	// ErrInvalidStatusChange is returned for malformed status change requests.
+	ErrInvalidStatusChange = errors.Invalid.Reason("InvalidStatusChange")
+	// ErrAccountNotEmpty is returned when closing an account that still holds funds.
+	ErrAccountNotEmpty = errors.Conflict.Reason("AccountNotEmpty").Explain("account balances must be zero to close it")
+	// ErrInvalidCursor is returned for page tokens that were not issued by the service.
+	ErrInvalidCursor = errors.Invalid.Reason("InvalidCursor").Explain("invalid cursor")
+	// ErrInvalidFilter is returned for account list filters or sorts that cannot be applied.
+	ErrInvalidFilter = errors.Invalid.Reason("InvalidFilter")
+	// ErrUnknownAsset is returned for asset codes missing from the registry.
+	ErrUnknownAsset = errors.Invalid.Reason("UnknownAsset")
+	// ErrInvalidJournal is returned for journals that cannot be posted.
+	ErrInvalidJournal = errors.Invalid.Reason("InvalidJournal")
+	// ErrInvalidTransfer is returned for transfers that cannot be executed.
+	ErrInvalidTransfer = errors.Invalid.Reason("InvalidTransfer")
+	// ErrInsufficientFunds is returned when the available balance does not cover an amount.
+	ErrInsufficientFunds = errors.Conflict.Reason("InsufficientFunds").Explain("insufficient available funds")
+	// ErrInvalidAdjustment is returned for balance adjustments that cannot be posted.
+	ErrInvalidAdjustment = errors.Invalid.Reason("InvalidAdjustment")
+	// ErrInvalidFundsCommand is returned for credit or debit commands that cannot be applied.
+	ErrInvalidFundsCommand = errors.Invalid.Reason("InvalidFundsCommand")
+	// ErrInvalidHold is returned for hold requests that cannot be executed.
+	ErrInvalidHold = errors.Invalid.Reason("InvalidHold")
+	// ErrHoldNotFound is returned when a referenced hold does not exist.
+	ErrHoldNotFound = errors.NotFound.Reason("HoldNotFound").Explain("hold not found")
+	// ErrHoldNotActive is returned when capturing or releasing a hold that is no longer active.
+	ErrHoldNotActive = errors.Conflict.Reason("HoldNotActive").Explain("hold is no longer active")
+	// ErrIdempotencyKeyReused is returned when a key is replayed with a different payload.
+	ErrIdempotencyKeyReused = errors.Unprocessable.Reason("IdempotencyKeyReused").Explain("idempotency key was already used with a different request")
+	// ErrIdempotencyKeyInProgress is returned while the original request is still running.
+	ErrIdempotencyKeyInProgress = errors.Conflict.Reason("IdempotencyKeyInProgress").Explain("a request with this idempotency key is still in progress")
+)
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+)
+
+// MaxStatementPeriod bounds the period of a single statement.
+const MaxStatementPeriod = 366 * 24 * time.Hour
+
+// HistoryQuery selects a page of the balance changes of an account, newest
+// first. Zero Asset, From and To do not filter.
+type HistoryQuery struct {
+	AccountID uuid.UUID
+	Asset     string
+	From      time.Time // inclusive
+	To        time.Time // exclusive
+	// Cursor is the NextCursor of the previous page, empty for the first.
+	Cursor string
+	// Size is clamped to MaxPageSize and defaults to DefaultPageSize.
+	Size int
+}
+
+// HistoryPage is one page of BalanceHistory. NextCursor is empty on the last
+// page.
+type HistoryPage struct {
+	Changes    []model.BalanceChange
+	NextCursor string
+}
+
+// BalanceHistory returns the ledger entries of an account as balance changes.
+func (s *AccountService) BalanceHistory(ctx context.Context, q HistoryQuery) (HistoryPage, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.BalanceHistory")
+	defer span.End()
+
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return HistoryPage{}, ErrInvalidFilter.Explain("from must be before to")
+	}
+	after, err := DecodeCursor(q.Cursor)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	size := pageSize(q.Size)
+
+	var b queryBuilder
+	b.where("l.account_id = " + b.arg(q.AccountID))
+	if q.Asset != "" {
+		b.where("l.asset = " + b.arg(q.Asset))
+	}
+	if !q.From.IsZero() {
+		b.where("l.created_at >= " + b.arg(q.From))
+	}
+	if !q.To.IsZero() {
+		b.where("l.created_at < " + b.arg(q.To))
+	}
+	if !after.IsZero() {
+		b.where("(l.created_at, l.id) < (" + b.arg(after.CreatedAt) + ", " + b.arg(after.ID) + ")")
+	}
+	// One extra row tells whether another page follows
+	rows, err := s.db.QueryContext(ctx, balanceChangeSelect+b.whereClause()+
+		" ORDER BY l.created_at DESC, l.id DESC LIMIT "+b.arg(size+1), b.args...)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	changes, err := scanBalanceChanges(rows)
+	if err != nil {
+		return HistoryPage{}, err
+	}
+
+	var page HistoryPage
+	if len(changes) > size {
+		changes = changes[:size]
+		last := changes[size-1]
+		page.NextCursor = Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	page.Changes = changes
+	return page, nil
+}
+
+// Statement returns the opening and closing balance of an asset over
+// [from, to) with every change in between, oldest first.
+func (s *AccountService) Statement(ctx context.Context, id uuid.UUID, asset string, from, to time.Time) (model.Statement, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.Statement")
+	defer span.End()
+
+	if asset == "" {
+		return model.Statement{}, ErrInvalidFilter.Explain("asset is required")
+	}
+	if !from.Before(to) {
+		return model.Statement{}, ErrInvalidFilter.Explain("from must be before to")
+	}
+	if to.Sub(from) > MaxStatementPeriod {
+		return model.Statement{}, ErrInvalidFilter.Explain("statement period exceeds %s", MaxStatementPeriod)
+	}
+
+	st := model.Statement{
+		AccountID:    id,
+		Asset:        asset,
+		From:         from,
+		To:           to,
+		TotalCredits: decimal.Zero,
+		TotalDebits:  decimal.Zero,
+		Changes:      []model.BalanceChange{},
+	}
+	// Read the opening balance and the entries from one snapshot
+	err := s.inReadTx(ctx, func(tx *sql.Tx) error {
+		// Timestamps have microsecond precision: the opening balance
+		// includes everything before from
+		var code string
+		err := tx.QueryRowContext(ctx, assetBalancesAt+" AND a.asset = $3",
+			id, from.Add(-time.Microsecond), asset,
+		).Scan(&code, &st.OpeningBalance)
+		if err == sql.ErrNoRows {
+			st.OpeningBalance = decimal.Zero
+		} else if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, balanceChangeSelect+`
+			WHERE l.account_id = $1 AND l.asset = $2 AND l.created_at >= $3 AND l.created_at < $4
+			ORDER BY l.created_at, l.id`,
+			id, asset, from, to,
+		)
+		if err != nil {
+			return err
+		}
+		changes, err := scanBalanceChanges(rows)
+		if err != nil {
+			return err
+		}
+		if changes != nil {
+			st.Changes = changes
+		}
+		return nil
+	})
+	if err != nil {
+		return model.Statement{}, err
+	}
+
+	st.ClosingBalance = st.OpeningBalance
+	for _, c := range st.Changes {
+		st.ClosingBalance = st.ClosingBalance.Add(c.Delta)
+		if c.Delta.IsPositive() {
+			st.TotalCredits = st.TotalCredits.Add(c.Delta)
+		} else {
+			st.TotalDebits = st.TotalDebits.Add(c.Delta.Neg())
+		}
+	}
+	return st, nil
+}
+
+// balanceChangeSelect reads ledger entries l joined with their journal j.
+const balanceChangeSelect = `
+	SELECT l.id, l.account_id, l.asset, l.amount, l.balance_after, j.reason, l.journal_id, l.created_at
+	FROM ledger_entries l JOIN journals j ON j.id = l.journal_id `
+
+func scanBalanceChanges(rows *sql.Rows) ([]model.BalanceChange, error) {
+	defer rows.Close()
+
+	var changes []model.BalanceChange
+	for rows.Next() {
+		var c model.BalanceChange
+		var balanceAfter decimal.NullDecimal
+		if err := rows.Scan(
+			&c.ID, &c.AccountID, &c.Asset, &c.Delta, &balanceAfter, &c.Reason, &c.JournalID, &c.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		c.NewBalance = balanceAfter.Decimal
+		c.OldBalance = c.NewBalance.Sub(c.Delta)
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+// inReadTx runs fn inside a read-only repeatable-read transaction so every
+// query sees the same snapshot.
+func (s *AccountService) inReadTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/model"
+	"cex/pkg/errors"
+)
+
+// HoldRequest describes funds to reserve on an account.
+type HoldRequest struct {
+	AccountID uuid.UUID
+	Asset     string
+	Amount    decimal.Decimal
+	// Reference identifies the order or withdrawal the hold belongs to.
+	Reference string
+	// ExpiresAt releases the hold automatically when reached. Zero means never.
+	ExpiresAt time.Time
+}
+
+// PlaceHold reserves amount of the available balance. The funds stay in the
+// total balance but can no longer be held again or spent until the hold is
+// captured, released or expires.
+func (s *AccountService) PlaceHold(ctx context.Context, req HoldRequest) (model.Hold, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.PlaceHold")
+	defer span.End()
+
+	if !req.Amount.IsPositive() {
+		return model.Hold{}, ErrInvalidHold.Explain("amount must be positive")
+	}
+	now := time.Now().UTC()
+	if !req.ExpiresAt.IsZero() && !req.ExpiresAt.After(now) {
+		return model.Hold{}, ErrInvalidHold.Explain("expiry must be in the future")
+	}
+
+	hold := model.Hold{
+		ID:        uuid.New(),
+		AccountID: req.AccountID,
+		Asset:     req.Asset,
+		Amount:    req.Amount,
+		Status:    model.HoldActive,
+		Reference: req.Reference,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if !req.ExpiresAt.IsZero() {
+		expiresAt := req.ExpiresAt.UTC()
+		hold.ExpiresAt = &expiresAt
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		asset, err := getAsset(ctx, tx, req.Asset)
+		if err != nil {
+			return err
+		}
+		if !req.Amount.Equal(req.Amount.Truncate(asset.Scale)) {
+			return ErrInvalidHold.Explain("%s amounts allow at most %d decimal places", asset.Code, asset.Scale)
+		}
+
+		b, err := lockBalance(ctx, tx, req.AccountID, req.Asset, now)
+		if err != nil {
+			return err
+		}
+		if err := b.checkDebit(); err != nil {
+			return err
+		}
+		if !s.policy.Allows(b.AccountType, req.Asset, b.Available().Sub(req.Amount)) {
+			return ErrInsufficientFunds.Explain(
+				"available %s %s does not cover %s", b.Available(), req.Asset, req.Amount)
+		}
+		if err := setLocked(ctx, tx, req.AccountID, req.Asset, b.Locked.Add(req.Amount), now); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO holds (id, account_id, asset, amount, status, reference, expires_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			hold.ID, hold.AccountID, hold.Asset, hold.Amount, hold.Status, hold.Reference, hold.ExpiresAt, now, now,
+		)
+		return err
+	})
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// CaptureHold settles amount of an active hold by moving it from the held
+// account to creditAccountID (model.ExternalAccountID for withdrawals). Any
+// remainder of the hold is released. Holds past their expiry cannot be
+// captured.
+func (s *AccountService) CaptureHold(ctx context.Context, holdID uuid.UUID, amount decimal.Decimal, creditAccountID uuid.UUID) (model.Hold, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.CaptureHold")
+	defer span.End()
+
+	if !amount.IsPositive() {
+		return model.Hold{}, ErrInvalidHold.Explain("capture amount must be positive")
+	}
+
+	var hold model.Hold
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		hold, err = lockHold(ctx, tx, holdID)
+		if err != nil {
+			return err
+		}
+		// Due holds are only awaiting RunHoldExpiry; their funds are no
+		// longer reserved for the caller
+		now := time.Now().UTC()
+		if hold.ExpiresAt != nil && !now.Before(*hold.ExpiresAt) {
+			return ErrInvalidHold.Explain("hold expired at %s", hold.ExpiresAt.Format(time.RFC3339))
+		}
+		if amount.GreaterThan(hold.Amount) {
+			return ErrInvalidHold.Explain("capture amount exceeds held amount %s", hold.Amount)
+		}
+		if creditAccountID == hold.AccountID {
+			return ErrInvalidHold.Explain("cannot capture a hold into the held account")
+		}
+
+		// Lock both balances in the same order postJournal uses
+		ids := []uuid.UUID{hold.AccountID, creditAccountID}
+		if bytes.Compare(ids[1][:], ids[0][:]) < 0 {
+			ids[0], ids[1] = ids[1], ids[0]
+		}
+		var held lockedBalance
+		for _, id := range ids {
+			if id == model.ExternalAccountID {
+				continue
+			}
+			b, err := lockBalance(ctx, tx, id, hold.Asset, now)
+			if err != nil {
+				return err
+			}
+			if id == hold.AccountID {
+				held = b
+			}
+		}
+
+		// Free the whole hold first, then debit the captured part
+		if err := setLocked(ctx, tx, hold.AccountID, hold.Asset, held.Locked.Sub(hold.Amount), now); err != nil {
+			return err
+		}
+		if _, _, err := s.postJournal(ctx, tx, Journal{
+			Reason: "hold-capture",
+			Postings: []Posting{
+				{AccountID: hold.AccountID, Asset: hold.Asset, Amount: amount.Neg()},
+				{AccountID: creditAccountID, Asset: hold.Asset, Amount: amount},
+			},
+		}); err != nil {
+			return err
+		}
+
+		hold.Status = model.HoldCaptured
+		hold.CapturedAmount = decimal.NewNullDecimal(amount)
+		hold.UpdatedAt = now
+		_, err = tx.ExecContext(ctx, `
+			UPDATE holds SET status = $1, captured_amount = $2, updated_at = $3 WHERE id = $4`,
+			hold.Status, amount, now, hold.ID,
+		)
+		return err
+	})
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// ReleaseHold returns the held funds of an active hold to the available balance.
+func (s *AccountService) ReleaseHold(ctx context.Context, holdID uuid.UUID) (model.Hold, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.ReleaseHold")
+	defer span.End()
+
+	return s.releaseHold(ctx, holdID, model.HoldReleased)
+}
+
+// ExpireHolds releases up to limit active holds whose expiry has passed and
+// returns how many were expired.
+func (s *AccountService) ExpireHolds(ctx context.Context, now time.Time, limit int) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM holds
+		WHERE status = $1 AND expires_at <= $2
+		ORDER BY expires_at LIMIT $3`,
+		model.HoldActive, now, limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		_, err := s.releaseHold(ctx, id, model.HoldExpired)
+		if errors.Is(err, ErrHoldNotActive) {
+			// Captured or released concurrently
+			continue
+		}
+		if err != nil {
+			return expired, err
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// RunHoldExpiry expires due holds every interval until ctx is cancelled.
+func (s *AccountService) RunHoldExpiry(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.ExpireHolds(ctx, time.Now().UTC(), 500)
+		if err != nil {
+			log.Error("hold expiry failed", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			log.Info("expired holds", zap.Int("count", n))
+		}
+	}
+}
+
+// ListHolds returns the active holds of an account, newest first.
+func (s *AccountService) ListHolds(ctx context.Context, accountID uuid.UUID) ([]model.Hold, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, account_id, asset, amount, captured_amount, status, reference, expires_at, created_at, updated_at
+		FROM holds WHERE account_id = $1 AND status = $2
+		ORDER BY created_at DESC`,
+		accountID, model.HoldActive,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []model.Hold
+	for rows.Next() {
+		var h model.Hold
+		if err := rows.Scan(
+			&h.ID, &h.AccountID, &h.Asset, &h.Amount, &h.CapturedAmount,
+			&h.Status, &h.Reference, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+func (s *AccountService) releaseHold(ctx context.Context, holdID uuid.UUID, status model.HoldStatus) (model.Hold, error) {
+	var hold model.Hold
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		hold, err = lockHold(ctx, tx, holdID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		b, err := lockBalance(ctx, tx, hold.AccountID, hold.Asset, now)
+		if err != nil {
+			return err
+		}
+		if err := setLocked(ctx, tx, hold.AccountID, hold.Asset, b.Locked.Sub(hold.Amount), now); err != nil {
+			return err
+		}
+
+		hold.Status = status
+		hold.UpdatedAt = now
+		_, err = tx.ExecContext(ctx, `
+			UPDATE holds SET status = $1, updated_at = $2 WHERE id = $3`,
+			status, now, hold.ID,
+		)
+		return err
+	})
+	if err != nil {
+		return model.Hold{}, err
+	}
+	return hold, nil
+}
+
+// lockHold locks an active hold for update.
+func lockHold(ctx context.Context, tx *sql.Tx, id uuid.UUID) (model.Hold, error) {
+	var h model.Hold
+	err := tx.QueryRowContext(ctx, `
+		SELECT id, account_id, asset, amount, status, reference, expires_at, created_at, updated_at
+		FROM holds WHERE id = $1 FOR UPDATE`, id,
+	).Scan(&h.ID, &h.AccountID, &h.Asset, &h.Amount, &h.Status, &h.Reference, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return model.Hold{}, ErrHoldNotFound
+	}
+	if err != nil {
+		return model.Hold{}, err
+	}
+	if h.Status != model.HoldActive {
+		return model.Hold{}, ErrHoldNotActive
+	}
+	return h, nil
+}
+
+// setLocked stores the locked amount of an already locked balance row.
+func setLocked(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, asset string, locked decimal.Decimal, now time.Time) error {
+	_, err := tx.ExecContext(ctx, `
+		UPDATE account_balances SET locked = $1, updated_at = $2 WHERE account_id = $3 AND asset = $4`,
+		locked, now, accountID, asset,
+	)
+	return err
+}
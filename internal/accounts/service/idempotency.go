@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long a recorded response can be replayed.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// IdempotencyLease is how long a reservation blocks retries while its
+	// request runs. A reservation left by a crashed instance is taken over
+	// by the first retry after it.
+	IdempotencyLease = 5 * time.Minute
+)
+
+// StoredResponse is the recorded outcome of a completed idempotent request.
+type StoredResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// IdempotencyStore persists Idempotency-Key reservations and responses in
+// the idempotency_keys table.
+type IdempotencyStore struct {
+	db  *sql.DB
+	ttl time.Duration
+}
+
+func NewIdempotencyStore(db *sql.DB, ttl time.Duration) *IdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &IdempotencyStore{db: db, ttl: ttl}
+}
+
+// Reserve claims key for the owner. When the caller holds the reservation
+// and must execute the request, it returns the token of the reservation to
+// pass to Complete or Release. Otherwise it returns the stored response when
+// the request already completed, ErrIdempotencyKeyReused when the key was
+// used for a different request and ErrIdempotencyKeyInProgress while the
+// original request has not completed yet, for at most IdempotencyLease.
+func (s *IdempotencyStore) Reserve(ctx context.Context, ownerID uuid.UUID, key, requestHash string) (uuid.UUID, *StoredResponse, error) {
+	now := time.Now().UTC()
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE owner_id = $1 AND idempotency_key = $2
+		  AND (created_at < $3 OR (completed_at IS NULL AND created_at < $4))`,
+		ownerID, key, now.Add(-s.ttl), now.Add(-IdempotencyLease),
+	); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	token := uuid.New()
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (owner_id, idempotency_key, request_hash, reservation_token, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (owner_id, idempotency_key) DO NOTHING`,
+		ownerID, key, requestHash, token, now,
+	)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return uuid.Nil, nil, err
+	} else if n == 1 {
+		return token, nil, nil
+	}
+
+	var (
+		storedHash string
+		status     sql.NullInt32
+		body       []byte
+	)
+	err = s.db.QueryRowContext(ctx, `
+		SELECT request_hash, status_code, response_body
+		FROM idempotency_keys WHERE owner_id = $1 AND idempotency_key = $2`,
+		ownerID, key,
+	).Scan(&storedHash, &status, &body)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	if storedHash != requestHash {
+		return uuid.Nil, nil, ErrIdempotencyKeyReused
+	}
+	if !status.Valid {
+		return uuid.Nil, nil, ErrIdempotencyKeyInProgress
+	}
+	return uuid.Nil, &StoredResponse{StatusCode: int(status.Int32), Body: body}, nil
+}
+
+// Complete records the response of the reservation with token so retries
+// replay it. Once another request took the reservation over, it is left to
+// that request.
+func (s *IdempotencyStore) Complete(ctx context.Context, ownerID uuid.UUID, key string, token uuid.UUID, resp StoredResponse) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE idempotency_keys SET status_code = $1, response_body = $2, completed_at = $3
+		WHERE owner_id = $4 AND idempotency_key = $5 AND reservation_token = $6 AND completed_at IS NULL`,
+		resp.StatusCode, resp.Body, time.Now().UTC(), ownerID, key, token,
+	)
+	return err
+}
+
+// Release drops the reservation with token of a request that failed, so it
+// can be retried. Once another request took the reservation over, it is
+// left to that request.
+func (s *IdempotencyStore) Release(ctx context.Context, ownerID uuid.UUID, key string, token uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM idempotency_keys
+		WHERE owner_id = $1 AND idempotency_key = $2 AND reservation_token = $3 AND completed_at IS NULL`,
+		ownerID, key, token,
+	)
+	return err
+}
@@ -0,0 +1,345 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/queue"
+	"cex/pkg/apiutil"
+)
+
+// Posting is one leg of a journal. Positive amounts credit the account,
+// negative amounts debit it.
+type Posting struct {
+	AccountID uuid.UUID
+	Asset     string
+	Amount    decimal.Decimal
+}
+
+// Journal is a set of postings whose debits and credits balance.
+type Journal struct {
+	Reason   string
+	Postings []Posting
+	// OperatorID identifies the person who posted a manual journal. It is
+	// uuid.Nil for journals posted by the system.
+	OperatorID uuid.UUID
+}
+
+// BalanceCheck compares the account_balances projection with the balance
+// derived from the ledger for one asset.
+type BalanceCheck struct {
+	AccountID uuid.UUID
+	Asset     string
+	Projected decimal.Decimal
+	Ledger    decimal.Decimal
+}
+
+// Consistent reports whether the projection matches the ledger.
+func (c BalanceCheck) Consistent() bool {
+	return c.Projected.Equal(c.Ledger)
+}
+
+// balanceChange is the effect of one posting on an account projection.
+type balanceChange struct {
+	AccountID uuid.UUID
+	Asset     string
+	Old       decimal.Decimal
+	New       decimal.Decimal
+	Delta     decimal.Decimal
+}
+
+// Validate checks that the journal has at least two non-zero legs and that
+// debits equal credits in every asset.
+func (j Journal) Validate() error {
+	if j.Reason == "" {
+		return ErrInvalidJournal.Explain("journal reason is required")
+	}
+	if len(j.Postings) < 2 {
+		return ErrInvalidJournal.Explain("journal needs at least two postings")
+	}
+	sums := make(map[string]decimal.Decimal)
+	for _, p := range j.Postings {
+		if p.Asset == "" {
+			return ErrInvalidJournal.Explain("posting for account %s has no asset", p.AccountID)
+		}
+		if p.Amount.IsZero() {
+			return ErrInvalidJournal.Explain("posting for account %s has zero amount", p.AccountID)
+		}
+		sums[p.Asset] = sums[p.Asset].Add(p.Amount)
+	}
+	for asset, sum := range sums {
+		if !sum.IsZero() {
+			return ErrInvalidJournal.Explain("%s debits and credits differ by %s", asset, sum)
+		}
+	}
+	return nil
+}
+
+// PostJournal atomically writes a balanced journal to the ledger, updates the
+// balance projection of every account involved and enqueues a
+// BalanceUpdatedEvent per account.
+func (s *AccountService) PostJournal(ctx context.Context, j Journal) (uuid.UUID, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.PostJournal")
+	defer span.End()
+
+	var journalID uuid.UUID
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		journalID, _, err = s.postJournal(ctx, tx, j)
+		return err
+	})
+	return journalID, err
+}
+
+// postJournal posts j inside tx and returns the journal ID and its
+// created_at. Balances are locked in ascending (account ID, asset) order so
+// concurrent journals touching the same balances cannot deadlock.
+//
+// created_at is read from the database clock once every balance is locked,
+// so a later journal on the same balance, which waits for this one to
+// commit, is always stamped later. History, balance_after continuity and
+// snapshots rely on it.
+func (s *AccountService) postJournal(ctx context.Context, tx *sql.Tx, j Journal) (uuid.UUID, time.Time, error) {
+	if err := j.Validate(); err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	for _, p := range j.Postings {
+		asset, err := getAsset(ctx, tx, p.Asset)
+		if err != nil {
+			return uuid.Nil, time.Time{}, err
+		}
+		if !p.Amount.Equal(p.Amount.Truncate(asset.Scale)) {
+			return uuid.Nil, time.Time{}, ErrInvalidJournal.Explain("%s amounts allow at most %d decimal places", asset.Code, asset.Scale)
+		}
+	}
+
+	postings := make([]Posting, len(j.Postings))
+	copy(postings, j.Postings)
+	sort.SliceStable(postings, func(a, b int) bool {
+		if c := bytes.Compare(postings[a].AccountID[:], postings[b].AccountID[:]); c != 0 {
+			return c < 0
+		}
+		return postings[a].Asset < postings[b].Asset
+	})
+
+	// Lock and check every balance before anything is written
+	locked := make(map[balanceKey]*lockedBalance)
+	changes := make([]*balanceChange, len(postings))
+	for i, p := range postings {
+		if p.AccountID == model.ExternalAccountID {
+			continue
+		}
+		key := balanceKey{p.AccountID, p.Asset}
+		b, ok := locked[key]
+		if !ok {
+			lb, err := lockBalance(ctx, tx, p.AccountID, p.Asset, time.Now().UTC())
+			if err != nil {
+				return uuid.Nil, time.Time{}, err
+			}
+			b = &lb
+			locked[key] = b
+		}
+		change, err := s.applyPosting(b, p)
+		if err != nil {
+			return uuid.Nil, time.Time{}, err
+		}
+		changes[i] = &change
+	}
+
+	var now time.Time
+	journalID := uuid.New()
+	operatorID := uuid.NullUUID{UUID: j.OperatorID, Valid: j.OperatorID != uuid.Nil}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO journals (id, reason, operator_id, created_at) VALUES ($1, $2, $3, clock_timestamp())
+		RETURNING created_at`,
+		journalID, j.Reason, operatorID,
+	).Scan(&now); err != nil {
+		return uuid.Nil, time.Time{}, err
+	}
+	now = now.UTC()
+
+	for i, p := range postings {
+		var balanceAfter decimal.NullDecimal
+		if c := changes[i]; c != nil {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE account_balances SET balance = $1, updated_at = $2 WHERE account_id = $3 AND asset = $4`,
+				c.New, now, p.AccountID, p.Asset,
+			); err != nil {
+				return uuid.Nil, time.Time{}, err
+			}
+			balanceAfter = decimal.NewNullDecimal(c.New)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO ledger_entries (id, journal_id, account_id, asset, amount, balance_after, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			uuid.New(), journalID, p.AccountID, p.Asset, p.Amount, balanceAfter, now,
+		); err != nil {
+			return uuid.Nil, time.Time{}, err
+		}
+	}
+
+	for _, c := range changes {
+		if c == nil {
+			continue
+		}
+		ev := apiutil.BalanceUpdatedEvent{
+			EventID:    uuid.New(),
+			AccountID:  c.AccountID,
+			Asset:      c.Asset,
+			OldBalance: c.Old.String(),
+			NewBalance: c.New.String(),
+			Delta:      c.Delta.String(),
+			Reason:     j.Reason,
+			Timestamp:  now,
+		}
+		if operatorID.Valid {
+			ev.OperatorID = &operatorID.UUID
+		}
+		if err := queue.Enqueue(ctx, tx, ev.EventID, c.AccountID, queue.EventBalanceUpdated, ev); err != nil {
+			return uuid.Nil, time.Time{}, err
+		}
+	}
+	return journalID, now, nil
+}
+
+// balanceKey identifies the balance of one asset of an account.
+type balanceKey struct {
+	AccountID uuid.UUID
+	Asset     string
+}
+
+// lockedBalance is an account_balances row locked for update.
+type lockedBalance struct {
+	AccountType   string
+	AccountStatus model.AccountStatus
+	Balance       decimal.Decimal
+	Locked        decimal.Decimal
+}
+
+// Available is the part of the balance not reserved by holds.
+func (b lockedBalance) Available() decimal.Decimal {
+	return b.Balance.Sub(b.Locked)
+}
+
+// checkDebit rejects debits and new holds on accounts that are not active.
+func (b lockedBalance) checkDebit() error {
+	switch b.AccountStatus {
+	case model.AccountFrozen:
+		return ErrAccountFrozen
+	case model.AccountClosed:
+		return ErrAccountClosed
+	}
+	return nil
+}
+
+// lockBalance locks the asset balance of an account, creating it on first use.
+// The account row is locked too, so its status cannot change until tx ends.
+// It takes an exclusive lock: CockroachDB before 23.2 does not enforce FOR
+// SHARE.
+func lockBalance(ctx context.Context, tx *sql.Tx, accountID uuid.UUID, asset string, now time.Time) (lockedBalance, error) {
+	var b lockedBalance
+	err := tx.QueryRowContext(ctx, `
+		SELECT account_type, status FROM accounts WHERE id = $1 FOR UPDATE`, accountID,
+	).Scan(&b.AccountType, &b.AccountStatus)
+	if err == sql.ErrNoRows {
+		return lockedBalance{}, ErrAccountNotFound
+	}
+	if err != nil {
+		return lockedBalance{}, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO account_balances (account_id, asset, balance, updated_at)
+		VALUES ($1, $2, 0, $3)
+		ON CONFLICT (account_id, asset) DO NOTHING`,
+		accountID, asset, now,
+	); err != nil {
+		return lockedBalance{}, err
+	}
+
+	if err := tx.QueryRowContext(ctx, `
+		SELECT balance, locked FROM account_balances WHERE account_id = $1 AND asset = $2 FOR UPDATE`,
+		accountID, asset,
+	).Scan(&b.Balance, &b.Locked); err != nil {
+		return lockedBalance{}, err
+	}
+	return b, nil
+}
+
+// applyPosting moves the locked balance b by p. Closed accounts accept no
+// postings and frozen accounts only credits. Debits must leave an available
+// balance the policy of the account type allows.
+func (s *AccountService) applyPosting(b *lockedBalance, p Posting) (balanceChange, error) {
+	if b.AccountStatus == model.AccountClosed {
+		return balanceChange{}, ErrAccountClosed
+	}
+	if p.Amount.IsNegative() {
+		if err := b.checkDebit(); err != nil {
+			return balanceChange{}, err
+		}
+	}
+
+	newBalance := b.Balance.Add(p.Amount)
+	if p.Amount.IsNegative() && !s.policy.Allows(b.AccountType, p.Asset, newBalance.Sub(b.Locked)) {
+		return balanceChange{}, ErrInsufficientFunds.Explain(
+			"available %s %s does not cover %s", b.Available(), p.Asset, p.Amount.Neg())
+	}
+	change := balanceChange{AccountID: p.AccountID, Asset: p.Asset, Old: b.Balance, New: newBalance, Delta: p.Amount}
+	b.Balance = newBalance
+	return change, nil
+}
+
+// VerifyBalance recomputes every asset balance of an account from its ledger
+// entries and returns them alongside the projected account_balances values.
+func (s *AccountService) VerifyBalance(ctx context.Context, id uuid.UUID) ([]BalanceCheck, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT b.asset, b.balance, COALESCE(SUM(l.amount), 0)
+		FROM account_balances b
+		LEFT JOIN ledger_entries l ON l.account_id = b.account_id AND l.asset = b.asset
+		WHERE b.account_id = $1 GROUP BY b.asset, b.balance ORDER BY b.asset`, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []BalanceCheck
+	for rows.Next() {
+		check := BalanceCheck{AccountID: id}
+		if err := rows.Scan(&check.Asset, &check.Projected, &check.Ledger); err != nil {
+			return nil, err
+		}
+		checks = append(checks, check)
+	}
+	return checks, rows.Err()
+}
+
+// TxTimeout bounds the transactions of the service. Postings commit at most
+// TxTimeout after the created_at they are stamped with, which snapshots rely
+// on; it must stay well below SnapshotLag.
+const TxTimeout = 10 * time.Second
+
+// inTx runs fn inside a transaction, committing on success and rolling back
+// on error. The transaction is rolled back once it has run for TxTimeout.
+func (s *AccountService) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, TxTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
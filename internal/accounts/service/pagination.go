@@ -0,0 +1,66 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// DefaultPageSize is used when a list request does not ask for a size.
+	DefaultPageSize = 50
+	// MaxPageSize caps the size of a single page.
+	MaxPageSize = 200
+)
+
+// Cursor is the keyset position after the last row of a page. Clients only
+// ever see it as an opaque token.
+type Cursor struct {
+	// Sort is the order the cursor was issued for.
+	Sort      AccountSort      `json:"s"`
+	Balance   *decimal.Decimal `json:"b,omitempty"`
+	CreatedAt time.Time        `json:"t"`
+	ID        uuid.UUID        `json:"id"`
+}
+
+// Encode returns the opaque token for c.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token returned by Encode. The empty token is the
+// zero Cursor, meaning the first page.
+func DecodeCursor(token string) (Cursor, error) {
+	var c Cursor
+	if token == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// IsZero reports whether c points at the first page.
+func (c Cursor) IsZero() bool {
+	return c.ID == uuid.Nil
+}
+
+// pageSize applies the default and maximum page sizes to a requested size.
+func pageSize(size int) int {
+	switch {
+	case size <= 0:
+		return DefaultPageSize
+	case size > MaxPageSize:
+		return MaxPageSize
+	}
+	return size
+}
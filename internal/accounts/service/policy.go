@@ -0,0 +1,67 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// OverdraftPolicy is the balance rule of one account type. The available
+// balance (total minus locked) of an asset may drop to minus its credit
+// limit; assets without a limit must stay non-negative.
+type OverdraftPolicy struct {
+	CreditLimits map[string]decimal.Decimal
+}
+
+// CreditLimit returns how far below zero the available balance of asset may go.
+func (p OverdraftPolicy) CreditLimit(asset string) decimal.Decimal {
+	return p.CreditLimits[asset]
+}
+
+// BalancePolicy maps account types (fiat, spot, futures) to their overdraft
+// policy. Account types without an entry must stay non-negative, so the zero
+// value rejects every debit exceeding the available balance.
+type BalancePolicy map[string]OverdraftPolicy
+
+// Allows reports whether an account of accountType may end up with the given
+// available balance of asset.
+func (p BalancePolicy) Allows(accountType, asset string, available decimal.Decimal) bool {
+	return !available.Add(p[accountType].CreditLimit(asset)).IsNegative()
+}
+
+// ParseBalancePolicy reads credit limits written as comma separated
+// type:asset=limit items, e.g. "futures:USDT=10000,futures:USD=10000".
+// An empty spec yields the strict non-negative policy for every type.
+func ParseBalancePolicy(spec string) (BalancePolicy, error) {
+	policy := BalancePolicy{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("credit limit %q: missing '='", item)
+		}
+		accountType, asset, ok := strings.Cut(key, ":")
+		if !ok || accountType == "" || asset == "" {
+			return nil, fmt.Errorf("credit limit %q: expected type:asset=limit", item)
+		}
+		limit, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil, fmt.Errorf("credit limit %q: %w", item, err)
+		}
+		if limit.IsNegative() {
+			return nil, fmt.Errorf("credit limit %q: must not be negative", item)
+		}
+
+		p, ok := policy[accountType]
+		if !ok {
+			p = OverdraftPolicy{CreditLimits: map[string]decimal.Decimal{}}
+		}
+		p.CreditLimits[strings.ToUpper(asset)] = limit
+		policy[accountType] = p
+	}
+	return policy, nil
+}
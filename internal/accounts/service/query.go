@@ -0,0 +1,31 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+)
+
+// queryBuilder assembles a parameterised statement. Every value is bound
+// through a placeholder returned by arg.
+type queryBuilder struct {
+	conds []string
+	args  []any
+}
+
+// arg binds v and returns its placeholder.
+func (b *queryBuilder) arg(v any) string {
+	b.args = append(b.args, v)
+	return "$" + strconv.Itoa(len(b.args))
+}
+
+func (b *queryBuilder) where(cond string) {
+	b.conds = append(b.conds, cond)
+}
+
+// whereClause joins the conditions with AND.
+func (b *queryBuilder) whereClause() string {
+	if len(b.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(b.conds, " AND ")
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+	"go.uber.org/zap"
+)
+
+// SnapshotLag is how far behind the database clock snapshots are taken at
+// the latest. It must exceed TxTimeout by a wide margin; see TakeSnapshots.
+const SnapshotLag = time.Minute
+
+// assetBalancesAt sums, per asset of an account, the latest snapshot taken
+// at or before t and the ledger entries after it up to and including t.
+const assetBalancesAt = `
+	SELECT a.asset, COALESCE(s.balance, 0) + COALESCE((
+		SELECT SUM(l.amount) FROM ledger_entries l
+		WHERE l.account_id = a.account_id AND l.asset = a.asset AND l.created_at <= $2
+		  AND (s.taken_at IS NULL OR l.created_at > s.taken_at)
+	), 0)
+	FROM account_balances a
+	LEFT JOIN LATERAL (
+		SELECT taken_at, balance FROM balance_snapshots
+		WHERE account_id = a.account_id AND asset = a.asset AND taken_at <= $2
+		ORDER BY taken_at DESC LIMIT 1
+	) s ON true
+	WHERE a.account_id = $1`
+
+// BalanceAt returns the balance of every asset of an account as of t,
+// including changes made exactly at t. Every change is recorded in the
+// ledger, so past balances are exact; snapshots only bound the entries that
+// have to be summed.
+func (s *AccountService) BalanceAt(ctx context.Context, id uuid.UUID, t time.Time) (map[string]decimal.Decimal, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.BalanceAt")
+	defer span.End()
+
+	if _, err := s.GetAccount(ctx, id); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, assetBalancesAt, id, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := make(map[string]decimal.Decimal)
+	for rows.Next() {
+		var asset string
+		var balance decimal.Decimal
+		if err := rows.Scan(&asset, &balance); err != nil {
+			return nil, err
+		}
+		balances[asset] = balance
+	}
+	return balances, rows.Err()
+}
+
+// TakeSnapshots stores the balance of every account and asset as of at,
+// building on the previous snapshot of each balance. It returns the time the
+// snapshots were taken at and their number; balances already snapshotted at
+// that time are skipped.
+//
+// A snapshot must never miss a posting that commits after it. Postings are
+// stamped within their transaction, which inTx aborts after TxTimeout, so
+// every entry stamped at or before some time has committed or rolled back
+// SnapshotLag later. Snapshots are therefore taken SnapshotLag behind the
+// database clock when at is later. CockroachDB gives nothing tighter: it does
+// not report transaction starts in pg_stat_activity, and AS OF SYSTEM TIME
+// reads go by commit timestamps rather than the created_at stamped before.
+func (s *AccountService) TakeSnapshots(ctx context.Context, at time.Time) (time.Time, int64, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.TakeSnapshots")
+	defer span.End()
+
+	// The database clock stamps postings, so it bounds them too
+	var takenAt time.Time
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT LEAST($1::timestamptz, now() - $2 * interval '1 millisecond')`,
+		at, SnapshotLag.Milliseconds(),
+	).Scan(&takenAt); err != nil {
+		return time.Time{}, 0, err
+	}
+	takenAt = takenAt.UTC()
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO balance_snapshots (account_id, asset, taken_at, balance)
+		SELECT a.account_id, a.asset, $1, COALESCE(s.balance, 0) + COALESCE((
+			SELECT SUM(l.amount) FROM ledger_entries l
+			WHERE l.account_id = a.account_id AND l.asset = a.asset AND l.created_at <= $1
+			  AND (s.taken_at IS NULL OR l.created_at > s.taken_at)
+		), 0)
+		FROM account_balances a
+		LEFT JOIN LATERAL (
+			SELECT taken_at, balance FROM balance_snapshots
+			WHERE account_id = a.account_id AND asset = a.asset AND taken_at <= $1
+			ORDER BY taken_at DESC LIMIT 1
+		) s ON true
+		ON CONFLICT (account_id, asset, taken_at) DO NOTHING`, takenAt,
+	)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	n, err := res.RowsAffected()
+	return takenAt, n, err
+}
+
+// RunBalanceSnapshots takes snapshots every interval, SnapshotLag behind the
+// clock, until ctx is cancelled.
+func (s *AccountService) RunBalanceSnapshots(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		at, n, err := s.TakeSnapshots(ctx, time.Now().UTC().Add(-SnapshotLag).Truncate(time.Second))
+		if err != nil {
+			log.Error("balance snapshot failed", zap.Error(err))
+			continue
+		}
+		log.Info("took balance snapshots", zap.Int64("count", n), zap.Time("at", at))
+	}
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/queue"
+	"cex/pkg/apiutil"
+)
+
+// statusEvents maps the target status of a transition to its event type.
+var statusEvents = map[model.AccountStatus]string{
+	model.AccountActive: queue.EventAccountUnfrozen,
+	model.AccountFrozen: queue.EventAccountFrozen,
+	model.AccountClosed: queue.EventAccountClosed,
+}
+
+// FreezeAccount blocks debits and new holds on an active account.
+func (s *AccountService) FreezeAccount(ctx context.Context, id, actorID uuid.UUID, reason string) (model.Account, error) {
+	return s.changeStatus(ctx, id, model.AccountFrozen, actorID, reason)
+}
+
+// UnfreezeAccount makes a frozen account active again.
+func (s *AccountService) UnfreezeAccount(ctx context.Context, id, actorID uuid.UUID, reason string) (model.Account, error) {
+	return s.changeStatus(ctx, id, model.AccountActive, actorID, reason)
+}
+
+// CloseAccount closes an active account. Every asset balance, including held
+// funds, must be zero.
+func (s *AccountService) CloseAccount(ctx context.Context, id, actorID uuid.UUID, reason string) (model.Account, error) {
+	return s.changeStatus(ctx, id, model.AccountClosed, actorID, reason)
+}
+
+// changeStatus moves an account to status next, records the transition in the
+// audit table and enqueues the matching event.
+func (s *AccountService) changeStatus(ctx context.Context, id uuid.UUID, next model.AccountStatus, actorID uuid.UUID, reason string) (model.Account, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.changeStatus")
+	defer span.End()
+
+	if reason == "" {
+		return model.Account{}, ErrInvalidStatusChange.Explain("reason is required")
+	}
+
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		// Postings lock the account row in lockBalance too, so none is in flight
+		var current model.AccountStatus
+		err := tx.QueryRowContext(ctx, `
+			SELECT status FROM accounts WHERE id = $1 FOR UPDATE`, id,
+		).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrAccountNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !current.CanTransitionTo(next) {
+			return ErrInvalidStatusTransition.Explain("cannot change account from %s to %s", current, next)
+		}
+
+		if next == model.AccountClosed {
+			var funded bool
+			if err := tx.QueryRowContext(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM account_balances
+					WHERE account_id = $1 AND (balance <> 0 OR locked <> 0)
+				)`, id,
+			).Scan(&funded); err != nil {
+				return err
+			}
+			if funded {
+				return ErrAccountNotEmpty
+			}
+		}
+
+		now := time.Now().UTC()
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE accounts SET status = $1, updated_at = $2 WHERE id = $3`,
+			next, now, id,
+		); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO account_status_changes (id, account_id, from_status, to_status, reason, actor_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			uuid.New(), id, current, next, reason, actorID, now,
+		); err != nil {
+			return err
+		}
+
+		ev := apiutil.AccountStatusChangedEvent{
+			EventID:   uuid.New(),
+			AccountID: id,
+			OldStatus: string(current),
+			NewStatus: string(next),
+			Reason:    reason,
+			ActorID:   actorID,
+			Timestamp: now,
+		}
+		return queue.Enqueue(ctx, tx, ev.EventID, id, statusEvents[next], ev)
+	})
+	if err != nil {
+		return model.Account{}, err
+	}
+	return s.GetAccount(ctx, id)
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"go.opentelemetry.io/otel"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/queue"
+	"cex/pkg/apiutil"
+)
+
+// Transfer moves amount of asset from one account to another in a single
+// transaction.
+// Both balance changes are posted as one journal, and a TransferCompletedEvent
+// is enqueued next to the per-account BalanceUpdatedEvents.
+func (s *AccountService) Transfer(ctx context.Context, from, to uuid.UUID, asset string, amount decimal.Decimal) (model.Transfer, error) {
+	tracer := otel.Tracer("accounts-service")
+	ctx, span := tracer.Start(ctx, "AccountService.Transfer")
+	defer span.End()
+
+	if from == to {
+		return model.Transfer{}, ErrInvalidTransfer.Explain("source and destination accounts must differ")
+	}
+	if !amount.IsPositive() {
+		return model.Transfer{}, ErrInvalidTransfer.Explain("amount must be positive")
+	}
+
+	transfer := model.Transfer{
+		FromAccountID: from,
+		ToAccountID:   to,
+		Asset:         asset,
+		Amount:        amount,
+	}
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		journalID, postedAt, err := s.postJournal(ctx, tx, Journal{
+			Reason: "transfer",
+			Postings: []Posting{
+				{AccountID: from, Asset: asset, Amount: amount.Neg()},
+				{AccountID: to, Asset: asset, Amount: amount},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		transfer.ID = journalID
+		transfer.CreatedAt = postedAt
+
+		ev := apiutil.TransferCompletedEvent{
+			EventID:       uuid.New(),
+			TransferID:    transfer.ID,
+			FromAccountID: from,
+			ToAccountID:   to,
+			Asset:         asset,
+			Amount:        amount.String(),
+			Timestamp:     transfer.CreatedAt,
+		}
+		return queue.Enqueue(ctx, tx, ev.EventID, from, queue.EventTransferCompleted, ev)
+	})
+	if err != nil {
+		return model.Transfer{}, err
+	}
+	return transfer, nil
+}
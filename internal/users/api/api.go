@@ -3,37 +3,72 @@ package api
 import (
 	"log/slog"
 
+	"cex/internal/users/service"
 	"cex/pkg/apiutil"
 
+	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 )
 
 type API struct {
-	log *slog.Logger
+	log    *slog.Logger
+	users  *service.UserService
+	tokens *service.TokenIssuer
+	keys   *service.KeySet
 }
 
-func New(log *slog.Logger) *API {
+func New(log *slog.Logger, users *service.UserService, tokens *service.TokenIssuer, keys *service.KeySet) *API {
 	return &API{
-		log: log,
+		log:    log,
+		users:  users,
+		tokens: tokens,
+		keys:   keys,
 	}
 }
 
-func (a *API) Serve(listenAddr string) error {
+// Handler returns the echo instance serving the API.
+func (a *API) Handler() *echo.Echo {
 	e := echo.New()
 
 	e.HideBanner = true
 	e.HidePort = true
 	e.HTTPErrorHandler = apiutil.ErrorHandler(a.log)
-	//e.Validator = &Validator{validator.New()}
+	e.Validator = apiutil.NewEchoValidator(validator.New())
 
 	//e.GET("/docs/*", echoSwagger.WrapHandler)
 
-	//v1 := e.Group("/api/v1")
-	//a.registerPublicRoutes(v1)
+	e.GET("/.well-known/jwks.json", a.JWKS)
+
+	v1 := e.Group("/api/v1")
+	a.registerPublicRoutes(v1)
 
-	//authenticated := v1.Group("", a.auth.AuthMiddleware)
-	//a.registerAuthenticatedRoutes(authenticated)
+	authenticated := v1.Group("", a.AuthMiddleware)
+	a.registerAuthenticatedRoutes(authenticated)
 
+	return e
+}
+
+func (a *API) Serve(listenAddr string) error {
+	e := a.Handler()
 	a.log.Info("http server listening on " + listenAddr)
 	return e.Start(listenAddr)
 }
+
+func (a *API) registerPublicRoutes(g *echo.Group) {
+	g.POST("/auth/register", a.Register)
+	g.POST("/auth/login", a.Login)
+	g.POST("/auth/login/mfa", a.LoginMFA)
+	g.POST("/auth/refresh", a.Refresh)
+	g.GET("/auth/revocations", a.Revocations)
+}
+
+func (a *API) registerAuthenticatedRoutes(g *echo.Group) {
+	g.POST("/auth/logout", a.Logout)
+	g.POST("/auth/logout-all", a.LogoutAll)
+	g.POST("/auth/mfa/totp", a.EnrollTOTP)
+	g.POST("/auth/mfa/totp/confirm", a.ConfirmTOTP)
+	g.POST("/auth/mfa/totp/disable", a.DisableTOTP)
+	g.POST("/auth/mfa/recovery-codes", a.RegenerateRecoveryCodes)
+	g.POST("/auth/mfa/step-up", a.StepUp)
+	g.GET("/users/me", a.Me)
+}
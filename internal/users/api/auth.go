@@ -0,0 +1,234 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+
+	"cex/internal/users/service"
+	"cex/pkg/auth"
+	"cex/pkg/errors"
+)
+
+// claimsKey is the echo context key of the verified access token claims.
+const claimsKey = "claims"
+
+// errInvalidRequest is returned for bodies that do not bind or validate.
+var errInvalidRequest = errors.Invalid.Reason("InvalidRequest")
+
+// CredentialsRequest is the body of register and login.
+type CredentialsRequest struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// RefreshRequest is the body of POST /auth/refresh.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+// Register handles POST /auth/register
+// @Summary Register a user
+// @Tags public
+// @Accept json
+// @Produce json
+// @Param body body CredentialsRequest true "Email and password"
+// @Success 201 {object} model.User
+// @Failure 400 {object} errors.Error
+// @Failure 409 {object} errors.Error
+// @Router /auth/register [post]
+func (a *API) Register(c echo.Context) error {
+	var req CredentialsRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	user, err := a.users.Register(c.Request().Context(), req.Email, req.Password)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, user)
+}
+
+// Login handles POST /auth/login
+// @Summary Exchange credentials for an access and a refresh token
+// @Tags public
+// @Accept json
+// @Produce json
+// @Description Users with two-factor authentication get an mfa challenge instead of tokens, to complete with POST /auth/login/mfa.
+// @Param body body CredentialsRequest true "Email and password"
+// @Success 200 {object} service.LoginResult
+// @Failure 401 {object} errors.Error
+// @Router /auth/login [post]
+func (a *API) Login(c echo.Context) error {
+	var req CredentialsRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	result, err := a.users.Login(c.Request().Context(), req.Email, req.Password)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// Refresh handles POST /auth/refresh
+// @Summary Exchange a refresh token for a new token pair
+// @Tags public
+// @Accept json
+// @Produce json
+// @Param body body RefreshRequest true "Refresh token"
+// @Success 200 {object} service.Tokens
+// @Failure 401 {object} errors.Error
+// @Router /auth/refresh [post]
+func (a *API) Refresh(c echo.Context) error {
+	var req RefreshRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	tokens, err := a.users.Refresh(c.Request().Context(), req.RefreshToken)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// Logout handles POST /auth/logout
+// @Summary Revoke the session of the access token
+// @Tags authenticated
+// @Security BearerAuth
+// @Success 204
+// @Failure 401 {object} errors.Error
+// @Router /auth/logout [post]
+func (a *API) Logout(c echo.Context) error {
+	sid, err := sessionID(c)
+	if err != nil {
+		return err
+	}
+	if err := a.users.Logout(c.Request().Context(), UserID(c), sid); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAllResponse is the body of POST /auth/logout-all.
+type LogoutAllResponse struct {
+	RevokedSessions int `json:"revoked_sessions"`
+}
+
+// LogoutAll handles POST /auth/logout-all
+// @Summary Revoke every session of the user
+// @Tags authenticated
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LogoutAllResponse
+// @Failure 401 {object} errors.Error
+// @Router /auth/logout-all [post]
+func (a *API) LogoutAll(c echo.Context) error {
+	n, err := a.users.LogoutAll(c.Request().Context(), UserID(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, LogoutAllResponse{RevokedSessions: n})
+}
+
+// Revocations handles GET /auth/revocations?since=
+// @Summary Access tokens revoked before they expire
+// @Description Services verifying access tokens poll this to reject revoked ones. since (RFC 3339) limits the list to later revocations.
+// @Tags public
+// @Produce json
+// @Param since query string false "RFC 3339 time"
+// @Success 200 {object} auth.RevocationList
+// @Failure 400 {object} errors.Error
+// @Router /auth/revocations [get]
+func (a *API) Revocations(c echo.Context) error {
+	var since time.Time
+	if v := c.QueryParam("since"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return errInvalidRequest.Explain("since must be an RFC 3339 time")
+		}
+		since = t
+	}
+	revocations, err := a.users.Revocations(c.Request().Context(), since)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, auth.RevocationList{Revocations: revocations})
+}
+
+// Me handles GET /users/me
+// @Summary The authenticated user
+// @Tags authenticated
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} model.User
+// @Failure 401 {object} errors.Error
+// @Router /users/me [get]
+func (a *API) Me(c echo.Context) error {
+	user, err := a.users.GetUser(c.Request().Context(), UserID(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, user)
+}
+
+// AuthMiddleware requires a valid, unrevoked access token in the
+// Authorization header.
+func (a *API) AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+		if !ok || token == "" {
+			return service.ErrInvalidToken.Explain("missing bearer token")
+		}
+		claims, err := a.tokens.ParseAccess(token)
+		if err != nil {
+			return service.ErrInvalidToken
+		}
+		revoked, err := a.users.IsRevoked(c.Request().Context(), claims.ID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return service.ErrInvalidToken
+		}
+		c.Set(claimsKey, claims)
+		return next(c)
+	}
+}
+
+func tokenClaims(c echo.Context) *service.Claims {
+	claims, _ := c.Get(claimsKey).(*service.Claims)
+	if claims == nil {
+		return &service.Claims{}
+	}
+	return claims
+}
+
+// UserID returns the subject of the access token verified by AuthMiddleware.
+func UserID(c echo.Context) uuid.UUID {
+	id, _ := uuid.Parse(tokenClaims(c).Subject)
+	return id
+}
+
+// sessionID returns the session of the access token verified by
+// AuthMiddleware.
+func sessionID(c echo.Context) (uuid.UUID, error) {
+	sid, err := uuid.Parse(tokenClaims(c).SessionID)
+	if err != nil {
+		return uuid.Nil, service.ErrInvalidToken
+	}
+	return sid, nil
+}
+
+func bindAndValidate(c echo.Context, req any) error {
+	if err := c.Bind(req); err != nil {
+		return errInvalidRequest.Explain("invalid request body")
+	}
+	if err := c.Validate(req); err != nil {
+		return errInvalidRequest.Explain("%s", err.Error())
+	}
+	return nil
+}
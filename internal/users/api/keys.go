@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JWKS handles GET /.well-known/jwks.json
+// @Summary Public keys verifying the access tokens
+// @Description Tokens name their key in the kid header. Keys are published before they sign and until the tokens they signed have expired.
+// @Tags public
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (a *API) JWKS(c echo.Context) error {
+	set, err := a.keys.JWKS()
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set(echo.HeaderCacheControl, "public, max-age=60")
+	return c.JSON(http.StatusOK, set)
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CodeRequest carries a TOTP code or a recovery code.
+type CodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// MFALoginRequest is the body of POST /auth/login/mfa.
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// LoginMFA handles POST /auth/login/mfa
+// @Summary Complete a login with a TOTP or recovery code
+// @Description Access tokens of the session carry amr ["pwd", "otp"].
+// @Tags public
+// @Accept json
+// @Produce json
+// @Param body body MFALoginRequest true "Challenge token and code"
+// @Success 200 {object} service.Tokens
+// @Failure 401 {object} errors.Error
+// @Failure 429 {object} errors.Error
+// @Router /auth/login/mfa [post]
+func (a *API) LoginMFA(c echo.Context) error {
+	var req MFALoginRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	tokens, err := a.users.CompleteLogin(c.Request().Context(), req.MFAToken, req.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
+
+// EnrollTOTP handles POST /auth/mfa/totp
+// @Summary Start TOTP enrollment
+// @Description Returns a secret to add to an authenticator app. It takes effect once confirmed.
+// @Tags authenticated
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} service.TOTPEnrollment
+// @Failure 409 {object} errors.Error
+// @Router /auth/mfa/totp [post]
+func (a *API) EnrollTOTP(c echo.Context) error {
+	enrollment, err := a.users.EnrollTOTP(c.Request().Context(), UserID(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP handles POST /auth/mfa/totp/confirm
+// @Summary Enable TOTP with a first code
+// @Description Returns the recovery codes, which are not shown again.
+// @Tags authenticated
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body CodeRequest true "TOTP code"
+// @Success 200 {object} service.RecoveryCodes
+// @Failure 401 {object} errors.Error
+// @Failure 409 {object} errors.Error
+// @Router /auth/mfa/totp/confirm [post]
+func (a *API) ConfirmTOTP(c echo.Context) error {
+	var req CodeRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	codes, err := a.users.ConfirmTOTP(c.Request().Context(), UserID(c), req.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+// DisableTOTP handles POST /auth/mfa/totp/disable
+// @Summary Turn off two-factor authentication
+// @Tags authenticated
+// @Accept json
+// @Security BearerAuth
+// @Param body body CodeRequest true "TOTP or recovery code"
+// @Success 204
+// @Failure 401 {object} errors.Error
+// @Failure 429 {object} errors.Error
+// @Router /auth/mfa/totp/disable [post]
+func (a *API) DisableTOTP(c echo.Context) error {
+	var req CodeRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	if err := a.users.DisableTOTP(c.Request().Context(), UserID(c), req.Code); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes handles POST /auth/mfa/recovery-codes
+// @Summary Replace the recovery codes
+// @Tags authenticated
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body CodeRequest true "TOTP or recovery code"
+// @Success 200 {object} service.RecoveryCodes
+// @Failure 401 {object} errors.Error
+// @Failure 429 {object} errors.Error
+// @Router /auth/mfa/recovery-codes [post]
+func (a *API) RegenerateRecoveryCodes(c echo.Context) error {
+	var req CodeRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	codes, err := a.users.RegenerateRecoveryCodes(c.Request().Context(), UserID(c), req.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+// StepUp handles POST /auth/mfa/step-up
+// @Summary Pass two-factor authentication in the current session
+// @Description Rotates the session tokens; the new access token carries amr ["pwd", "otp"] and auth_time now, as the accounts service requires for transfers and adjustments.
+// @Tags authenticated
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param body body CodeRequest true "TOTP or recovery code"
+// @Success 200 {object} service.Tokens
+// @Failure 401 {object} errors.Error
+// @Failure 429 {object} errors.Error
+// @Router /auth/mfa/step-up [post]
+func (a *API) StepUp(c echo.Context) error {
+	var req CodeRequest
+	if err := bindAndValidate(c, &req); err != nil {
+		return err
+	}
+	sid, err := sessionID(c)
+	if err != nil {
+		return err
+	}
+	tokens, err := a.users.StepUp(c.Request().Context(), UserID(c), sid, req.Code)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tokens)
+}
@@ -1,17 +1,32 @@
 package users
 
 import (
+	"context"
 	"log/slog"
+	"time"
 
 	"cex/internal/users/api"
+	"cex/internal/users/service"
 
 	"gorm.io/gorm"
 )
 
+// keySyncInterval is how often every instance reloads the signing keys. An
+// instance may keep signing with a replaced key for that long.
+const keySyncInterval = time.Minute
+
 type Opts struct {
 	Log           *slog.Logger
 	DB            *gorm.DB
 	ListenAddress string
+	// Tokens configures the JWTs issued on login.
+	Tokens service.TokenConfig
+	// Keys configures the keys signing them.
+	Keys service.KeyConfig
+	// Hashing tunes argon2id; zero fields use the defaults.
+	Hashing service.Argon2Params
+	// MFA configures two-factor authentication.
+	MFA service.MFAConfig
 }
 
 type App struct {
@@ -19,18 +34,66 @@ type App struct {
 	db            *gorm.DB
 	listenAddress string
 
-	api *api.API
+	users *service.UserService
+	keys  *service.KeyStore
+	api   *api.API
 }
 
-func New(opts Opts) *App {
+func New(opts Opts) (*App, error) {
+	keySet := &service.KeySet{}
+	tokens, err := service.NewTokenIssuer(opts.Tokens, keySet)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Keys.Retain <= 0 {
+		opts.Keys.Retain = tokens.AccessTTL() + keySyncInterval
+	}
+	keys, err := service.NewKeyStore(opts.DB, opts.Keys, keySet)
+	if err != nil {
+		return nil, err
+	}
+	users, err := service.NewUserService(opts.DB, tokens, opts.Hashing, opts.MFA)
+	if err != nil {
+		return nil, err
+	}
+
 	return &App{
-		api:           api.New(opts.Log),
+		api:           api.New(opts.Log, users, tokens, keySet),
+		users:         users,
+		keys:          keys,
 		log:           opts.Log,
 		db:            opts.DB,
 		listenAddress: opts.ListenAddress,
+	}, nil
+}
+
+// Run migrates the schema, loads the signing keys and serves the API until
+// it fails.
+func (a *App) Run(ctx context.Context) error {
+	if err := a.users.Migrate(ctx); err != nil {
+		return err
 	}
+	if err := a.keys.Sync(ctx); err != nil {
+		return err
+	}
+	go a.keys.Run(ctx, keySyncInterval, a.log)
+	go a.pruneSessions(ctx, time.Hour)
+	return a.api.Serve(a.listenAddress)
 }
 
-func (a *App) Run() {
-	a.api.Serve(a.listenAddress)
+// pruneSessions deletes expired sessions and revocations every interval
+// until ctx is cancelled.
+func (a *App) pruneSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := a.users.Prune(ctx); err != nil {
+				a.log.ErrorContext(ctx, "pruning sessions failed", "error", err)
+			}
+		}
+	}
 }
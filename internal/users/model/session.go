@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is one login of a user. It holds the hash of the only refresh
+// token that may currently be exchanged; every exchange rotates it.
+type Session struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;index;not null" json:"user_id"`
+	// RefreshHash is the SHA-256 of the current refresh token secret.
+	RefreshHash string `gorm:"not null" json:"-"`
+	// AccessJTI is the jti of the latest access token, the only one of the
+	// session not revoked.
+	AccessJTI       string    `gorm:"not null" json:"-"`
+	AccessExpiresAt time.Time `json:"-"`
+	ExpiresAt       time.Time `gorm:"not null" json:"expires_at"`
+	// MFAAt is when the user last passed two-factor authentication in the
+	// session, at login or stepping up.
+	MFAAt     *time.Time `json:"mfa_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// RotatedRefreshToken remembers a refresh token secret a session has
+// rotated away from, until the secret would have expired. Presenting one
+// again means the token leaked.
+type RotatedRefreshToken struct {
+	// Hash is the SHA-256 of the rotated secret.
+	Hash      string    `gorm:"primaryKey"`
+	SessionID uuid.UUID `gorm:"type:uuid;index;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
+
+// RevokedToken denies an access token before it expires. Services that
+// verify access tokens fetch these to reject revoked ones.
+type RevokedToken struct {
+	JTI    string    `gorm:"primaryKey" json:"jti"`
+	UserID uuid.UUID `gorm:"type:uuid;not null" json:"-"`
+	// ExpiresAt is when the token expires anyway; the entry is dropped then.
+	ExpiresAt time.Time `gorm:"index;not null" json:"expires_at"`
+	RevokedAt time.Time `gorm:"index;not null" json:"revoked_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// SigningKey is a key pair that signs access tokens. The newest key signs
+// once it has been published long enough for verifiers to have fetched it;
+// older keys stay published until the tokens they signed have expired.
+type SigningKey struct {
+	KID       string `gorm:"column:kid;primaryKey" json:"kid"`
+	Algorithm string `gorm:"not null" json:"alg"`
+	// PrivateKey is the PKCS #8 private key, sealed with AES-GCM.
+	PrivateKey []byte    `gorm:"not null" json:"-"`
+	CreatedAt  time.Time `gorm:"index;not null" json:"created_at"`
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// User is a registered user. Its ID is the subject ("sub") of the JWTs the
+// users service issues, which the accounts service uses as the owner of
+// accounts.
+type User struct {
+	ID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Email string    `gorm:"uniqueIndex;not null" json:"email"`
+	// PasswordHash is an argon2id hash in PHC string format.
+	PasswordHash string `gorm:"not null" json:"-"`
+	// Roles are copied into the "roles" claim, e.g. "admin".
+	Roles pq.StringArray `gorm:"type:text[]" json:"roles"`
+	// TOTPSecret is the sealed TOTP secret. It is pending until the first
+	// code is confirmed, which sets TOTPEnabledAt.
+	TOTPSecret    []byte     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	// TOTPLastStep is the time step of the last accepted code, so that no
+	// code is accepted twice.
+	TOTPLastStep int64 `gorm:"not null;default:0" json:"-"`
+	// MFAFailures counts the second factors rejected in a row, the last at
+	// MFAFailedAt; too many lock verification for a while.
+	MFAFailures int        `gorm:"not null;default:0" json:"-"`
+	MFAFailedAt *time.Time `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// RecoveryCode replaces a TOTP code once, e.g. when the authenticator is
+// lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;index;not null" json:"-"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
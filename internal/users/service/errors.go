@@ -0,0 +1,28 @@
+package service
+
+import "cex/pkg/errors"
+
+var (
+	// ErrInvalidRegistration is returned for sign-ups with a malformed email or a weak password.
+	ErrInvalidRegistration = errors.Invalid.Reason("InvalidRegistration")
+	// ErrEmailTaken is returned when registering an email that already has a user.
+	ErrEmailTaken = errors.Conflict.Reason("EmailTaken").Explain("email is already registered")
+	// ErrInvalidCredentials is returned for logins with an unknown email or a wrong password.
+	ErrInvalidCredentials = errors.Unauthorized.Reason("InvalidCredentials").Explain("invalid email or password")
+	// ErrInvalidToken is returned for tokens that are malformed, expired or not signed by this service.
+	ErrInvalidToken = errors.Unauthorized.Reason("InvalidToken").Explain("invalid or expired token")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is presented again; its session is revoked.
+	ErrRefreshTokenReused = errors.Unauthorized.Reason("RefreshTokenReused").Explain("refresh token was already used, session revoked")
+	// ErrInvalidMFACode is returned for a wrong, expired or already used TOTP or recovery code.
+	ErrInvalidMFACode = errors.Unauthorized.Reason("InvalidMFACode").Explain("invalid two-factor code")
+	// ErrMFALocked is returned while two-factor verification is locked after too many invalid codes.
+	ErrMFALocked = errors.TooManyRequests.Reason("MFALocked").Explain("too many invalid two-factor codes, try again later")
+	// ErrMFANotEnabled is returned when verifying a code of a user without two-factor authentication.
+	ErrMFANotEnabled = errors.Conflict.Reason("MFANotEnabled").Explain("two-factor authentication is not enabled")
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who has two-factor authentication already.
+	ErrMFAAlreadyEnabled = errors.Conflict.Reason("MFAAlreadyEnabled").Explain("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming a TOTP enrollment that was not started.
+	ErrMFANotEnrolled = errors.Conflict.Reason("MFANotEnrolled").Explain("no pending TOTP enrollment")
+	// ErrUserNotFound is returned when a referenced user does not exist.
+	ErrUserNotFound = errors.NotFound.Reason("UserNotFound").Explain("user not found")
+)
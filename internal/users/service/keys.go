@@ -0,0 +1,296 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cex/internal/users/model"
+	"cex/pkg/auth"
+)
+
+// SigningKey is a private key that signs access tokens, identified by the
+// "kid" header of the tokens.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+// GenerateSigningKey generates a key for alg, auth.AlgEdDSA or
+// auth.AlgRS256.
+func GenerateSigningKey(alg string) (SigningKey, error) {
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	switch alg {
+	case auth.AlgEdDSA:
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	case auth.AlgRS256:
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+	return SigningKey{ID: uuid.NewString(), Algorithm: alg, Private: priv, CreatedAt: time.Now()}, nil
+}
+
+func (k SigningKey) method() jwt.SigningMethod {
+	return jwt.GetSigningMethod(k.Algorithm)
+}
+
+// KeySet holds the key that signs access tokens and the older ones that
+// still verify them. The zero value has no keys.
+type KeySet struct {
+	mu     sync.RWMutex
+	signer SigningKey
+	keys   []SigningKey
+}
+
+// NewKeySet returns a set signing with signer that also verifies tokens of
+// the retired keys.
+func NewKeySet(signer SigningKey, retired ...SigningKey) *KeySet {
+	s := &KeySet{}
+	s.set(signer, append([]SigningKey{signer}, retired...))
+	return s
+}
+
+func (s *KeySet) set(signer SigningKey, keys []SigningKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signer = signer
+	s.keys = keys
+}
+
+// Signer returns the key that signs new tokens.
+func (s *KeySet) Signer() (SigningKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.signer.Private == nil {
+		return SigningKey{}, fmt.Errorf("no signing key loaded")
+	}
+	return s.signer, nil
+}
+
+// Key returns the key identified by kid.
+func (s *KeySet) Key(kid string) (SigningKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.ID == kid {
+			return k, true
+		}
+	}
+	return SigningKey{}, false
+}
+
+// JWKS returns the public keys, which verifiers fetch to check tokens.
+func (s *KeySet) JWKS() (auth.JWKS, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := auth.JWKS{Keys: make([]auth.JWK, 0, len(s.keys))}
+	for _, k := range s.keys {
+		jwk, err := auth.NewJWK(k.ID, k.Algorithm, k.Private.Public())
+		if err != nil {
+			return auth.JWKS{}, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// KeyConfig configures the rotation of the signing keys.
+type KeyConfig struct {
+	// Secret encrypts the private keys stored in the database.
+	Secret []byte
+	// Algorithm of new keys, auth.AlgEdDSA by default.
+	Algorithm string
+	// RotateEvery is how often a new key is generated, 30 days by default.
+	RotateEvery time.Duration
+	// PublishDelay is how long a new key is published before it signs, so
+	// that every instance serves it and verifiers can fetch it first. It is
+	// 5 minutes by default.
+	PublishDelay time.Duration
+	// Retain is how long a replaced key keeps verifying. It must cover the
+	// lifetime of the access tokens; the app defaults it to that.
+	Retain time.Duration
+}
+
+// KeyStore keeps the signing keys in the database, shared by every
+// instance, and rotates them.
+type KeyStore struct {
+	db     *gorm.DB
+	cfg    KeyConfig
+	sealer *sealer
+	keys   *KeySet
+	now    func() time.Time
+}
+
+// NewKeyStore returns a store that loads its keys into keys. Call Sync
+// before issuing tokens.
+func NewKeyStore(db *gorm.DB, cfg KeyConfig, keys *KeySet) (*KeyStore, error) {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = auth.AlgEdDSA
+	}
+	if cfg.Algorithm != auth.AlgEdDSA && cfg.Algorithm != auth.AlgRS256 {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+	if cfg.RotateEvery <= 0 {
+		cfg.RotateEvery = 30 * 24 * time.Hour
+	}
+	if cfg.PublishDelay <= 0 {
+		cfg.PublishDelay = 5 * time.Minute
+	}
+	sealer, err := newSealer(cfg.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyStore{db: db, cfg: cfg, sealer: sealer, keys: keys, now: time.Now}, nil
+}
+
+// Sync loads the stored keys, generating a key when there is none or the
+// newest is due for rotation, and deleting the keys that no longer verify
+// any unexpired token.
+func (s *KeyStore) Sync(ctx context.Context) error {
+	return s.sync(ctx, false)
+}
+
+// Rotate generates a new key, which signs once PublishDelay has passed.
+func (s *KeyStore) Rotate(ctx context.Context) error {
+	return s.sync(ctx, true)
+}
+
+func (s *KeyStore) sync(ctx context.Context, rotate bool) error {
+	now := s.now()
+	var rows []model.SigningKey
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Locks out the other instances syncing at the same time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Order("created_at").Find(&rows).Error; err != nil {
+			return err
+		}
+
+		if n := len(rows); rotate || n == 0 || rows[n-1].Algorithm != s.cfg.Algorithm ||
+			!now.Before(rows[n-1].CreatedAt.Add(s.cfg.RotateEvery)) {
+			row, err := s.generate(now)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&row).Error; err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+
+		// A key is dropped once its successor has signed for Retain
+		var expired []string
+		kept := rows[:0]
+		for i, row := range rows {
+			if i+1 < len(rows) && now.After(rows[i+1].CreatedAt.Add(s.cfg.PublishDelay+s.cfg.Retain)) {
+				expired = append(expired, row.KID)
+				continue
+			}
+			kept = append(kept, row)
+		}
+		rows = kept
+		if len(expired) > 0 {
+			return tx.Where("kid IN ?", expired).Delete(&model.SigningKey{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sync signing keys: %w", err)
+	}
+
+	keys := make([]SigningKey, 0, len(rows))
+	for _, row := range rows {
+		key, err := s.open(row)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, key)
+	}
+
+	// The newest published key signs; right after the first key is
+	// generated there is none yet and the oldest one does
+	signer := keys[0]
+	for _, k := range keys {
+		if !k.CreatedAt.After(now.Add(-s.cfg.PublishDelay)) {
+			signer = k
+		}
+	}
+	s.keys.set(signer, keys)
+	return nil
+}
+
+// Run syncs the keys every interval until ctx is cancelled, picking up the
+// keys rotated by other instances.
+func (s *KeyStore) Run(ctx context.Context, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+				log.ErrorContext(ctx, "syncing signing keys failed", "error", err)
+			}
+		}
+	}
+}
+
+// generate returns a new key with its private key sealed.
+func (s *KeyStore) generate(now time.Time) (model.SigningKey, error) {
+	key, err := GenerateSigningKey(s.cfg.Algorithm)
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+	sealed, err := s.sealer.seal(der, key.ID)
+	if err != nil {
+		return model.SigningKey{}, err
+	}
+	return model.SigningKey{
+		KID:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: sealed,
+		CreatedAt:  now,
+	}, nil
+}
+
+// open decrypts a stored key.
+func (s *KeyStore) open(row model.SigningKey) (SigningKey, error) {
+	der, err := s.sealer.open(row.PrivateKey, row.KID)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("signing key %s: %w", row.KID, err)
+	}
+	priv, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("parse signing key %s: %w", row.KID, err)
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return SigningKey{}, fmt.Errorf("signing key %s: unsupported key type %T", row.KID, priv)
+	}
+	return SigningKey{ID: row.KID, Algorithm: row.Algorithm, Private: signer, CreatedAt: row.CreatedAt}, nil
+}
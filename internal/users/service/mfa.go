@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cex/internal/users/model"
+	"cex/pkg/errors"
+)
+
+// MFAConfig configures two-factor authentication.
+type MFAConfig struct {
+	// Secret encrypts the TOTP secrets stored in the database.
+	Secret []byte
+	// Issuer names the accounts in authenticator apps, "CEX" by default.
+	Issuer string
+}
+
+const (
+	// maxMFAFailures second factors may be rejected in a row before
+	// verification is locked for mfaLockout.
+	maxMFAFailures = 5
+	mfaLockout     = 15 * time.Minute
+	// recoveryCodeCount codes are generated at once.
+	recoveryCodeCount = 10
+)
+
+// TOTPEnrollment is a pending TOTP secret, to add to an authenticator app
+// and confirm with a code.
+type TOTPEnrollment struct {
+	// Secret is base32 encoded, for apps that cannot scan the URI.
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// RecoveryCodes replace a TOTP code once each. They are only shown when
+// generated.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// MFAChallenge is what a login returns instead of tokens for users with
+// two-factor authentication. CompleteLogin exchanges its token and a code
+// for tokens.
+type MFAChallenge struct {
+	MFAToken string `json:"mfa_token"`
+	// ExpiresIn is the lifetime of the token in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// LoginResult holds the tokens of a login or, for users with two-factor
+// authentication, its challenge.
+type LoginResult struct {
+	*Tokens
+	MFA *MFAChallenge `json:"mfa,omitempty"`
+}
+
+// EnrollTOTP generates a TOTP secret for userID, replacing a pending one.
+// It takes effect once confirmed with ConfirmTOTP.
+func (s *UserService) EnrollTOTP(ctx context.Context, userID uuid.UUID) (TOTPEnrollment, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if user.TOTPEnabledAt != nil {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	sealed, err := s.sealer.seal(secret, totpAD(userID))
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	res := s.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND totp_enabled_at IS NULL", userID).
+		Update("totp_secret", sealed)
+	if res.Error != nil {
+		return TOTPEnrollment{}, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return TOTPEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	return TOTPEnrollment{
+		Secret: base32NoPadding.EncodeToString(secret),
+		URI:    TOTPURI(s.mfa.Issuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables the pending TOTP secret of userID if code is valid
+// and returns the first recovery codes.
+func (s *UserService) ConfirmTOTP(ctx context.Context, userID uuid.UUID, code string) (RecoveryCodes, error) {
+	var codes RecoveryCodes
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt != nil {
+			return ErrMFAAlreadyEnabled
+		}
+		if len(user.TOTPSecret) == 0 {
+			return ErrMFANotEnrolled
+		}
+		secret, err := s.sealer.open(user.TOTPSecret, totpAD(userID))
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		step, ok := matchTOTP(secret, normalizeCode(code), now, 0)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		if err := tx.Model(&user).Updates(map[string]any{
+			"totp_enabled_at": now,
+			"totp_last_step":  step,
+			"mfa_failures":    0,
+		}).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP turns off two-factor authentication of userID, which takes a
+// valid code, and deletes its recovery codes.
+func (s *UserService) DisableTOTP(ctx context.Context, userID uuid.UUID, code string) error {
+	return s.withSecondFactor(ctx, userID, code, func(tx *gorm.DB, user model.User, _ time.Time) error {
+		if err := tx.Model(&user).Updates(map[string]any{
+			"totp_secret":     nil,
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of userID, which
+// takes a valid code.
+func (s *UserService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) (RecoveryCodes, error) {
+	var codes RecoveryCodes
+	err := s.withSecondFactor(ctx, userID, code, func(tx *gorm.DB, _ model.User, _ time.Time) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// CompleteLogin exchanges the token of a login challenge and a TOTP or
+// recovery code for the tokens of a session that passed two-factor
+// authentication.
+func (s *UserService) CompleteLogin(ctx context.Context, mfaToken, code string) (Tokens, error) {
+	claims, err := s.tokens.ParseMFA(mfaToken)
+	if err != nil {
+		return Tokens{}, ErrInvalidToken
+	}
+	userID := uuid.MustParse(claims.Subject)
+
+	var tokens Tokens
+	err = s.withSecondFactor(ctx, userID, code, func(tx *gorm.DB, user model.User, now time.Time) error {
+		var err error
+		tokens, err = s.startSession(tx, user, &now)
+		return err
+	})
+	return tokens, err
+}
+
+// StepUp records that the user of session sid passed two-factor
+// authentication now and rotates the session tokens, so that the new
+// access token carries it.
+func (s *UserService) StepUp(ctx context.Context, userID, sid uuid.UUID, code string) (Tokens, error) {
+	var tokens Tokens
+	err := s.withSecondFactor(ctx, userID, code, func(tx *gorm.DB, user model.User, now time.Time) error {
+		var session model.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sid, userID).
+			Take(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&session).Update("mfa_at", now).Error; err != nil {
+			return err
+		}
+		session.MFAAt = &now
+		tokens, err = s.rotateSession(tx, now, session, user)
+		return err
+	})
+	return tokens, err
+}
+
+// withSecondFactor checks code, a TOTP or recovery code of userID, and runs
+// fn in the same transaction if it is valid. Rejected codes are counted,
+// and verification is locked after maxMFAFailures in a row.
+func (s *UserService) withSecondFactor(ctx context.Context, userID uuid.UUID, code string, fn func(tx *gorm.DB, user model.User, now time.Time) error) error {
+	rejected := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := lockUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return ErrMFANotEnabled
+		}
+		now := time.Now()
+		failures := user.MFAFailures
+		if user.MFAFailedAt == nil || !now.Before(user.MFAFailedAt.Add(mfaLockout)) {
+			failures = 0
+		}
+		if failures >= maxMFAFailures {
+			return ErrMFALocked
+		}
+
+		ok, err := s.checkSecondFactor(tx, &user, normalizeCode(code), now)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			// Committed so the failure counts although the call fails
+			rejected = true
+			return tx.Model(&user).Updates(map[string]any{
+				"mfa_failures":  failures + 1,
+				"mfa_failed_at": now,
+			}).Error
+		}
+		if user.MFAFailures > 0 {
+			if err := tx.Model(&user).Update("mfa_failures", 0).Error; err != nil {
+				return err
+			}
+		}
+		return fn(tx, user, now)
+	})
+	if err != nil {
+		return err
+	}
+	if rejected {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// checkSecondFactor reports whether code is the current TOTP code of user
+// or one of its unused recovery codes, and consumes it.
+func (s *UserService) checkSecondFactor(tx *gorm.DB, user *model.User, code string, now time.Time) (bool, error) {
+	if len(code) == totpDigits {
+		secret, err := s.sealer.open(user.TOTPSecret, totpAD(user.ID))
+		if err != nil {
+			return false, err
+		}
+		step, ok := matchTOTP(secret, code, now, user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+		user.TOTPLastStep = step
+		return true, tx.Model(user).Update("totp_last_step", step).Error
+	}
+
+	res := tx.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// replaceRecoveryCodes deletes the recovery codes of userID and generates
+// new ones.
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) (RecoveryCodes, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return RecoveryCodes{}, err
+	}
+	codes := RecoveryCodes{Codes: make([]string, recoveryCodeCount)}
+	rows := make([]model.RecoveryCode, recoveryCodeCount)
+	for i := range rows {
+		code, hash, err := newRecoveryCode()
+		if err != nil {
+			return RecoveryCodes{}, err
+		}
+		codes.Codes[i] = code
+		rows[i] = model.RecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hash}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return RecoveryCodes{}, err
+	}
+	return codes, nil
+}
+
+func lockUser(tx *gorm.DB, userID uuid.UUID) (model.User, error) {
+	var user model.User
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", userID).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+// totpAD binds a sealed TOTP secret to its user.
+func totpAD(userID uuid.UUID) string {
+	return "totp:" + userID.String()
+}
+
+// normalizeCode drops the spaces authenticator apps show in codes.
+func normalizeCode(code string) string {
+	return strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+}
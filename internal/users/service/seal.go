@@ -0,0 +1,53 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+)
+
+// sealer encrypts the secrets stored in the database with AES-GCM, keyed
+// by the SHA-256 of the configured secret. The additional data binds a
+// ciphertext to its row, so it cannot be copied to another one.
+type sealer struct {
+	aead cipher.AEAD
+}
+
+func newSealer(secret []byte) (*sealer, error) {
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("encryption secret is required")
+	}
+	key := sha256.Sum256(secret)
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &sealer{aead: aead}, nil
+}
+
+// seal returns the nonce followed by the ciphertext.
+func (s *sealer) seal(plaintext []byte, ad string) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(ad)), nil
+}
+
+func (s *sealer) open(sealed []byte, ad string) ([]byte, error) {
+	n := s.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("sealed value is truncated")
+	}
+	plaintext, err := s.aead.Open(nil, sealed[:n], sealed[n:], []byte(ad))
+	if err != nil {
+		return nil, fmt.Errorf("decrypt (was the secret changed?): %w", err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"cex/internal/users/model"
+	"cex/pkg/auth"
+	"cex/pkg/errors"
+)
+
+// Refresh tokens are opaque: "<session id>.<secret>". Only the hash of the
+// secret is stored, and it changes on every refresh. The hashes of rotated
+// secrets are kept to tell reuse from guessing.
+
+func newRefreshSecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashRefreshSecret(secret), nil
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func parseRefreshToken(token string) (uuid.UUID, string, bool) {
+	sid, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return uuid.Nil, "", false
+	}
+	id, err := uuid.Parse(sid)
+	return id, secret, err == nil
+}
+
+// startSession opens a session for user and issues its first tokens.
+// mfaAt is when the user passed two-factor authentication, if they did.
+func (s *UserService) startSession(db *gorm.DB, user model.User, mfaAt *time.Time) (Tokens, error) {
+	secret, hash, err := newRefreshSecret()
+	if err != nil {
+		return Tokens{}, err
+	}
+	now := time.Now()
+	session := model.Session{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		RefreshHash: hash,
+		ExpiresAt:   now.Add(s.tokens.RefreshTTL()),
+		MFAAt:       mfaAt,
+		CreatedAt:   now,
+	}
+	access, claims, err := s.tokens.IssueAccess(user, session)
+	if err != nil {
+		return Tokens{}, err
+	}
+	session.AccessJTI = claims.ID
+	session.AccessExpiresAt = claims.ExpiresAt.Time
+	if err := db.Create(&session).Error; err != nil {
+		return Tokens{}, err
+	}
+	return s.tokenPair(access, session.ID, secret), nil
+}
+
+func (s *UserService) tokenPair(access string, sid uuid.UUID, secret string) Tokens {
+	return Tokens{
+		AccessToken:  access,
+		RefreshToken: sid.String() + "." + secret,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(s.tokens.cfg.AccessTTL.Seconds()),
+	}
+}
+
+// Refresh exchanges a refresh token for a new pair and rotates it: the
+// presented token and the previous access token stop working. Presenting a
+// refresh token that was already rotated means it leaked, so the whole
+// session is revoked and ErrRefreshTokenReused returned. Any other secret is
+// rejected without side effects: session IDs are no secret, they are the sid
+// claim of every access token.
+func (s *UserService) Refresh(ctx context.Context, refreshToken string) (Tokens, error) {
+	sid, secret, ok := parseRefreshToken(refreshToken)
+	if !ok {
+		return Tokens{}, ErrInvalidToken
+	}
+
+	var tokens Tokens
+	reused := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session model.Session
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", sid).Take(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if session.RevokedAt != nil || !now.Before(session.ExpiresAt) {
+			return ErrInvalidToken
+		}
+		hash := hashRefreshSecret(secret)
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(session.RefreshHash)) != 1 {
+			var n int64
+			if err := tx.Model(&model.RotatedRefreshToken{}).
+				Where("hash = ? AND session_id = ?", hash, session.ID).
+				Count(&n).Error; err != nil {
+				return err
+			}
+			if n == 0 {
+				return ErrInvalidToken
+			}
+			// Committed so the revocation sticks although Refresh fails
+			reused = true
+			return revokeSessions(tx, now, session)
+		}
+
+		var user model.User
+		err = tx.Where("id = ?", session.UserID).Take(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		if err != nil {
+			return err
+		}
+
+		tokens, err = s.rotateSession(tx, now, session, user)
+		return err
+	})
+	if err != nil {
+		return Tokens{}, err
+	}
+	if reused {
+		return Tokens{}, ErrRefreshTokenReused
+	}
+	return tokens, nil
+}
+
+// rotateSession issues a new token pair of session, revoking the previous
+// one.
+func (s *UserService) rotateSession(tx *gorm.DB, now time.Time, session model.Session, user model.User) (Tokens, error) {
+	secret, hash, err := newRefreshSecret()
+	if err != nil {
+		return Tokens{}, err
+	}
+	access, claims, err := s.tokens.IssueAccess(user, session)
+	if err != nil {
+		return Tokens{}, err
+	}
+	if err := denyAccessToken(tx, now, session); err != nil {
+		return Tokens{}, err
+	}
+	if err := tx.Create(&model.RotatedRefreshToken{
+		Hash:      session.RefreshHash,
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+	}).Error; err != nil {
+		return Tokens{}, err
+	}
+	if err := tx.Model(&session).Updates(map[string]any{
+		"refresh_hash":      hash,
+		"access_jti":        claims.ID,
+		"access_expires_at": claims.ExpiresAt.Time,
+		"expires_at":        now.Add(s.tokens.RefreshTTL()),
+	}).Error; err != nil {
+		return Tokens{}, err
+	}
+	return s.tokenPair(access, session.ID, secret), nil
+}
+
+// Logout revokes session sid of userID. Logging out of a session that is
+// already revoked is a no-op.
+func (s *UserService) Logout(ctx context.Context, userID, sid uuid.UUID) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sessions []model.Session
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sid, userID).
+			Find(&sessions).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, time.Now(), sessions...)
+	})
+}
+
+// LogoutAll revokes every session of userID and returns how many were
+// active.
+func (s *UserService) LogoutAll(ctx context.Context, userID uuid.UUID) (int, error) {
+	var sessions []model.Session
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Find(&sessions).Error; err != nil {
+			return err
+		}
+		return revokeSessions(tx, time.Now(), sessions...)
+	})
+	return len(sessions), err
+}
+
+// revokeSessions marks sessions revoked and denies their access tokens.
+func revokeSessions(tx *gorm.DB, now time.Time, sessions ...model.Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	ids := make([]uuid.UUID, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+		if err := denyAccessToken(tx, now, session); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&model.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error
+}
+
+// denyAccessToken adds the current access token of session to the denylist
+// unless it has expired already.
+func denyAccessToken(tx *gorm.DB, now time.Time, session model.Session) error {
+	if !now.Before(session.AccessExpiresAt) {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&model.RevokedToken{
+		JTI:       session.AccessJTI,
+		UserID:    session.UserID,
+		ExpiresAt: session.AccessExpiresAt,
+		RevokedAt: now,
+	}).Error
+}
+
+// IsRevoked reports whether the access token with the given jti was revoked.
+func (s *UserService) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var n int64
+	err := s.db.WithContext(ctx).Model(&model.RevokedToken{}).Where("jti = ?", jti).Count(&n).Error
+	return n > 0, err
+}
+
+// Revocations lists the unexpired revocations made after since, oldest
+// first, for services that verify access tokens.
+func (s *UserService) Revocations(ctx context.Context, since time.Time) ([]auth.Revocation, error) {
+	var rows []model.RevokedToken
+	if err := s.db.WithContext(ctx).
+		Where("revoked_at > ? AND expires_at > ?", since, time.Now()).
+		Order("revoked_at").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]auth.Revocation, len(rows))
+	for i, r := range rows {
+		out[i] = auth.Revocation{JTI: r.JTI, ExpiresAt: r.ExpiresAt, RevokedAt: r.RevokedAt}
+	}
+	return out, nil
+}
+
+// Prune deletes expired sessions, the rotated secrets of expired sessions
+// and revocations of expired tokens.
+func (s *UserService) Prune(ctx context.Context) error {
+	now := time.Now()
+	db := s.db.WithContext(ctx)
+	if err := db.Where("expires_at < ?", now).Delete(&model.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("expires_at < ?", now).Delete(&model.RotatedRefreshToken{}).Error; err != nil {
+		return err
+	}
+	return db.Where("expires_at < ?", now).Delete(&model.Session{}).Error
+}
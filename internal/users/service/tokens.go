@@ -0,0 +1,187 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+
+	"cex/internal/users/model"
+	"cex/pkg/auth"
+)
+
+// Values of the "token_use" claim. MFA tokens stand for a login waiting for
+// its second factor.
+const (
+	TokenUseAccess = auth.TokenUseAccess
+	TokenUseMFA    = "mfa"
+)
+
+// mfaTokenTTL is how long a login may wait for its second factor.
+const mfaTokenTTL = 5 * time.Minute
+
+// TokenConfig configures JWT issuance.
+type TokenConfig struct {
+	// Issuer is the "iss" claim, "users" by default.
+	Issuer string
+	// AccessTTL is 15 minutes and RefreshTTL 30 days by default.
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+}
+
+// Claims are the claims of the access tokens the users service issues.
+// Subject is the user UUID and SessionID the session that issued it.
+type Claims struct {
+	jwt.RegisteredClaims
+	TokenUse  string   `json:"token_use"`
+	SessionID string   `json:"sid,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	// AMR lists how the user authenticated, with auth.AMROTP once past two-
+	// factor authentication, which AuthTime is the time of. Without it,
+	// AuthTime is the login.
+	AMR      []string         `json:"amr,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// Tokens is what a successful login returns.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	// ExpiresIn is the lifetime of the access token in seconds.
+	ExpiresIn int `json:"expires_in"`
+}
+
+// TokenIssuer signs and verifies access tokens with the keys of a KeySet.
+// Tokens carry the ID of their key in the "kid" header, so verifiers pick
+// the matching key of the published JWKS.
+type TokenIssuer struct {
+	cfg  TokenConfig
+	keys *KeySet
+	now  func() time.Time
+}
+
+// NewTokenIssuer applies the defaults of cfg.
+func NewTokenIssuer(cfg TokenConfig, keys *KeySet) (*TokenIssuer, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("signing keys are required")
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = "users"
+	}
+	if cfg.AccessTTL <= 0 {
+		cfg.AccessTTL = 15 * time.Minute
+	}
+	if cfg.RefreshTTL <= 0 {
+		cfg.RefreshTTL = 30 * 24 * time.Hour
+	}
+	return &TokenIssuer{cfg: cfg, keys: keys, now: time.Now}, nil
+}
+
+// AccessTTL is the lifetime of access tokens.
+func (i *TokenIssuer) AccessTTL() time.Duration {
+	return i.cfg.AccessTTL
+}
+
+// RefreshTTL is how long a session lasts without being refreshed.
+func (i *TokenIssuer) RefreshTTL() time.Duration {
+	return i.cfg.RefreshTTL
+}
+
+// IssueAccess signs an access token of session for u.
+func (i *TokenIssuer) IssueAccess(u model.User, session model.Session) (string, Claims, error) {
+	now := i.now()
+	amr, authTime := []string{auth.AMRPassword}, session.CreatedAt
+	if session.MFAAt != nil {
+		amr, authTime = append(amr, auth.AMROTP), *session.MFAAt
+	}
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    i.cfg.Issuer,
+			Subject:   u.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(i.cfg.AccessTTL)),
+		},
+		TokenUse:  TokenUseAccess,
+		SessionID: session.ID.String(),
+		Email:     u.Email,
+		Roles:     u.Roles,
+		AMR:       amr,
+		AuthTime:  jwt.NewNumericDate(authTime),
+	}
+	token, err := i.sign(claims)
+	if err != nil {
+		return "", Claims{}, err
+	}
+	return token, claims, nil
+}
+
+// IssueMFA signs the token of a login of u waiting for its second factor.
+func (i *TokenIssuer) IssueMFA(u model.User) (string, error) {
+	now := i.now()
+	return i.sign(Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    i.cfg.Issuer,
+			Subject:   u.ID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(mfaTokenTTL)),
+		},
+		TokenUse: TokenUseMFA,
+		AMR:      []string{auth.AMRPassword},
+	})
+}
+
+func (i *TokenIssuer) sign(claims Claims) (string, error) {
+	key, err := i.keys.Signer()
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwt.NewWithClaims(key.method(), claims)
+	unsigned.Header["kid"] = key.ID
+	return unsigned.SignedString(key.Private)
+}
+
+// ParseAccess verifies an access token and returns its claims. It does not
+// check revocation.
+func (i *TokenIssuer) ParseAccess(token string) (*Claims, error) {
+	return i.parse(token, TokenUseAccess)
+}
+
+// ParseMFA verifies the token of a login waiting for its second factor.
+func (i *TokenIssuer) ParseMFA(token string) (*Claims, error) {
+	return i.parse(token, TokenUseMFA)
+}
+
+func (i *TokenIssuer) parse(token, use string) (*Claims, error) {
+	claims := &Claims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(auth.Algorithms))
+	if _, err := parser.ParseWithClaims(token, claims, i.keyfunc); err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != use {
+		return nil, fmt.Errorf("token_use is %q, want %q", claims.TokenUse, use)
+	}
+	if claims.Issuer != i.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, fmt.Errorf("invalid subject: %w", err)
+	}
+	return claims, nil
+}
+
+func (i *TokenIssuer) keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := i.keys.Key(kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.Algorithm, token.Method.Alg())
+	}
+	return key.Private.Public(), nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238). These are the defaults of authenticator apps,
+// some of which ignore the parameters of the URI.
+const (
+	totpDigits = 6
+	// totpModulus is 10^totpDigits.
+	totpModulus = 1_000_000
+	totpPeriod  = 30 * time.Second
+	// totpSkew also accepts the codes of the adjacent time steps, for
+	// clocks that drift and codes typed at the end of their step.
+	totpSkew = 1
+	// totpSecretLength is 160 bits, as recommended for HMAC-SHA1.
+	totpSecretLength = 20
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretLength)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// TOTPURI returns the otpauth:// URI of secret, which authenticator apps
+// import from a QR code.
+func TOTPURI(issuer, account string, secret []byte) string {
+	q := url.Values{}
+	q.Set("secret", base32NoPadding.EncodeToString(secret))
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod.Seconds())
+}
+
+// TOTPCode returns the code of secret at t.
+func TOTPCode(secret []byte, t time.Time) string {
+	return hotp(secret, totpStep(t))
+}
+
+// hotp is the HMAC-based one-time password of counter (RFC 4226).
+func hotp(secret []byte, counter int64) string {
+	mac := hmac.New(sha1.New, secret)
+	_ = binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%totpModulus)
+}
+
+// matchTOTP returns the time step of code if it is valid at now. Steps up
+// to after are refused, so an accepted code cannot be replayed.
+func matchTOTP(secret []byte, code string, now time.Time, after int64) (int64, bool) {
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= after {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hotp(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// Recovery codes are ten random base32 characters, shown as "xxxxx-xxxxx".
+// Only their SHA-256 is stored; 50 bits are plenty for single-use codes
+// behind a lockout.
+
+func newRecoveryCode() (code, hash string, err error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	raw := strings.ToLower(base32NoPadding.EncodeToString(b))[:10]
+	return raw[:5] + "-" + raw[5:], hashRecoveryCode(raw), nil
+}
+
+// hashRecoveryCode hashes a code the way it was typed: case, spaces and
+// dashes do not matter.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"net/mail"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+
+	"cex/internal/users/model"
+	"cex/pkg/errors"
+)
+
+// Password length bounds, in characters.
+const (
+	MinPasswordLength = 10
+	MaxPasswordLength = 128
+)
+
+// UserService registers users and authenticates them.
+type UserService struct {
+	db      *gorm.DB
+	tokens  *TokenIssuer
+	hashing Argon2Params
+	mfa     MFAConfig
+	sealer  *sealer
+
+	// dummyHash is verified against when the email is unknown, so that a
+	// failed login takes as long whether or not the user exists.
+	dummyOnce sync.Once
+	dummyHash string
+}
+
+// NewUserService returns a service storing users in db. Zero hashing
+// parameters use DefaultArgon2Params.
+func NewUserService(db *gorm.DB, tokens *TokenIssuer, hashing Argon2Params, mfa MFAConfig) (*UserService, error) {
+	if mfa.Issuer == "" {
+		mfa.Issuer = "CEX"
+	}
+	sealer, err := newSealer(mfa.Secret)
+	if err != nil {
+		return nil, err
+	}
+	return &UserService{db: db, tokens: tokens, hashing: hashing.withDefaults(), mfa: mfa, sealer: sealer}, nil
+}
+
+// Migrate creates or updates the users tables.
+func (s *UserService) Migrate(ctx context.Context) error {
+	return s.db.WithContext(ctx).AutoMigrate(&model.User{}, &model.RecoveryCode{}, &model.Session{}, &model.RotatedRefreshToken{}, &model.RevokedToken{}, &model.SigningKey{})
+}
+
+// Register creates a user. Emails are compared case-insensitively and must
+// be unique.
+func (s *UserService) Register(ctx context.Context, email, password string) (model.User, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return model.User{}, err
+	}
+	if n := utf8.RuneCountInString(password); n < MinPasswordLength || n > MaxPasswordLength {
+		return model.User{}, ErrInvalidRegistration.Explain("password must be %d to %d characters long", MinPasswordLength, MaxPasswordLength)
+	}
+
+	hash, err := HashPassword(password, s.hashing)
+	if err != nil {
+		return model.User{}, err
+	}
+	user := model.User{
+		ID:           uuid.New(),
+		Email:        email,
+		PasswordHash: hash,
+		Roles:        pq.StringArray{},
+	}
+	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return model.User{}, ErrEmailTaken
+		}
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// Login checks the credentials and opens a session with a token pair. For
+// users with two-factor authentication it returns a challenge instead, to
+// complete with CompleteLogin.
+func (s *UserService) Login(ctx context.Context, email, password string) (LoginResult, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	var user model.User
+	err = s.db.WithContext(ctx).Where("email = ?", email).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		_, _ = VerifyPassword(password, s.dummy())
+		return LoginResult{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	ok, err := VerifyPassword(password, user.PasswordHash)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if !ok {
+		return LoginResult{}, ErrInvalidCredentials
+	}
+
+	if user.TOTPEnabledAt != nil {
+		token, err := s.tokens.IssueMFA(user)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{MFA: &MFAChallenge{MFAToken: token, ExpiresIn: int(mfaTokenTTL.Seconds())}}, nil
+	}
+	tokens, err := s.startSession(s.db.WithContext(ctx), user, nil)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	return LoginResult{Tokens: &tokens}, nil
+}
+
+// GetUser returns the user with the given ID.
+func (s *UserService) GetUser(ctx context.Context, id uuid.UUID) (model.User, error) {
+	var user model.User
+	err := s.db.WithContext(ctx).Where("id = ?", id).Take(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.User{}, ErrUserNotFound
+	}
+	return user, err
+}
+
+func (s *UserService) dummy() string {
+	s.dummyOnce.Do(func() {
+		s.dummyHash, _ = HashPassword("dummy password", s.hashing)
+	})
+	return s.dummyHash
+}
+
+// normalizeEmail trims and lower-cases a bare email address.
+func normalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidRegistration.Explain("invalid email address")
+	}
+	return email, nil
+}
@@ -0,0 +1,12 @@
+package apiutil
+
+import "github.com/google/uuid"
+
+// FundsCommand is the payload of the accounts.credit and accounts.debit
+// commands other services send to the accounts commands topic.
+type FundsCommand struct {
+	AccountID uuid.UUID `json:"account_id"`
+	Asset     string    `json:"asset"`
+	Amount    string    `json:"amount"` // positive decimal as string
+	Reason    string    `json:"reason"` // recorded as the journal reason, e.g. "trade-settlement"
+}
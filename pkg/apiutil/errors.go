@@ -27,20 +27,32 @@ func (e *BadRequestError) Error() string {
 	return e.Message
 }
 
+// ErrorHandler responds with the status of errors built from the
+// errors.Status helpers, which carry it as an errors.StatusCode value. Client
+// errors are written as JSON; server errors are logged and answered without
+// a body.
 func ErrorHandler(slog *slog.Logger) echo.HTTPErrorHandler {
 	return func(err error, c echo.Context) {
-		var statusCode *errors.StatusCode
+		var statusCode errors.StatusCode
 		if errors.As(err, &statusCode) {
-			if *statusCode < http.StatusInternalServerError {
-				c.JSON(int(*statusCode), err)
+			if statusCode < http.StatusInternalServerError {
+				c.JSON(int(statusCode), err)
 				return
 			}
 
 			slog.ErrorContext(c.Request().Context(), err.Error())
-			c.NoContent(int(*statusCode))
+			c.NoContent(int(statusCode))
 			return
 		}
 
+		// Raised by echo itself, e.g. for unknown routes
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) && httpErr.Code < http.StatusInternalServerError {
+			c.JSON(httpErr.Code, httpErr)
+			return
+		}
+
+		slog.ErrorContext(c.Request().Context(), err.Error())
 		c.NoContent(http.StatusInternalServerError)
 	}
 }
@@ -58,6 +70,17 @@ func JSONErrorHandler(err error, c echo.Context) {
 
 // HandleServiceError handles errors returned by the service layer
 func HandleServiceError(c echo.Context, err error) error {
+	// errors.Error values built from the errors.Status helpers carry their HTTP code
+	var svcErr *errors.Error
+	var status errors.StatusCode
+	if errors.As(err, &svcErr) && errors.As(err, &status) && status < http.StatusInternalServerError {
+		msg := svcErr.Message
+		if msg == "" {
+			msg = svcErr.Kind
+		}
+		return c.JSON(int(status), map[string]string{"error": msg, "kind": svcErr.Kind})
+	}
+
 	// Example implementation: map service errors to HTTP responses
 	switch err.(type) {
 	case *BadRequestError:
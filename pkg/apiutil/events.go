@@ -15,19 +15,39 @@ type AccountCreatedEvent struct {
 	Timestamp   time.Time `json:"timestamp"`
 }
 
+// AccountStatusChangedEvent is published when an Account is frozen, unfrozen
+// or closed.
+type AccountStatusChangedEvent struct {
+	EventID   uuid.UUID `json:"event_id"`
+	AccountID uuid.UUID `json:"account_id"`
+	OldStatus string    `json:"old_status"`
+	NewStatus string    `json:"new_status"`
+	Reason    string    `json:"reason"`
+	ActorID   uuid.UUID `json:"actor_id"` // user or operator who changed the status
+	Timestamp time.Time `json:"timestamp"`
+}
+
 // BalanceUpdatedEvent is published when an Account balance changes.
 type BalanceUpdatedEvent struct {
 	EventID    uuid.UUID `json:"event_id"`
 	AccountID  uuid.UUID `json:"account_id"`
+	Asset      string    `json:"asset"`
 	OldBalance string    `json:"old_balance"` // decimal as string
 	NewBalance string    `json:"new_balance"`
 	Delta      string    `json:"delta"`
-	Reason     string    `json:"reason"` // e.g. "credit", "debit"
-	Timestamp  time.Time `json:"timestamp"`
+	Reason     string    `json:"reason"` // journal reason, e.g. "transfer", "deposit"
+	// OperatorID is set for manual adjustments and names the operator who made them.
+	OperatorID *uuid.UUID `json:"operator_id,omitempty"`
+	Timestamp  time.Time  `json:"timestamp"`
 }
 
-// Event represents a generic event structure.
-type Event struct {
-	Type    string      `json:"type"`
-	Payload interface{} `json:"payload"`
+// TransferCompletedEvent is published when funds moved between two accounts.
+type TransferCompletedEvent struct {
+	EventID       uuid.UUID `json:"event_id"`
+	TransferID    uuid.UUID `json:"transfer_id"`
+	FromAccountID uuid.UUID `json:"from_account_id"`
+	ToAccountID   uuid.UUID `json:"to_account_id"`
+	Asset         string    `json:"asset"`
+	Amount        string    `json:"amount"` // decimal as string
+	Timestamp     time.Time `json:"timestamp"`
 }
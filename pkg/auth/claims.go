@@ -0,0 +1,12 @@
+package auth
+
+// TokenUseAccess is the "token_use" claim of the access tokens of the users
+// service. Its other tokens, e.g. login challenges, must not authenticate.
+const TokenUseAccess = "access"
+
+// Authentication methods of the "amr" claim of access tokens (RFC 8176).
+const (
+	AMRPassword = "pwd"
+	// AMROTP is added once the user has passed two-factor authentication.
+	AMROTP = "otp"
+)
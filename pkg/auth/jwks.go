@@ -0,0 +1,229 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// Signing algorithms of user tokens.
+const (
+	AlgEdDSA = "EdDSA"
+	AlgRS256 = "RS256"
+)
+
+// Algorithms lists the supported signing algorithms, for parsers.
+var Algorithms = []string{AlgEdDSA, AlgRS256}
+
+// JWK is a public signing key in JSON Web Key format (RFC 7517). Ed25519
+// keys use the OKP key type (RFC 8037).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set, as served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes pub, an ed25519.PublicKey or *rsa.PublicKey.
+func NewJWK(kid, alg string, pub crypto.PublicKey) (JWK, error) {
+	enc := base64.RawURLEncoding
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		return JWK{KeyType: "OKP", KeyID: kid, Use: "sig", Algorithm: alg, Curve: "Ed25519", X: enc.EncodeToString(pub)}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: alg,
+			N:         enc.EncodeToString(pub.N.Bytes()),
+			E:         enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// PublicKey decodes the key.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	enc := base64.RawURLEncoding
+	switch {
+	case k.KeyType == "OKP" && k.Curve == "Ed25519":
+		x, err := enc.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("key %s: invalid Ed25519 key", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	case k.KeyType == "RSA":
+		n, err := enc.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid modulus: %w", k.KeyID, err)
+		}
+		e, err := enc.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("key %s: invalid exponent", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	default:
+		return nil, fmt.Errorf("key %s: unsupported key type %q", k.KeyID, k.KeyType)
+	}
+}
+
+// jwksMinRefresh rate-limits the refetches triggered by unknown key IDs.
+const jwksMinRefresh = 10 * time.Second
+
+type verificationKey struct {
+	alg string
+	pub crypto.PublicKey
+}
+
+// JWKSCache verifies user tokens with the keys published by the users
+// service. Keys are selected by the "kid" token header; a kid that is not
+// cached triggers a refetch, so keys rotated in are picked up right away.
+type JWKSCache struct {
+	url    string
+	client *http.Client
+
+	// fetchMu serializes fetches so a burst of unknown kids fetches once
+	fetchMu sync.Mutex
+	mu      sync.RWMutex
+	keys    map[string]verificationKey
+	fetched time.Time
+}
+
+// NewJWKSCache returns an empty cache of the key set at url. A nil client
+// uses one with a 10s timeout.
+func NewJWKSCache(url string, client *http.Client) *JWKSCache {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &JWKSCache{url: url, client: client, keys: make(map[string]verificationKey)}
+}
+
+// Refresh replaces the cached keys with the published ones, so keys that
+// are no longer published stop verifying.
+func (c *JWKSCache) Refresh(ctx context.Context) error {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	return c.fetch(ctx)
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch jwks: %s", resp.Status)
+	}
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("decode jwks: %w", err)
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			return err
+		}
+		keys[k.KeyID] = verificationKey{alg: k.Algorithm, pub: pub}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keys = keys
+	c.fetched = time.Now()
+	return nil
+}
+
+// Keyfunc returns the key that signed token, for jwt.Parse. The token
+// algorithm must be the one published for its key.
+func (c *JWKSCache) Keyfunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no kid")
+	}
+	key, ok := c.lookup(kid)
+	if !ok {
+		c.refetch()
+		if key, ok = c.lookup(kid); !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+	if token.Method.Alg() != key.alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, key.alg, token.Method.Alg())
+	}
+	return key.pub, nil
+}
+
+func (c *JWKSCache) lookup(kid string) (verificationKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// refetch fetches the key set unless that happened within jwksMinRefresh.
+func (c *JWKSCache) refetch() {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	c.mu.RLock()
+	recent := time.Since(c.fetched) < jwksMinRefresh
+	c.mu.RUnlock()
+	if recent {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.fetch(ctx); err != nil {
+		// Not retried before jwksMinRefresh either
+		c.mu.Lock()
+		c.fetched = time.Now()
+		c.mu.Unlock()
+	}
+}
+
+// Run refreshes the keys every interval until ctx is cancelled.
+func (c *JWKSCache) Run(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("refreshing jwks failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Package auth holds what services need to trust the access tokens issued
+// by the users service.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Revocation denies one access token, by jti, until it expires.
+type Revocation struct {
+	JTI       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// RevocationList is the body of the users service revocations endpoint.
+type RevocationList struct {
+	Revocations []Revocation `json:"revocations"`
+}
+
+// revocationOverlap re-reads revocations this far behind the latest one
+// seen, so that entries committed late with an earlier timestamp are not
+// missed.
+const revocationOverlap = time.Minute
+
+// Denylist caches the revoked access tokens published by the users service.
+// It fails open: while the endpoint is unreachable the cached entries keep
+// being enforced but new revocations are not seen.
+type Denylist struct {
+	url    string
+	client *http.Client
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+	since   time.Time
+}
+
+// NewDenylist returns an empty denylist polling url, the revocations
+// endpoint of the users service. A nil client uses one with a 10s timeout.
+func NewDenylist(url string, client *http.Client) *Denylist {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Denylist{url: url, client: client, revoked: make(map[string]time.Time)}
+}
+
+// IsRevoked reports whether the token with the given jti was revoked.
+func (d *Denylist) IsRevoked(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	exp, ok := d.revoked[jti]
+	return ok && time.Now().Before(exp)
+}
+
+// Refresh fetches the revocations made since the last refresh and drops
+// entries whose tokens have expired.
+func (d *Denylist) Refresh(ctx context.Context) error {
+	d.mu.RLock()
+	since := d.since
+	d.mu.RUnlock()
+
+	u, err := url.Parse(d.url)
+	if err != nil {
+		return err
+	}
+	if !since.IsZero() {
+		q := u.Query()
+		q.Set("since", since.Add(-revocationOverlap).Format(time.RFC3339Nano))
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch revocations: %s", resp.Status)
+	}
+	var list RevocationList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return fmt.Errorf("decode revocations: %w", err)
+	}
+
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, r := range list.Revocations {
+		d.revoked[r.JTI] = r.ExpiresAt
+		if r.RevokedAt.After(d.since) {
+			d.since = r.RevokedAt
+		}
+	}
+	for jti, exp := range d.revoked {
+		if !now.Before(exp) {
+			delete(d.revoked, jti)
+		}
+	}
+	return nil
+}
+
+// Run refreshes the denylist every interval until ctx is cancelled.
+func (d *Denylist) Run(ctx context.Context, interval time.Duration, log *zap.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := d.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Warn("refreshing token denylist failed", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
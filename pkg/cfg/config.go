@@ -3,6 +3,7 @@ package cfg
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/spf13/viper"
@@ -12,6 +13,10 @@ import (
 type AccountsConfig struct {
 	Port string `mapstructure:"ACCOUNTS_PORT" validate:"required"`
 	DSN  string `mapstructure:"ACCOUNTS_DSN"  validate:"required,url"`
+	// CreditLimits lets account types draw below zero, written as
+	// type:asset=limit items, e.g. "futures:USDT=10000". Empty keeps every
+	// balance non-negative.
+	CreditLimits string `mapstructure:"ACCOUNTS_CREDIT_LIMITS"`
 }
 
 // DBConfig holds the global database connection string.
@@ -32,8 +37,53 @@ type UsersConfig struct {
 	DSN string `mapstructure:"dsn"`
 	// Port is the HTTP port for the users service.
 	Port string `mapstructure:"port"`
-	// JWTSecret is the HMAC secret for signing user JWTs.
-	JWTSecret string `mapstructure:"jwt_secret"`
+	// JWKSURL is the key set verifying user JWTs, e.g.
+	// http://users:3000/.well-known/jwks.json.
+	JWKSURL string `mapstructure:"jwks_url"`
+	// JWKSInterval is how often it is refetched, 5m by default. Tokens
+	// signed by a key not cached yet refetch it right away.
+	JWKSInterval time.Duration `mapstructure:"jwks_interval"`
+	// RevocationURL is the revocations endpoint of the users service, e.g.
+	// http://users:3000/api/v1/auth/revocations. Revoked access tokens are
+	// not rejected when it is empty.
+	RevocationURL string `mapstructure:"revocation_url"`
+	// RevocationInterval is how often it is polled, 10s by default.
+	RevocationInterval time.Duration `mapstructure:"revocation_interval"`
+	// MFAMaxAge is how long after two-factor authentication users may
+	// transfer funds or adjust balances, 15m by default.
+	MFAMaxAge time.Duration `mapstructure:"mfa_max_age"`
+}
+
+// EventsConfig selects where the accounts service publishes its events.
+type EventsConfig struct {
+	// Backend is "kafka" (default) or "file" to append NDJSON to File, e.g.
+	// for offline runs.
+	Backend string `mapstructure:"backend"`
+	// File is the NDJSON file of the file backend.
+	File string `mapstructure:"file"`
+	// Publish tunes the retries and circuit breaker around every publish and
+	// the retries of the command consumer.
+	Publish PublishConfig `mapstructure:"publish"`
+}
+
+// PublishConfig holds the retry policy and circuit breaker settings of every
+// publish, dead-lettered commands included, and the backoff of the command
+// consumer. Zero values fall back to the defaults of the queue package.
+type PublishConfig struct {
+	// MaxAttempts bounds the attempts of a publish, including the first.
+	// Events the outbox relay gives up on are tried again on its next poll.
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	// Jitter is the randomized fraction of each backoff, up to 1.
+	Jitter float64 `mapstructure:"jitter"`
+	// BreakerFailures consecutive failures open the breaker for
+	// BreakerTimeout, after which BreakerMaxRequests trial publishes decide
+	// whether it closes again.
+	BreakerFailures    uint32        `mapstructure:"breaker_failures"`
+	BreakerTimeout     time.Duration `mapstructure:"breaker_timeout"`
+	BreakerMaxRequests uint32        `mapstructure:"breaker_max_requests"`
+	BreakerInterval    time.Duration `mapstructure:"breaker_interval"`
 }
 
 type Config struct {
@@ -45,10 +95,20 @@ type Config struct {
 	Kafka struct {
 		Brokers       []string
 		TopicAccounts string
+		// EventFormat selects the event envelope encoding, "json" (default)
+		// or "protobuf".
+		EventFormat string
+		// TopicCommands carries credit and debit commands from other
+		// services; the consumer is disabled when it is empty.
+		TopicCommands string
+		// TopicCommandsDLQ receives commands that could not be applied.
+		TopicCommandsDLQ string
+		CommandsGroupID  string
 	}
-	DB    DBConfig    `mapstructure:"db"`
-	HTTP  HTTPConfig  `mapstructure:"http"`
-	Users UsersConfig `mapstructure:"users"`
+	Events EventsConfig `mapstructure:"events"`
+	DB     DBConfig     `mapstructure:"db"`
+	HTTP   HTTPConfig   `mapstructure:"http"`
+	Users  UsersConfig  `mapstructure:"users"`
 }
 
 // Cfg is the singleton instance loaded by Init.
@@ -16,10 +16,12 @@ func Status(code int) *Error {
 }
 
 var (
-	Invalid       *Error = Status(http.StatusBadRequest)
-	NotFound      *Error = Status(http.StatusNotFound)
-	Conflict      *Error = Status(http.StatusConflict)
-	BadGateway    *Error = Status(http.StatusBadGateway)
-	Unavailable   *Error = Status(http.StatusServiceUnavailable)
-	Unprocessable *Error = Status(http.StatusUnprocessableEntity)
+	Invalid         *Error = Status(http.StatusBadRequest)
+	Unauthorized    *Error = Status(http.StatusUnauthorized)
+	NotFound        *Error = Status(http.StatusNotFound)
+	Conflict        *Error = Status(http.StatusConflict)
+	BadGateway      *Error = Status(http.StatusBadGateway)
+	Unavailable     *Error = Status(http.StatusServiceUnavailable)
+	Unprocessable   *Error = Status(http.StatusUnprocessableEntity)
+	TooManyRequests *Error = Status(http.StatusTooManyRequests)
 )
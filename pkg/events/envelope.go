@@ -0,0 +1,66 @@
+// Package events defines the envelope every event published to Kafka is
+// wrapped in, and the serializers that encode it.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Envelope carries one event together with the metadata consumers need to
+// route and decode it. Payload is the JSON encoding of the event body;
+// decimals are encoded as strings so that no serializer loses precision.
+type Envelope struct {
+	ID   uuid.UUID `json:"id"`
+	Type string    `json:"type"`
+	// Version is the schema version of Payload for Type. It is bumped on
+	// changes old consumers cannot read, such as removing or retyping a
+	// field; adding optional fields keeps the version.
+	Version       int       `json:"version"`
+	OccurredAt    time.Time `json:"occurred_at"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	// AggregateID is the entity the event belongs to; it is also the Kafka
+	// message key, so all events of an aggregate share a partition.
+	AggregateID uuid.UUID `json:"aggregate_id"`
+	// Sequence numbers the events of an aggregate 1, 2, 3, ... in the order
+	// they happened. It is 0 for events published before sequencing.
+	Sequence uint64          `json:"sequence,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// New wraps payload in an envelope.
+func New(id uuid.UUID, eventType string, version int, occurredAt time.Time, correlationID string, payload any) (Envelope, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return Envelope{
+		ID:            id,
+		Type:          eventType,
+		Version:       version,
+		OccurredAt:    occurredAt.UTC(),
+		CorrelationID: correlationID,
+		Payload:       data,
+	}, nil
+}
+
+// DecodePayload unmarshals the event body into v.
+func (e Envelope) DecodePayload(v any) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+type correlationKey struct{}
+
+// WithCorrelationID returns a context whose events are tagged with id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation id stored in ctx, if any.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"strconv"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Kafka headers describing the envelope, so consumers can route and pick a
+// serializer without decoding the value.
+const (
+	HeaderID            = "event-id"
+	HeaderType          = "event-type"
+	HeaderVersion       = "event-version"
+	HeaderContentType   = "content-type"
+	HeaderCorrelationID = "correlation-id"
+	HeaderAggregateID   = "aggregate-id"
+	HeaderSequence      = "event-sequence"
+)
+
+// Message serializes e with s into a Kafka message keyed by its aggregate,
+// with the envelope headers.
+func Message(e Envelope, s Serializer) (kafka.Message, error) {
+	value, err := s.Marshal(e)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	headers := []kafka.Header{
+		{Key: HeaderID, Value: []byte(e.ID.String())},
+		{Key: HeaderType, Value: []byte(e.Type)},
+		{Key: HeaderVersion, Value: []byte(strconv.Itoa(e.Version))},
+		{Key: HeaderContentType, Value: []byte(s.ContentType())},
+		{Key: HeaderAggregateID, Value: []byte(e.AggregateID.String())},
+	}
+	if e.Sequence > 0 {
+		headers = append(headers, kafka.Header{Key: HeaderSequence, Value: []byte(strconv.FormatUint(e.Sequence, 10))})
+	}
+	if e.CorrelationID != "" {
+		headers = append(headers, kafka.Header{Key: HeaderCorrelationID, Value: []byte(e.CorrelationID)})
+	}
+	return kafka.Message{Key: []byte(e.AggregateID.String()), Value: value, Headers: headers}, nil
+}
+
+// FromMessage decodes the envelope of m using the serializer named by its
+// content-type header. Messages published before envelopes were introduced
+// have no such header; they are returned as an envelope holding the raw
+// value as payload, with Version 0 and no Type.
+func FromMessage(m kafka.Message) (Envelope, error) {
+	contentType, ok := header(m, HeaderContentType)
+	if !ok {
+		return Envelope{Payload: m.Value}, nil
+	}
+	s, err := ForContentType(contentType)
+	if err != nil {
+		return Envelope{}, err
+	}
+	return s.Unmarshal(m.Value)
+}
+
+func header(m kafka.Message, key string) (string, bool) {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,156 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Field numbers of cex.events.v1.Envelope.
+const (
+	fieldID            protowire.Number = 1
+	fieldType          protowire.Number = 2
+	fieldVersion       protowire.Number = 3
+	fieldOccurredAt    protowire.Number = 4
+	fieldCorrelationID protowire.Number = 5
+	fieldPayload       protowire.Number = 6
+	fieldAggregateID   protowire.Number = 7
+	fieldSequence      protowire.Number = 8
+)
+
+// bytesFields are the length-delimited fields of the envelope.
+var bytesFields = map[protowire.Number]bool{
+	fieldID:            true,
+	fieldType:          true,
+	fieldOccurredAt:    true,
+	fieldCorrelationID: true,
+	fieldPayload:       true,
+	fieldAggregateID:   true,
+}
+
+type protobufSerializer struct{}
+
+func (protobufSerializer) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufSerializer) Marshal(e Envelope) ([]byte, error) {
+	var body map[string]any
+	if err := json.Unmarshal(e.Payload, &body); err != nil {
+		return nil, fmt.Errorf("payload must be a JSON object: %w", err)
+	}
+	payload, err := structpb.NewStruct(body)
+	if err != nil {
+		return nil, err
+	}
+	payloadBytes, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	occurredAt, err := proto.Marshal(timestamppb.New(e.OccurredAt))
+	if err != nil {
+		return nil, err
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, fieldID, protowire.BytesType)
+	b = protowire.AppendString(b, e.ID.String())
+	b = protowire.AppendTag(b, fieldType, protowire.BytesType)
+	b = protowire.AppendString(b, e.Type)
+	b = protowire.AppendTag(b, fieldVersion, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(e.Version))
+	b = protowire.AppendTag(b, fieldOccurredAt, protowire.BytesType)
+	b = protowire.AppendBytes(b, occurredAt)
+	if e.CorrelationID != "" {
+		b = protowire.AppendTag(b, fieldCorrelationID, protowire.BytesType)
+		b = protowire.AppendString(b, e.CorrelationID)
+	}
+	b = protowire.AppendTag(b, fieldPayload, protowire.BytesType)
+	b = protowire.AppendBytes(b, payloadBytes)
+	b = protowire.AppendTag(b, fieldAggregateID, protowire.BytesType)
+	b = protowire.AppendString(b, e.AggregateID.String())
+	if e.Sequence > 0 {
+		b = protowire.AppendTag(b, fieldSequence, protowire.VarintType)
+		b = protowire.AppendVarint(b, e.Sequence)
+	}
+	return b, nil
+}
+
+// Unmarshal decodes an envelope, skipping fields added by newer producers.
+func (protobufSerializer) Unmarshal(data []byte) (Envelope, error) {
+	var e Envelope
+	payload := &structpb.Struct{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return Envelope{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		if typ == protowire.VarintType && (num == fieldVersion || num == fieldSequence) {
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return Envelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			if num == fieldVersion {
+				e.Version = int(v)
+			} else {
+				e.Sequence = v
+			}
+			continue
+		}
+		if typ != protowire.BytesType || !bytesFields[num] {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return Envelope{}, protowire.ParseError(n)
+			}
+			data = data[n:]
+			continue
+		}
+
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return Envelope{}, protowire.ParseError(n)
+		}
+		data = data[n:]
+		switch num {
+		case fieldID:
+			id, err := uuid.ParseBytes(v)
+			if err != nil {
+				return Envelope{}, fmt.Errorf("envelope id: %w", err)
+			}
+			e.ID = id
+		case fieldType:
+			e.Type = string(v)
+		case fieldOccurredAt:
+			ts := &timestamppb.Timestamp{}
+			if err := proto.Unmarshal(v, ts); err != nil {
+				return Envelope{}, fmt.Errorf("envelope occurred_at: %w", err)
+			}
+			e.OccurredAt = ts.AsTime()
+		case fieldCorrelationID:
+			e.CorrelationID = string(v)
+		case fieldPayload:
+			if err := proto.Unmarshal(v, payload); err != nil {
+				return Envelope{}, fmt.Errorf("envelope payload: %w", err)
+			}
+		case fieldAggregateID:
+			id, err := uuid.ParseBytes(v)
+			if err != nil {
+				return Envelope{}, fmt.Errorf("envelope aggregate_id: %w", err)
+			}
+			e.AggregateID = id
+		}
+	}
+
+	body, err := json.Marshal(payload.AsMap())
+	if err != nil {
+		return Envelope{}, err
+	}
+	e.Payload = body
+	return e, nil
+}
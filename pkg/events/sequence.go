@@ -0,0 +1,100 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// SequenceStatus classifies an event by its aggregate sequence number.
+type SequenceStatus int
+
+const (
+	// InOrder is the next expected event of the aggregate.
+	InOrder SequenceStatus = iota
+	// Gap means events between the last seen one and this one are missing,
+	// either lost or still to be delivered out of order.
+	Gap
+	// Stale is an event at or below the last seen sequence: a redelivery or
+	// an event that arrived after a later one.
+	Stale
+	// Unsequenced events predate sequencing and cannot be checked.
+	Unsequenced
+)
+
+func (s SequenceStatus) String() string {
+	switch s {
+	case InOrder:
+		return "in_order"
+	case Gap:
+		return "gap"
+	case Stale:
+		return "stale"
+	default:
+		return "unsequenced"
+	}
+}
+
+// SequenceCheck is the result of observing one event.
+type SequenceCheck struct {
+	Status SequenceStatus
+	// Expected is the sequence the aggregate was waiting for.
+	Expected uint64
+	// Got is the sequence of the observed event.
+	Got uint64
+}
+
+// Missing returns how many events were skipped for a Gap.
+func (c SequenceCheck) Missing() uint64 {
+	if c.Status != Gap {
+		return 0
+	}
+	return c.Got - c.Expected
+}
+
+// SequenceTracker detects gaps and out-of-order delivery in the per-aggregate
+// event sequences a consumer sees. It keeps the highest sequence seen per
+// aggregate in memory; consumers that persist their position restore it
+// with Seed. It is safe for concurrent use.
+type SequenceTracker struct {
+	mu   sync.Mutex
+	last map[uuid.UUID]uint64
+}
+
+// NewSequenceTracker returns a tracker that expects every aggregate to start
+// at sequence 1.
+func NewSequenceTracker() *SequenceTracker {
+	return &SequenceTracker{last: make(map[uuid.UUID]uint64)}
+}
+
+// Seed records seq as the last sequence already processed for aggregateID.
+func (t *SequenceTracker) Seed(aggregateID uuid.UUID, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.last[aggregateID] = seq
+}
+
+// Observe checks e against the events seen before it. After a Gap the
+// tracker moves on to e's sequence, so the missing events are reported
+// Stale if they show up later.
+func (t *SequenceTracker) Observe(e Envelope) SequenceCheck {
+	if e.Sequence == 0 {
+		return SequenceCheck{Status: Unsequenced}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := t.last[e.AggregateID]
+	check := SequenceCheck{Expected: last + 1, Got: e.Sequence}
+	switch {
+	case e.Sequence == last+1:
+		check.Status = InOrder
+	case e.Sequence > last+1:
+		check.Status = Gap
+	default:
+		check.Status = Stale
+		return check
+	}
+	t.last[e.AggregateID] = e.Sequence
+	return check
+}
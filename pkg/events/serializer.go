@@ -0,0 +1,66 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Content types of the serialized envelope, sent in the content-type header.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Serializer encodes envelopes for the wire.
+type Serializer interface {
+	ContentType() string
+	Marshal(e Envelope) ([]byte, error)
+	Unmarshal(data []byte) (Envelope, error)
+}
+
+var (
+	// JSON encodes envelopes as JSON objects.
+	JSON Serializer = jsonSerializer{}
+	// Protobuf encodes envelopes as cex.events.v1.Envelope messages, see
+	// envelope.proto.
+	Protobuf Serializer = protobufSerializer{}
+)
+
+// ForFormat returns the serializer configured by name, "json" (the default
+// for an empty name) or "protobuf".
+func ForFormat(name string) (Serializer, error) {
+	switch name {
+	case "", "json":
+		return JSON, nil
+	case "protobuf":
+		return Protobuf, nil
+	default:
+		return nil, fmt.Errorf("unknown event format %q", name)
+	}
+}
+
+// ForContentType returns the serializer that produced a content type.
+func ForContentType(contentType string) (Serializer, error) {
+	switch contentType {
+	case ContentTypeJSON:
+		return JSON, nil
+	case ContentTypeProtobuf:
+		return Protobuf, nil
+	default:
+		return nil, fmt.Errorf("unknown event content type %q", contentType)
+	}
+}
+
+type jsonSerializer struct{}
+
+func (jsonSerializer) ContentType() string { return ContentTypeJSON }
+
+func (jsonSerializer) Marshal(e Envelope) ([]byte, error) {
+	return json.Marshal(e)
+}
+
+func (jsonSerializer) Unmarshal(data []byte) (Envelope, error) {
+	var e Envelope
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
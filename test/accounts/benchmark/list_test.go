@@ -4,7 +4,6 @@ import (
 	"context"
 	"testing"
 
-	"cex/internal/accounts/queue"
 	"cex/internal/accounts/service"
 
 	"github.com/DATA-DOG/go-sqlmock"
@@ -13,12 +12,11 @@ import (
 
 func BenchmarkListAccounts(b *testing.B) {
 	mockDB, _, _ := sqlmock.New()
-	publisher := queue.NewPublisher([]string{"localhost:9092"}, "accounts-events")
-	svc := service.NewAccountService(mockDB, publisher)
+	svc := service.NewAccountService(mockDB)
 	ctx := context.Background()
 	ownerID := uuid.New()
 
 	for i := 0; i < b.N; i++ {
-		_, _ = svc.ListAccounts(ctx, ownerID, 1, 100)
+		_, _ = svc.ListAccounts(ctx, service.AccountQuery{OwnerID: ownerID, Size: 100})
 	}
 }
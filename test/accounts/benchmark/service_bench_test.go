@@ -9,7 +9,6 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"cex/internal/accounts/db"
-	"cex/internal/accounts/queue"
 	"cex/internal/accounts/service"
 )
 
@@ -19,13 +18,12 @@ func BenchmarkListAccountsService(b *testing.B) {
 	dbConn, err := db.OpenAndMigrate(context.Background(), dsn)
 	require.NoError(b, err)
 
-	publisher := queue.NewPublisher([]string{"localhost:9092"}, "accounts-events")
-	svc := service.NewAccountService(dbConn, publisher)
+	svc := service.NewAccountService(dbConn)
 	owner := uuid.New()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.ListAccounts(context.Background(), owner, 0, 100)
+		_, err := svc.ListAccounts(context.Background(), service.AccountQuery{OwnerID: owner, Size: 100})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -2,6 +2,7 @@ package integration
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 
@@ -22,9 +24,11 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func TestAccountsEndToEnd(t *testing.T) {
+// startCRDB starts a single CockroachDB node of the version CI runs, applies
+// the migrations and returns the database with its DSN.
+func startCRDB(t *testing.T) (*sql.DB, string) {
+	t.Helper()
 	ctx := context.Background()
-	// 1) Start CockroachDB container
 	req := testcontainers.ContainerRequest{
 		Image:        "cockroachdb/cockroach:v22.1.7",
 		Cmd:          []string{"start-single-node", "--insecure"},
@@ -34,29 +38,33 @@ func TestAccountsEndToEnd(t *testing.T) {
 	crdb, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
 		ContainerRequest: req, Started: true,
 	})
-	assert.NoError(t, err)
-	defer crdb.Terminate(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { crdb.Terminate(ctx) })
 
 	host, err := crdb.Host(ctx)
-	assert.NoError(t, err)
+	require.NoError(t, err)
 	port, err := crdb.MappedPort(ctx, "26257")
-	assert.NoError(t, err)
+	require.NoError(t, err)
 	dsn := fmt.Sprintf("postgresql://root@%s:%s/defaultdb?sslmode=disable", host, port.Port())
 
-	// 2) Set cfg and run migrations
-	cfg.Cfg.Accounts.DSN = dsn
 	dbConn, err := db.OpenAndMigrate(ctx, dsn)
-	assert.NoError(t, err)
+	require.NoError(t, err)
+	t.Cleanup(func() { dbConn.Close() })
+	return dbConn, dsn
+}
+
+func TestAccountsEndToEnd(t *testing.T) {
+	// 1) Start CockroachDB and run migrations
+	dbConn, dsn := startCRDB(t)
+
+	// 2) Set cfg
+	cfg.Cfg.Accounts.DSN = dsn
 
 	// 3) Start HTTP server in background
 	e := echo.New()
 	e.Use(middleware.Recover())
 
-	// Create accountService instance
-	accountService := service.NewService(dbConn, nil, nil, nil)
-
-	// Pass accountService to RegisterRoutes
-	api.RegisterRoutes(e, dbConn, accountService)
+	api.RegisterRoutes(e, dbConn, service.NewAccountService(dbConn), api.Auth{})
 
 	go e.Start(":8080")
 	time.Sleep(1 * time.Second)
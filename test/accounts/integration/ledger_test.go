@@ -0,0 +1,55 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+)
+
+func TestPostJournal_WaitsForStatusChangeOnCockroachDB(t *testing.T) {
+	dbConn, _ := startCRDB(t)
+	ctx := context.Background()
+	svc := service.NewAccountService(dbConn)
+	account, err := svc.CreateAccount(ctx, uuid.New(), "spot")
+	require.NoError(t, err)
+	require.NoError(t, svc.UpdateBalance(ctx, account.ID, "USDT", decimal.NewFromInt(100)))
+
+	// A freeze in flight holds the account row like changeStatus does
+	tx, err := dbConn.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `SELECT status FROM accounts WHERE id = $1 FOR UPDATE`, account.ID)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, `UPDATE accounts SET status = $1 WHERE id = $2`, model.AccountFrozen, account.ID)
+	require.NoError(t, err)
+
+	debited := make(chan error, 1)
+	go func() {
+		debited <- svc.UpdateBalance(ctx, account.ID, "USDT", decimal.NewFromInt(-10))
+	}()
+	select {
+	case err := <-debited:
+		t.Fatalf("debit did not wait for the freeze: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	require.NoError(t, tx.Commit())
+	select {
+	case err := <-debited:
+		assert.ErrorIs(t, err, service.ErrAccountFrozen)
+	case <-time.After(30 * time.Second):
+		t.Fatal("debit still blocked after the freeze committed")
+	}
+
+	balances, err := svc.BalanceAt(ctx, account.ID, time.Now())
+	require.NoError(t, err)
+	assert.True(t, balances["USDT"].Equal(decimal.NewFromInt(100)))
+}
@@ -0,0 +1,97 @@
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/queue"
+	"cex/pkg/events"
+)
+
+// gatedPublisher holds every publish until it is let through.
+type gatedPublisher struct {
+	*queue.MemoryPublisher
+	started chan struct{}
+	gate    chan struct{}
+}
+
+func (p gatedPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	p.started <- struct{}{}
+	<-p.gate
+	return p.MemoryPublisher.Publish(ctx, env)
+}
+
+func enqueueEvents(t *testing.T, dbConn *sql.DB, accountID uuid.UUID, n int) {
+	t.Helper()
+	ctx := context.Background()
+	tx, err := dbConn.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	for range n {
+		require.NoError(t, queue.Enqueue(ctx, tx, uuid.New(), accountID, queue.EventBalanceUpdated, map[string]string{}))
+	}
+	require.NoError(t, tx.Commit())
+}
+
+func TestRelay_ClaimsWithLeasesOnCockroachDB(t *testing.T) {
+	dbConn, _ := startCRDB(t)
+	ctx := context.Background()
+	first, second := uuid.New(), uuid.New()
+	enqueueEvents(t, dbConn, first, 3)
+	enqueueEvents(t, dbConn, second, 2)
+
+	// The first relay leases the oldest event and stalls publishing it
+	gated := gatedPublisher{
+		MemoryPublisher: queue.NewMemoryPublisher(),
+		started:         make(chan struct{}),
+		gate:            make(chan struct{}),
+	}
+	stalled := queue.NewRelay(dbConn, gated, queue.RelayConfig{BatchSize: 1}, zap.NewNop())
+	done := make(chan error, 1)
+	go func() {
+		_, err := stalled.RelayBatch(ctx)
+		done <- err
+	}()
+	select {
+	case <-gated.started:
+	case <-time.After(30 * time.Second):
+		t.Fatal("first relay did not claim")
+	}
+
+	// Meanwhile another relay only takes the events of the other account
+	other := queue.NewMemoryPublisher()
+	relay := queue.NewRelay(dbConn, other, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+	n, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	for _, env := range other.Events() {
+		assert.Equal(t, second, env.AggregateID)
+	}
+
+	close(gated.gate)
+	require.NoError(t, <-done)
+	published := gated.Events()
+	require.Len(t, published, 1)
+	assert.Equal(t, first, published[0].AggregateID)
+	assert.Equal(t, uint64(1), published[0].Sequence)
+
+	// Once the lease is gone the rest of the account follows in order
+	other.Reset()
+	n, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, other.Events(), 2)
+	assert.Equal(t, uint64(2), other.Events()[0].Sequence)
+	assert.Equal(t, uint64(3), other.Events()[1].Sequence)
+
+	var pending int
+	require.NoError(t, dbConn.QueryRowContext(ctx,
+		`SELECT count(*) FROM account_outbox WHERE published_at IS NULL OR locked_by IS NOT NULL`).Scan(&pending))
+	assert.Zero(t, pending)
+}
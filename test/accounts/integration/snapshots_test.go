@@ -0,0 +1,36 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/service"
+)
+
+func TestTakeSnapshots_LagsBehindPostingsOnCockroachDB(t *testing.T) {
+	dbConn, _ := startCRDB(t)
+	ctx := context.Background()
+	svc := service.NewAccountService(dbConn)
+	account, err := svc.CreateAccount(ctx, uuid.New(), "spot")
+	require.NoError(t, err)
+	require.NoError(t, svc.UpdateBalance(ctx, account.ID, "USDT", decimal.NewFromInt(100)))
+
+	// A snapshot asked for now stays clear of postings that may be in flight
+	takenAt, n, err := svc.TakeSnapshots(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-service.SnapshotLag), takenAt, 10*time.Second)
+	assert.Equal(t, int64(1), n)
+
+	balances, err := svc.BalanceAt(ctx, account.ID, time.Now())
+	require.NoError(t, err)
+	assert.True(t, balances["USDT"].Equal(decimal.NewFromInt(100)))
+	balances, err = svc.BalanceAt(ctx, account.ID, takenAt)
+	require.NoError(t, err)
+	assert.True(t, balances["USDT"].IsZero())
+}
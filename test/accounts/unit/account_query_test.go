@@ -0,0 +1,112 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+func TestListAccounts_FiltersAreBound(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	ownerID := uuid.New()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	minBalance, maxBalance := decimal.NewFromInt(10), decimal.NewFromInt(1000)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT a.id, a.owner_id, a.account_type, a.status, a.created_at, a.updated_at, b.balance "+
+			"FROM accounts a JOIN account_balances b ON b.account_id = a.id AND b.asset = $1 "+
+			"WHERE a.owner_id = $2 AND a.account_type = ANY($3) AND a.status = ANY($4) "+
+			"AND b.balance >= $5 AND b.balance <= $6 AND a.created_at >= $7 AND a.created_at < $8 "+
+			"ORDER BY b.balance DESC, a.created_at DESC, a.id DESC LIMIT $9")).
+		WithArgs("BTC", ownerID, pq.Array([]string{"spot", "futures"}), pq.Array([]string{"active"}),
+			minBalance, maxBalance, from, to, service.DefaultPageSize+1).
+		WillReturnRows(sqlmock.NewRows(append(accountColumns, "balance")))
+
+	page, err := svc.ListAccounts(context.Background(), service.AccountQuery{
+		OwnerID:     ownerID,
+		Types:       []string{"spot", "futures"},
+		Statuses:    []model.AccountStatus{model.AccountActive},
+		Asset:       "BTC",
+		MinBalance:  &minBalance,
+		MaxBalance:  &maxBalance,
+		CreatedFrom: from,
+		CreatedTo:   to,
+		Sort:        service.SortBalanceDesc,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, page.Accounts)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAccounts_BalanceSortCursor(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	ownerID := uuid.New()
+	now := time.Now().UTC()
+	first, second := uuid.New(), uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY b.balance ASC, a.created_at ASC, a.id ASC LIMIT $3")).
+		WithArgs("USD", ownerID, 2).
+		WillReturnRows(sqlmock.NewRows(append(accountColumns, "balance")).
+			AddRow(first, ownerID, "fiat", "active", now, now, "5").
+			AddRow(second, ownerID, "fiat", "active", now, now, "7"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+
+	q := service.AccountQuery{OwnerID: ownerID, Asset: "USD", Sort: service.SortBalanceAsc, Size: 1}
+	page, err := svc.ListAccounts(context.Background(), q)
+	require.NoError(t, err)
+	require.Len(t, page.Accounts, 1)
+
+	// The next page continues after balance 5 of the first account
+	mock.ExpectQuery(regexp.QuoteMeta("AND (b.balance, a.created_at, a.id) > ($3, $4, $5)")).
+		WithArgs("USD", ownerID, decimal.NewFromInt(5), sqlmock.AnyArg(), first, 2).
+		WillReturnRows(sqlmock.NewRows(append(accountColumns, "balance")))
+	q.Cursor = page.NextCursor
+	_, err = svc.ListAccounts(context.Background(), q)
+	require.NoError(t, err)
+
+	// A cursor cannot be reused with another sort
+	q.Sort = service.SortCreatedDesc
+	_, err = svc.ListAccounts(context.Background(), q)
+	assert.True(t, errors.Is(err, service.ErrInvalidCursor))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAccounts_RejectsFilters(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	ten, one := decimal.NewFromInt(10), decimal.NewFromInt(1)
+	now := time.Now()
+
+	for name, q := range map[string]service.AccountQuery{
+		"unknown sort":          {Sort: "owner_id; DROP TABLE accounts"},
+		"unknown type":          {Types: []string{"margin"}},
+		"unknown status":        {Statuses: []model.AccountStatus{"deleted"}},
+		"balance without asset": {MinBalance: &ten},
+		"sort without asset":    {Sort: service.SortBalanceDesc},
+		"min above max":         {Asset: "USD", MinBalance: &ten, MaxBalance: &one},
+		"empty created range":   {CreatedFrom: now, CreatedTo: now},
+	} {
+		_, err := svc.ListAccounts(context.Background(), q)
+		assert.True(t, errors.Is(err, service.ErrInvalidFilter), name)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,6 +2,7 @@ package unit
 
 import (
 	"context"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
@@ -12,7 +13,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"cex/internal/accounts/queue"
+	"cex/internal/accounts/model"
 	"cex/internal/accounts/service"
 )
 
@@ -21,8 +22,7 @@ func TestCreateAndGetAccount(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	publisher := queue.NewPublisher([]string{"localhost:9092"}, "accounts-events")
-	svc := service.NewAccountService(db, publisher)
+	svc := service.NewAccountService(db)
 
 	ownerID := uuid.New()
 	now := time.Now().UTC()
@@ -32,8 +32,12 @@ func TestCreateAndGetAccount(t *testing.T) {
 
 	// Expect INSERT
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO accounts (id, owner_id, balance, account_type, created_at, updated_at)")).
-		WithArgs(sqlmock.AnyArg(), ownerID, decimal.Zero, "fiat", now, now).
+		"INSERT INTO accounts (id, owner_id, account_type, status, created_at, updated_at)")).
+		WithArgs(sqlmock.AnyArg(), ownerID, "fiat", model.AccountActive, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// Expect the event to be written to the outbox in the same transaction
+	expectEnqueue(mock, sqlmock.AnyArg(), "account.created", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Mock transaction commit
@@ -43,19 +47,28 @@ func TestCreateAndGetAccount(t *testing.T) {
 	acct, err := svc.CreateAccount(context.Background(), ownerID, "fiat")
 	assert.NoError(t, err)
 	assert.Equal(t, ownerID, acct.OwnerID)
-	assert.True(t, acct.Balance.Equal(decimal.Zero))
+	assert.Empty(t, acct.Balances)
 
 	// Expect SELECT
 	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT id, owner_id, balance, account_type, created_at, updated_at FROM accounts WHERE id = $1")).
+		"SELECT id, owner_id, account_type, status, created_at, updated_at FROM accounts WHERE id = $1")).
 		WithArgs(acct.ID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "balance", "account_type", "created_at", "updated_at"}).
-			AddRow(acct.ID, ownerID, decimal.Zero, "fiat", now, now))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "account_type", "status", "created_at", "updated_at"}).
+			AddRow(acct.ID, ownerID, "fiat", "active", now, now))
+	// Expect the balances of every asset
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT account_id, asset, balance, locked, updated_at FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}).
+			AddRow(acct.ID, "BTC", "0.5", "0", now).
+			AddRow(acct.ID, "USDT", "1200", "200", now))
 
 	// Call GetAccount
 	got, err := svc.GetAccount(context.Background(), acct.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, acct.ID, got.ID)
+	assert.True(t, got.Balances["BTC"].Balance.Equal(decimal.RequireFromString("0.5")))
+	assert.True(t, got.Balances["USDT"].Balance.Equal(decimal.NewFromInt(1200)))
+	assert.True(t, got.Balances["USDT"].Available().Equal(decimal.NewFromInt(1000)))
 
 	// Ensure all expectations met
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -63,29 +76,28 @@ func TestCreateAndGetAccount(t *testing.T) {
 
 func TestUpdateBalanceConcurrency(t *testing.T) {
 	db, mock, _ := sqlmock.New()
-	publisher := queue.NewPublisher([]string{"localhost:9092"}, "accounts-events")
-	svc := service.NewAccountService(db, publisher)
+	svc := service.NewAccountService(db)
 
 	id := uuid.New()
 	old := decimal.NewFromInt(100)
 	delta := decimal.NewFromInt(50)
-	newBal := old.Add(delta)
 
 	// Begin tx
 	mock.ExpectBegin()
-	// Lock row
-	mock.ExpectQuery(regexp.QuoteMeta(
-		"SELECT balance FROM accounts WHERE id = $1 FOR UPDATE")).
-		WithArgs(id).
-		WillReturnRows(sqlmock.NewRows([]string{"balance"}).AddRow(old))
-	// Update
-	mock.ExpectExec(regexp.QuoteMeta(
-		"UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3")).
-		WithArgs(newBal, sqlmock.AnyArg(), id).
+	// Both legs are checked against the asset registry
+	expectAssetLookups(mock, "USDT", 6, 2)
+	// Every balance is locked before the journal is stamped
+	expectLockBalance(mock, id, "USDT", old, decimal.Zero)
+	expectJournal(mock, "manual-update", nil)
+	// The external counter-leg sorts before the account
+	expectExternalLeg(mock, "USDT", delta.Neg())
+	expectBalanceLeg(mock, id, "USDT", old, delta)
+	// Outbox
+	expectEnqueue(mock, id, "balance.updated", sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 	mock.ExpectCommit()
 
-	err := svc.UpdateBalance(context.Background(), id, delta)
+	err := svc.UpdateBalance(context.Background(), id, "USDT", delta)
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -94,18 +106,18 @@ func TestCreateAccount_Success(t *testing.T) {
 	db, mock, _ := sqlmock.New()
 	defer db.Close()
 
-	publisher := queue.NewPublisher([]string{"localhost:9092"}, "accounts-events")
-	svc := service.NewAccountService(db, publisher)
+	svc := service.NewAccountService(db)
 	ownerID := uuid.New()
-	now := time.Now().UTC()
 
 	// Mock transaction begin
 	mock.ExpectBegin()
 
 	// Expect INSERT ... RETURNING ...
 	mock.ExpectExec(regexp.QuoteMeta(
-		"INSERT INTO accounts (id, owner_id, balance, account_type, created_at, updated_at)")).
-		WithArgs(sqlmock.AnyArg(), ownerID, decimal.Zero, "fiat", now, now).
+		"INSERT INTO accounts (id, owner_id, account_type, status, created_at, updated_at)")).
+		WithArgs(sqlmock.AnyArg(), ownerID, "fiat", model.AccountActive, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEnqueue(mock, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnResult(sqlmock.NewResult(1, 1))
 
 	// Mock transaction commit
@@ -117,3 +129,22 @@ func TestCreateAccount_Success(t *testing.T) {
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestCreateAccount_OutboxFailureRollsBack(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+
+	svc := service.NewAccountService(db)
+	ownerID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO accounts")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEnqueue(mock, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnError(errors.New("outbox unavailable"))
+	mock.ExpectRollback()
+
+	_, err := svc.CreateAccount(context.Background(), ownerID, "fiat")
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
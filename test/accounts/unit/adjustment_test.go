@@ -0,0 +1,126 @@
+package unit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+	"cex/pkg/apiutil"
+	"cex/pkg/errors"
+)
+
+// balanceEventOf matches an outbox payload holding a BalanceUpdatedEvent
+// with the given reason and operator.
+type balanceEventOf struct {
+	reason     string
+	operatorID uuid.UUID
+}
+
+func (m balanceEventOf) Match(v driver.Value) bool {
+	data, ok := v.([]byte)
+	if !ok {
+		return false
+	}
+	var ev apiutil.BalanceUpdatedEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		return false
+	}
+	return ev.Reason == m.reason && ev.OperatorID != nil && *ev.OperatorID == m.operatorID
+}
+
+func TestAdjustBalance_RecordsOperator(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, operatorID := uuid.New(), uuid.New()
+	amount := decimal.NewFromInt(250)
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "USD", 2, 2)
+	expectLockBalance(mock, id, "USD", decimal.Zero, decimal.Zero)
+	createdAt := expectJournal(mock, "deposit", operatorID)
+	expectExternalLeg(mock, "USD", amount.Neg())
+	expectBalanceLeg(mock, id, "USD", decimal.Zero, amount)
+	expectEnqueue(mock, id, "balance.updated", balanceEventOf{"deposit", operatorID}).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	adj, err := svc.AdjustBalance(context.Background(), service.AdjustmentRequest{
+		AccountID:  id,
+		Asset:      "USD",
+		Amount:     amount,
+		Reason:     model.AdjustmentDeposit,
+		OperatorID: operatorID,
+	})
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, adj.ID)
+	assert.Equal(t, operatorID, adj.OperatorID)
+	// Stamped like the journal and the BalanceUpdatedEvent
+	assert.Equal(t, createdAt, adj.CreatedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAdjustBalance_Rejects(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, operatorID := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name string
+		req  service.AdjustmentRequest
+	}{
+		{"unknown reason", service.AdjustmentRequest{AccountID: id, Asset: "USD", Amount: decimal.NewFromInt(1), Reason: "gift", OperatorID: operatorID}},
+		{"no operator", service.AdjustmentRequest{AccountID: id, Asset: "USD", Amount: decimal.NewFromInt(1), Reason: model.AdjustmentDeposit}},
+		{"zero amount", service.AdjustmentRequest{AccountID: id, Asset: "USD", Reason: model.AdjustmentCorrection, OperatorID: operatorID}},
+		{"negative deposit", service.AdjustmentRequest{AccountID: id, Asset: "USD", Amount: decimal.NewFromInt(-1), Reason: model.AdjustmentDeposit, OperatorID: operatorID}},
+		{"positive fee", service.AdjustmentRequest{AccountID: id, Asset: "USD", Amount: decimal.NewFromInt(1), Reason: model.AdjustmentFee, OperatorID: operatorID}},
+		{"external account", service.AdjustmentRequest{AccountID: model.ExternalAccountID, Asset: "USD", Amount: decimal.NewFromInt(1), Reason: model.AdjustmentDeposit, OperatorID: operatorID}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.AdjustBalance(context.Background(), tt.req)
+			assert.True(t, errors.Is(err, service.ErrInvalidAdjustment), err)
+		})
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRequireRole(t *testing.T) {
+	e := echo.New()
+	h := api.RequireRole(api.RoleAdmin)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+
+	newContext := func(claims jwt.MapClaims) (echo.Context, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/x/adjustments", strings.NewReader(`{}`))
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: claims})
+		return c, rec
+	}
+
+	c, _ := newContext(jwt.MapClaims{"sub": uuid.NewString(), "roles": []interface{}{"trader"}})
+	var he *echo.HTTPError
+	require.ErrorAs(t, h(c), &he)
+	assert.Equal(t, http.StatusForbidden, he.Code)
+
+	c, rec := newContext(jwt.MapClaims{"sub": uuid.NewString(), "roles": []interface{}{"trader", api.RoleAdmin}})
+	require.NoError(t, h(c))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
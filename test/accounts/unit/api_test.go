@@ -5,12 +5,15 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 
 	"cex/internal/accounts/api"
+	"cex/internal/accounts/service"
+	"cex/pkg/auth"
 )
 
 func TestRegisterRoutes(t *testing.T) {
@@ -18,7 +21,11 @@ func TestRegisterRoutes(t *testing.T) {
 	dbConn := setupTestDB() // Mock or setup a test database connection
 	defer dbConn.Close()
 
-	api.RegisterRoutes(e, dbConn)
+	jwks := auth.NewJWKSCache("http://users.invalid/.well-known/jwks.json", nil)
+	api.RegisterRoutes(e, dbConn, service.NewAccountService(dbConn), api.Auth{
+		Middleware: []echo.MiddlewareFunc{api.JWT(jwks.Keyfunc)},
+		MFA:        api.RequireMFA(15 * time.Minute),
+	})
 
 	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
 	rec := httptest.NewRecorder()
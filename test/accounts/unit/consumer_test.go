@@ -0,0 +1,347 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/service"
+)
+
+// fakeReader serves queued messages and returns io.EOF once drained.
+type fakeReader struct {
+	msgs      []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	if len(r.msgs) == 0 {
+		return kafka.Message{}, io.EOF
+	}
+	m := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return m, nil
+}
+
+func (r *fakeReader) CommitMessages(ctx context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+// fakeWriter records written messages, failing the first failures writes.
+type fakeWriter struct {
+	mu       sync.Mutex
+	failures int
+	calls    int
+	written  []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.calls++
+	if w.failures > 0 {
+		w.failures--
+		return errors.New("broker unavailable")
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func commandMessage(t *testing.T, offset int64, commandType string, payload any) kafka.Message {
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	value, err := json.Marshal(queue.Command{ID: uuid.New(), Type: commandType, Payload: data})
+	require.NoError(t, err)
+	return kafka.Message{Topic: "accounts.commands", Offset: offset, Value: value}
+}
+
+func header(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func newTestConsumer(r *fakeReader, dlq queue.MessageWriter) *queue.Consumer {
+	return queue.NewConsumer(r, dlq, queue.ConsumerConfig{Retry: queue.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     2 * time.Millisecond,
+	}}, zap.NewNop())
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func TestConsumer_DispatchesTypedCommandsAndCommits(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		commandMessage(t, 1, "greet", greeting{Name: "alice"}),
+		commandMessage(t, 2, "greet", greeting{Name: "bob"}),
+	}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+
+	var names []string
+	c.Handle("greet", queue.Typed(func(ctx context.Context, id uuid.UUID, g greeting) error {
+		names = append(names, g.Name)
+		return nil
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	assert.Equal(t, []string{"alice", "bob"}, names)
+	assert.Equal(t, []int64{1, 2}, r.committed)
+	assert.Empty(t, dlq.written)
+}
+
+func TestConsumer_RetriesTransientFailures(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{commandMessage(t, 7, "greet", greeting{})}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+
+	calls := 0
+	c.Handle("greet", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		calls++
+		if calls < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int64{7}, r.committed)
+	assert.Empty(t, dlq.written)
+}
+
+func TestConsumer_RetriesTransientFailuresPastMaxAttempts(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{commandMessage(t, 3, "outage", greeting{})}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+	retried := metrics.CommandsTotal.WithLabelValues("outage", "retried")
+	before := testutil.ToFloat64(retried)
+
+	// A database outage outlasting MaxAttempts must not drop the command
+	calls := 0
+	c.Handle("outage", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		calls++
+		if calls <= 10 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	assert.Equal(t, 11, calls)
+	assert.Equal(t, []int64{3}, r.committed)
+	assert.Empty(t, dlq.written)
+	assert.Equal(t, 10.0, testutil.ToFloat64(retried)-before)
+}
+
+func TestConsumer_RetriesDeadLetterWrites(t *testing.T) {
+	m := commandMessage(t, 3, "greet", greeting{})
+	r := &fakeReader{msgs: []kafka.Message{m}}
+	dlq := &fakeWriter{failures: 2}
+	pub := queue.NewResilientPublisher("test-dlq-retry", queue.NewMemoryPublisher(), fastRetry, queue.BreakerSettings{}, zap.NewNop())
+	c := newTestConsumer(r, pub.Writer(dlq))
+
+	c.Handle("greet", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		return queue.Permanent(errors.New("unknown asset"))
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	// The offset is committed only after the dead-letter write succeeded
+	assert.Equal(t, []int64{3}, r.committed)
+	require.Len(t, dlq.written, 1)
+	dead := dlq.written[0]
+	assert.Equal(t, m.Value, dead.Value)
+	assert.Equal(t, "unknown asset", header(dead, queue.HeaderDLQError))
+	assert.Equal(t, "1", header(dead, queue.HeaderDLQAttempts))
+	assert.Equal(t, "accounts.commands", header(dead, queue.HeaderDLQTopic))
+	assert.Equal(t, "3", header(dead, queue.HeaderDLQOffset))
+	assert.Equal(t, 3, dlq.calls)
+}
+
+func TestConsumer_StopsWhenDeadLetterWritesFail(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		commandMessage(t, 3, "greet", greeting{}),
+		commandMessage(t, 4, "greet", greeting{}),
+	}}
+	dlq := &fakeWriter{failures: 100}
+	pub := queue.NewResilientPublisher("test-dlq-fail", queue.NewMemoryPublisher(), fastRetry, queue.BreakerSettings{}, zap.NewNop())
+	c := newTestConsumer(r, pub.Writer(dlq))
+
+	c.Handle("greet", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		return queue.Permanent(errors.New("unknown asset"))
+	}))
+
+	// Retries are bounded, and the command stays uncommitted for redelivery
+	err := c.Run(context.Background())
+	assert.ErrorContains(t, err, "broker unavailable")
+	assert.Equal(t, fastRetry.MaxAttempts, dlq.calls)
+	assert.Empty(t, r.committed)
+	assert.Len(t, r.msgs, 1, "the next command is left alone")
+}
+
+func TestConsumer_CountsDuplicatesOnce(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		commandMessage(t, 1, "dedup", greeting{}),
+		commandMessage(t, 2, "dedup", greeting{}),
+	}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+	processed := metrics.CommandsTotal.WithLabelValues("dedup", "processed")
+	duplicate := metrics.CommandsTotal.WithLabelValues("dedup", "duplicate")
+	processedBefore, duplicateBefore := testutil.ToFloat64(processed), testutil.ToFloat64(duplicate)
+
+	calls := 0
+	c.Handle("dedup", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		calls++
+		if calls > 1 {
+			return queue.ErrDuplicate
+		}
+		return nil
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	assert.Equal(t, 2, calls, "duplicates are not retried")
+	assert.Equal(t, []int64{1, 2}, r.committed)
+	assert.Empty(t, dlq.written)
+	assert.Equal(t, 1.0, testutil.ToFloat64(processed)-processedBefore)
+	assert.Equal(t, 1.0, testutil.ToFloat64(duplicate)-duplicateBefore)
+}
+
+func TestConsumer_DeadLettersPermanentFailuresWithoutRetry(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{
+		commandMessage(t, 1, "greet", greeting{}),
+		commandMessage(t, 2, "unknown", greeting{}),
+		{Offset: 3, Value: []byte("not json")},
+		commandMessage(t, 4, "typed", "not an object"),
+	}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+
+	calls := 0
+	c.Handle("greet", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		calls++
+		return service.ErrInsufficientFunds
+	}))
+	c.Handle("typed", queue.Typed(func(ctx context.Context, id uuid.UUID, g greeting) error {
+		t.Fatal("handler called with undecodable payload")
+		return nil
+	}))
+
+	assert.ErrorIs(t, c.Run(context.Background()), io.EOF)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []int64{1, 2, 3, 4}, r.committed)
+	require.Len(t, dlq.written, 4)
+	for _, dead := range dlq.written {
+		assert.Equal(t, "1", header(dead, queue.HeaderDLQAttempts))
+	}
+}
+
+func TestConsumer_LeavesOffsetUncommittedOnCancel(t *testing.T) {
+	r := &fakeReader{msgs: []kafka.Message{commandMessage(t, 1, "greet", greeting{})}}
+	dlq := &fakeWriter{}
+	c := newTestConsumer(r, dlq)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Handle("greet", queue.HandlerFunc(func(ctx context.Context, cmd queue.Command) error {
+		cancel()
+		return ctx.Err()
+	}))
+
+	assert.NoError(t, c.Run(ctx))
+	assert.Empty(t, r.committed)
+	assert.Empty(t, dlq.written)
+}
+
+func TestCreditFunds_AppliesOnce(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	cmd := service.FundsCommand{
+		CommandID: uuid.New(),
+		AccountID: uuid.New(),
+		Asset:     "USD",
+		Amount:    decimal.NewFromInt(40),
+		Reason:    "trade-settlement",
+	}
+	insertCommand := regexp.QuoteMeta("INSERT INTO processed_commands (command_id, command_type, processed_at)")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(insertCommand).
+		WithArgs(cmd.CommandID, "credit", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAssetLookups(mock, "USD", 2, 2)
+	expectLockBalance(mock, cmd.AccountID, "USD", decimal.Zero, decimal.Zero)
+	expectJournal(mock, "trade-settlement", nil)
+	expectExternalLeg(mock, "USD", cmd.Amount.Neg())
+	expectBalanceLeg(mock, cmd.AccountID, "USD", decimal.Zero, cmd.Amount)
+	expectEnqueue(mock, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	applied, err := svc.CreditFunds(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// Redelivery: the command is already recorded
+	mock.ExpectBegin()
+	mock.ExpectExec(insertCommand).
+		WithArgs(cmd.CommandID, "credit", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	applied, err = svc.CreditFunds(context.Background(), cmd)
+	require.NoError(t, err)
+	assert.False(t, applied)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDebitFunds_RejectsInvalidCommands(t *testing.T) {
+	svc := service.NewAccountService(nil)
+	valid := service.FundsCommand{
+		CommandID: uuid.New(),
+		AccountID: uuid.New(),
+		Asset:     "USD",
+		Amount:    decimal.NewFromInt(1),
+		Reason:    "withdrawal",
+	}
+	for name, mutate := range map[string]func(*service.FundsCommand){
+		"missing id":       func(c *service.FundsCommand) { c.CommandID = uuid.Nil },
+		"external account": func(c *service.FundsCommand) { c.AccountID = model.ExternalAccountID },
+		"missing reason":   func(c *service.FundsCommand) { c.Reason = "" },
+		"negative amount":  func(c *service.FundsCommand) { c.Amount = decimal.NewFromInt(-1) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cmd := valid
+			mutate(&cmd)
+			_, err := svc.DebitFunds(context.Background(), cmd)
+			assert.ErrorIs(t, err, service.ErrInvalidFundsCommand)
+			assert.True(t, queue.IsPermanent(err))
+		})
+	}
+}
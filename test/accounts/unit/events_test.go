@@ -0,0 +1,257 @@
+package unit
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"cex/internal/accounts/queue"
+	"cex/pkg/apiutil"
+	"cex/pkg/events"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the event schema golden files")
+
+var (
+	sampleTime       = time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC)
+	sampleAccountID  = uuid.MustParse("6f1c2a0e-8d7b-4c35-9a41-2b7e5f0c9d13")
+	sampleOperatorID = uuid.MustParse("0b9d8c7e-6f5a-4b3c-8d2e-1f0a9b8c7d6e")
+)
+
+// sampleEvents holds one payload per published event type, in the shape the
+// service currently produces.
+var sampleEvents = map[string]any{
+	queue.EventAccountCreated: apiutil.AccountCreatedEvent{
+		EventID:     uuid.MustParse("3d1e6a52-0c7b-4f8e-9b2a-5e4d3c2b1a09"),
+		AccountID:   sampleAccountID,
+		OwnerID:     uuid.MustParse("9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"),
+		AccountType: "spot",
+		Timestamp:   sampleTime,
+	},
+	queue.EventBalanceUpdated: apiutil.BalanceUpdatedEvent{
+		EventID:    uuid.MustParse("7c5d4e3f-2a1b-4c0d-9e8f-7a6b5c4d3e2f"),
+		AccountID:  sampleAccountID,
+		Asset:      "BTC",
+		OldBalance: "1.000000000000000001",
+		NewBalance: "0.750000000000000001",
+		Delta:      "-0.25",
+		Reason:     "withdrawal",
+		OperatorID: &sampleOperatorID,
+		Timestamp:  sampleTime,
+	},
+	queue.EventTransferCompleted: apiutil.TransferCompletedEvent{
+		EventID:       uuid.MustParse("1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d"),
+		TransferID:    uuid.MustParse("5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a"),
+		FromAccountID: sampleAccountID,
+		ToAccountID:   uuid.MustParse("2c3d4e5f-6a7b-4c8d-9e0f-1a2b3c4d5e6f"),
+		Asset:         "USDT",
+		Amount:        "125.5",
+		Timestamp:     sampleTime,
+	},
+	queue.EventAccountFrozen:   statusEvent("active", "frozen"),
+	queue.EventAccountUnfrozen: statusEvent("frozen", "active"),
+	queue.EventAccountClosed:   statusEvent("active", "closed"),
+}
+
+func statusEvent(from, to string) apiutil.AccountStatusChangedEvent {
+	return apiutil.AccountStatusChangedEvent{
+		EventID:   uuid.MustParse("4e5f6a7b-8c9d-4e0f-a1b2-c3d4e5f6a7b8"),
+		AccountID: sampleAccountID,
+		OldStatus: from,
+		NewStatus: to,
+		Reason:    "compliance review",
+		ActorID:   sampleOperatorID,
+		Timestamp: sampleTime,
+	}
+}
+
+func sampleEnvelope(t *testing.T, eventType string) events.Envelope {
+	payload := sampleEvents[eventType]
+	id := reflect.ValueOf(payload).FieldByName("EventID").Interface().(uuid.UUID)
+	env, err := events.New(id, eventType, queue.EventVersion(eventType), sampleTime, "req-42", payload)
+	require.NoError(t, err)
+	env.AggregateID = sampleAccountID
+	env.Sequence = 3
+	return env
+}
+
+func sortedEventTypes() []string {
+	types := make([]string, 0, len(sampleEvents))
+	for eventType := range sampleEvents {
+		types = append(types, eventType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func TestEveryEventTypeHasVersionAndSample(t *testing.T) {
+	for _, eventType := range []string{
+		queue.EventAccountCreated, queue.EventBalanceUpdated, queue.EventTransferCompleted,
+		queue.EventAccountFrozen, queue.EventAccountUnfrozen, queue.EventAccountClosed,
+	} {
+		assert.Positive(t, queue.EventVersion(eventType), eventType)
+		assert.Contains(t, sampleEvents, eventType)
+	}
+}
+
+func TestEventEnvelopeRoundTrip(t *testing.T) {
+	for _, s := range []events.Serializer{events.JSON, events.Protobuf} {
+		for _, eventType := range sortedEventTypes() {
+			t.Run(s.ContentType()+"/"+eventType, func(t *testing.T) {
+				env := sampleEnvelope(t, eventType)
+				msg, err := events.Message(env, s)
+				require.NoError(t, err)
+				assert.Equal(t, sampleAccountID.String(), string(msg.Key))
+				assert.Equal(t, sampleAccountID.String(), header(msg, events.HeaderAggregateID))
+				assert.Equal(t, "3", header(msg, events.HeaderSequence))
+				assert.Equal(t, s.ContentType(), header(msg, events.HeaderContentType))
+				assert.Equal(t, eventType, header(msg, events.HeaderType))
+				assert.Equal(t, fmt.Sprint(env.Version), header(msg, events.HeaderVersion))
+				assert.Equal(t, env.ID.String(), header(msg, events.HeaderID))
+				assert.Equal(t, "req-42", header(msg, events.HeaderCorrelationID))
+
+				got, err := events.FromMessage(msg)
+				require.NoError(t, err)
+				assert.Equal(t, env.ID, got.ID)
+				assert.Equal(t, env.Type, got.Type)
+				assert.Equal(t, env.Version, got.Version)
+				assert.True(t, env.OccurredAt.Equal(got.OccurredAt))
+				assert.Equal(t, env.CorrelationID, got.CorrelationID)
+				assert.Equal(t, env.AggregateID, got.AggregateID)
+				assert.Equal(t, env.Sequence, got.Sequence)
+
+				want := sampleEvents[eventType]
+				decoded := reflect.New(reflect.TypeOf(want))
+				require.NoError(t, got.DecodePayload(decoded.Interface()))
+				assert.Equal(t, want, decoded.Elem().Interface())
+			})
+		}
+	}
+}
+
+// TestEventSchemasCompatible checks the current event payloads against the
+// golden files of their schema version: consumers built against a version
+// must still read what is published under it. Run with -update after bumping
+// a version to record the new schema.
+func TestEventSchemasCompatible(t *testing.T) {
+	for _, eventType := range sortedEventTypes() {
+		t.Run(eventType, func(t *testing.T) {
+			env := sampleEnvelope(t, eventType)
+			base := filepath.Join("testdata", "events", fmt.Sprintf("%s.v%d", eventType, env.Version))
+			if *updateGolden {
+				writeGolden(t, base, env)
+			}
+
+			data, err := os.ReadFile(base + ".json")
+			require.NoError(t, err, "no golden file for %s v%d, run the tests with -update", eventType, env.Version)
+			golden, err := events.JSON.Unmarshal(data)
+			require.NoError(t, err)
+			assert.Equal(t, eventType, golden.Type)
+
+			// Every field of the recorded schema is still produced with the same JSON kind
+			var old, current map[string]any
+			require.NoError(t, json.Unmarshal(golden.Payload, &old))
+			require.NoError(t, json.Unmarshal(env.Payload, &current))
+			for field, v := range old {
+				require.Contains(t, current, field, "field removed without a version bump")
+				assert.IsType(t, v, current[field], "field %s retyped without a version bump", field)
+			}
+
+			// The Protobuf encoding of the same envelope still decodes to it
+			pb, err := os.ReadFile(base + ".pb")
+			require.NoError(t, err)
+			fromPB, err := events.Protobuf.Unmarshal(pb)
+			require.NoError(t, err)
+			assert.Equal(t, golden.ID, fromPB.ID)
+			assert.Equal(t, golden.Version, fromPB.Version)
+			assert.True(t, golden.OccurredAt.Equal(fromPB.OccurredAt))
+			assert.Equal(t, golden.CorrelationID, fromPB.CorrelationID)
+			assert.JSONEq(t, string(golden.Payload), string(fromPB.Payload))
+
+			// And today's payload type still reads the recorded one
+			decoded := reflect.New(reflect.TypeOf(sampleEvents[eventType]))
+			require.NoError(t, fromPB.DecodePayload(decoded.Interface()))
+		})
+	}
+}
+
+func writeGolden(t *testing.T, base string, env events.Envelope) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(base), 0o755))
+	data, err := json.MarshalIndent(env, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(base+".json", append(data, '\n'), 0o644))
+	pb, err := events.Protobuf.Marshal(env)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(base+".pb", pb, 0o644))
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	env := sampleEnvelope(t, queue.EventBalanceUpdated)
+	data, err := events.Protobuf.Marshal(env)
+	require.NoError(t, err)
+
+	// A newer producer added fields 15 (string) and 16 (varint)
+	data = protowire.AppendTag(data, 15, protowire.BytesType)
+	data = protowire.AppendString(data, "tenant-a")
+	data = protowire.AppendTag(data, 16, protowire.VarintType)
+	data = protowire.AppendVarint(data, 3)
+
+	got, err := events.Protobuf.Unmarshal(data)
+	require.NoError(t, err)
+	assert.Equal(t, env.ID, got.ID)
+	assert.Equal(t, env.Sequence, got.Sequence)
+	assert.JSONEq(t, string(env.Payload), string(got.Payload))
+}
+
+func TestSequenceTracker(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	event := func(aggregateID uuid.UUID, seq uint64) events.Envelope {
+		return events.Envelope{AggregateID: aggregateID, Sequence: seq}
+	}
+	tracker := events.NewSequenceTracker()
+
+	assert.Equal(t, events.InOrder, tracker.Observe(event(a, 1)).Status)
+	assert.Equal(t, events.InOrder, tracker.Observe(event(a, 2)).Status)
+	// Aggregates are tracked independently
+	assert.Equal(t, events.InOrder, tracker.Observe(event(b, 1)).Status)
+
+	gap := tracker.Observe(event(a, 5))
+	assert.Equal(t, events.Gap, gap.Status)
+	assert.Equal(t, uint64(3), gap.Expected)
+	assert.Equal(t, uint64(2), gap.Missing())
+
+	// A skipped event delivered late, and a redelivery
+	late := tracker.Observe(event(a, 4))
+	assert.Equal(t, events.Stale, late.Status)
+	assert.Equal(t, uint64(6), late.Expected)
+	assert.Equal(t, events.Stale, tracker.Observe(event(b, 1)).Status)
+	assert.Equal(t, events.InOrder, tracker.Observe(event(a, 6)).Status)
+
+	assert.Equal(t, events.Unsequenced, tracker.Observe(events.Envelope{AggregateID: a}).Status)
+
+	// A consumer resuming from a stored position
+	tracker.Seed(b, 10)
+	assert.Equal(t, events.InOrder, tracker.Observe(event(b, 11)).Status)
+}
+
+func TestEventSerializerSelection(t *testing.T) {
+	s, err := events.ForFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, events.ContentTypeJSON, s.ContentType())
+	s, err = events.ForFormat("protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, events.ContentTypeProtobuf, s.ContentType())
+	_, err = events.ForFormat("avro")
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package unit
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"cex/internal/accounts/model"
+)
+
+// expectAssetLookups expects n registry lookups of asset, one per posting.
+func expectAssetLookups(mock sqlmock.Sqlmock, asset string, scale int32, n int) {
+	for i := 0; i < n; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT code, name, precision, scale FROM assets WHERE code = $1")).
+			WithArgs(asset).
+			WillReturnRows(sqlmock.NewRows([]string{"code", "name", "precision", "scale"}).
+				AddRow(asset, asset, 38, scale))
+	}
+}
+
+// expectJournal expects the journal header, stamped by the database once
+// every balance is locked, and returns its created_at.
+func expectJournal(mock sqlmock.Sqlmock, reason, operatorID any) time.Time {
+	createdAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO journals (id, reason, operator_id, created_at)")).
+		WithArgs(sqlmock.AnyArg(), reason, operatorID).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+	return createdAt
+}
+
+// expectExternalLeg expects the ledger entry of the external counter-account,
+// which has no balance to move.
+func expectExternalLeg(mock sqlmock.Sqlmock, asset string, amount decimal.Decimal) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), model.ExternalAccountID, asset, amount, nil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectBalanceLeg expects the statements that move the locked asset balance
+// of an account from old by delta and record the ledger entry.
+func expectBalanceLeg(mock sqlmock.Sqlmock, id uuid.UUID, asset string, old, delta decimal.Decimal) {
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE account_balances SET balance = $1, updated_at = $2 WHERE account_id = $3 AND asset = $4")).
+		WithArgs(old.Add(delta), sqlmock.AnyArg(), id, asset).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO ledger_entries")).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), id, asset, delta, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
+
+// expectLockBalance expects the account lookup, the lazy balance row creation
+// and the row lock of an asset balance of a spot account.
+func expectLockBalance(mock sqlmock.Sqlmock, id uuid.UUID, asset string, balance, locked decimal.Decimal) {
+	expectLockBalanceOf(mock, id, "spot", asset, balance, locked)
+}
+
+// expectLockBalanceOf is expectLockBalance for an active account of accountType.
+func expectLockBalanceOf(mock sqlmock.Sqlmock, id uuid.UUID, accountType, asset string, balance, locked decimal.Decimal) {
+	expectLockAccountBalance(mock, id, accountType, model.AccountActive, asset, balance, locked)
+}
+
+// expectLockAccountBalance is expectLockBalance for an account of accountType
+// in the given status.
+func expectLockAccountBalance(mock sqlmock.Sqlmock, id uuid.UUID, accountType string, status model.AccountStatus, asset string, balance, locked decimal.Decimal) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT account_type, status FROM accounts WHERE id = $1 FOR UPDATE")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"account_type", "status"}).AddRow(accountType, status))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO account_balances")).
+		WithArgs(id, asset, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT balance, locked FROM account_balances WHERE account_id = $1 AND asset = $2 FOR UPDATE")).
+		WithArgs(id, asset).
+		WillReturnRows(sqlmock.NewRows([]string{"balance", "locked"}).AddRow(balance, locked))
+}
+
+// expectEnqueue expects the next sequence number of aggregateID to be taken
+// and the event to be written to the outbox.
+func expectEnqueue(mock sqlmock.Sqlmock, aggregateID, eventType, payload any) *sqlmock.ExpectedExec {
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO account_event_sequences")).
+		WithArgs(aggregateID).
+		WillReturnRows(sqlmock.NewRows([]string{"last_sequence"}).AddRow(1))
+	return mock.ExpectExec(regexp.QuoteMeta("INSERT INTO account_outbox")).
+		WithArgs(sqlmock.AnyArg(), aggregateID, eventType, payload, nil, int64(1))
+}
@@ -0,0 +1,123 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+var balanceChangeColumns = []string{"id", "account_id", "asset", "amount", "balance_after", "reason", "journal_id", "created_at"}
+
+func TestBalanceHistory_DerivesOldBalance(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, journalID := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"WHERE l.account_id = $1 AND l.asset = $2 ORDER BY l.created_at DESC, l.id DESC LIMIT $3")).
+		WithArgs(id, "USD", service.DefaultPageSize+1).
+		WillReturnRows(sqlmock.NewRows(balanceChangeColumns).
+			AddRow(uuid.New(), id, "USD", "-30", "70", "transfer", journalID, now))
+
+	page, err := svc.BalanceHistory(context.Background(), service.HistoryQuery{AccountID: id, Asset: "USD"})
+	require.NoError(t, err)
+	require.Len(t, page.Changes, 1)
+	c := page.Changes[0]
+	assert.True(t, c.OldBalance.Equal(decimal.NewFromInt(100)))
+	assert.True(t, c.NewBalance.Equal(decimal.NewFromInt(70)))
+	assert.Equal(t, "transfer", c.Reason)
+	assert.Equal(t, journalID, c.JournalID)
+	assert.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectStatement expects a USD statement opening at 100 with a deposit of
+// 50 and a fee of 2.
+func expectStatement(mock sqlmock.Sqlmock, id uuid.UUID, from, to time.Time) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN LATERAL")).
+		WithArgs(id, from.Add(-time.Microsecond), "USD").
+		WillReturnRows(sqlmock.NewRows([]string{"asset", "balance"}).AddRow("USD", "100"))
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY l.created_at, l.id")).
+		WithArgs(id, "USD", from, to).
+		WillReturnRows(sqlmock.NewRows(balanceChangeColumns).
+			AddRow(uuid.New(), id, "USD", "50", "150", "deposit", uuid.New(), from.Add(time.Hour)).
+			AddRow(uuid.New(), id, "USD", "-2", "148", "fee", uuid.New(), from.Add(2*time.Hour)))
+	mock.ExpectCommit()
+}
+
+func TestStatement_OpeningAndClosing(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	expectStatement(mock, id, from, to)
+	st, err := svc.Statement(context.Background(), id, "USD", from, to)
+	require.NoError(t, err)
+	assert.True(t, st.OpeningBalance.Equal(decimal.NewFromInt(100)))
+	assert.True(t, st.ClosingBalance.Equal(decimal.NewFromInt(148)))
+	assert.True(t, st.TotalCredits.Equal(decimal.NewFromInt(50)))
+	assert.True(t, st.TotalDebits.Equal(decimal.NewFromInt(2)))
+	require.Len(t, st.Changes, 2)
+
+	_, err = svc.Statement(context.Background(), id, "USD", from, from.AddDate(2, 0, 0))
+	assert.True(t, errors.Is(err, service.ErrInvalidFilter))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatementHandler_CSV(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, ownerID := uuid.New(), uuid.New()
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(id, ownerID, "fiat", "active", from, from))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+	expectStatement(mock, id, from, to)
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet,
+		"/accounts/"+id.String()+"/statement?asset=USD&format=csv&from=2024-03-01T00:00:00Z&to=2024-04-01T00:00:00Z", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(id.String())
+	c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"sub": ownerID.String()}})
+
+	require.NoError(t, api.StatementHandler(svc)(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderContentDisposition), "statement-"+id.String()+"-USD-20240301-20240401.csv")
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, "timestamp,reason,journal_id,delta,old_balance,new_balance", lines[0])
+	assert.Equal(t, "2024-03-01T00:00:00Z,opening_balance,,,,100", lines[1])
+	assert.Equal(t, "2024-04-01T00:00:00Z,closing_balance,,,,148", lines[4])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
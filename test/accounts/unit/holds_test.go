@@ -0,0 +1,171 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+var holdColumns = []string{"id", "account_id", "asset", "amount", "status", "reference", "expires_at", "created_at", "updated_at"}
+
+func TestPlaceHold_LocksAvailableFunds(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "BTC", 8, 1)
+	expectLockBalance(mock, id, "BTC", decimal.NewFromInt(2), decimal.RequireFromString("0.5"))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_balances SET locked = $1")).
+		WithArgs(decimal.RequireFromString("1.5"), sqlmock.AnyArg(), id, "BTC").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO holds")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	hold, err := svc.PlaceHold(context.Background(), service.HoldRequest{
+		AccountID: id,
+		Asset:     "BTC",
+		Amount:    decimal.NewFromInt(1),
+		Reference: "order-42",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldActive, hold.Status)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPlaceHold_InsufficientAvailable(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "BTC", 8, 1)
+	// Total 2, of which 1.5 is already held
+	expectLockBalance(mock, id, "BTC", decimal.NewFromInt(2), decimal.RequireFromString("1.5"))
+	mock.ExpectRollback()
+
+	_, err := svc.PlaceHold(context.Background(), service.HoldRequest{
+		AccountID: id,
+		Asset:     "BTC",
+		Amount:    decimal.NewFromInt(1),
+	})
+	assert.True(t, errors.Is(err, service.ErrInsufficientFunds))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseHold(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	holdID, id := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM holds WHERE id = $1 FOR UPDATE")).
+		WithArgs(holdID).
+		WillReturnRows(sqlmock.NewRows(holdColumns).
+			AddRow(holdID, id, "ETH", "3", "active", "", nil, now, now))
+	expectLockBalance(mock, id, "ETH", decimal.NewFromInt(10), decimal.NewFromInt(3))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_balances SET locked = $1")).
+		WithArgs(decimal.Zero, sqlmock.AnyArg(), id, "ETH").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE holds SET status = $1")).
+		WithArgs(model.HoldReleased, sqlmock.AnyArg(), holdID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	hold, err := svc.ReleaseHold(context.Background(), holdID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldReleased, hold.Status)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReleaseHold_NotActive(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	holdID := uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM holds WHERE id = $1 FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows(holdColumns).
+			AddRow(holdID, uuid.New(), "ETH", "3", "captured", "", nil, now, now))
+	mock.ExpectRollback()
+
+	_, err := svc.ReleaseHold(context.Background(), holdID)
+	assert.True(t, errors.Is(err, service.ErrHoldNotActive))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCaptureHold_ToExternalAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	holdID, id := uuid.New(), uuid.New()
+	now := time.Now().UTC()
+	held := decimal.NewFromInt(100)
+	captured := decimal.NewFromInt(60)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM holds WHERE id = $1 FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows(holdColumns).
+			AddRow(holdID, id, "USDT", held, "active", "withdrawal-7", nil, now, now))
+	expectLockBalance(mock, id, "USDT", decimal.NewFromInt(500), held)
+	// The whole hold is unlocked, then 60 is debited
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_balances SET locked = $1")).
+		WithArgs(decimal.Zero, sqlmock.AnyArg(), id, "USDT").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectAssetLookups(mock, "USDT", 6, 2)
+	expectLockBalance(mock, id, "USDT", decimal.NewFromInt(500), decimal.Zero)
+	expectJournal(mock, "hold-capture", nil)
+	expectExternalLeg(mock, "USDT", captured)
+	expectBalanceLeg(mock, id, "USDT", decimal.NewFromInt(500), captured.Neg())
+	expectEnqueue(mock, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE holds SET status = $1, captured_amount = $2")).
+		WithArgs(model.HoldCaptured, captured, sqlmock.AnyArg(), holdID).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	hold, err := svc.CaptureHold(context.Background(), holdID, captured, model.ExternalAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, model.HoldCaptured, hold.Status)
+	assert.True(t, hold.CapturedAmount.Decimal.Equal(captured))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCaptureHold_Expired(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	holdID := uuid.New()
+	now := time.Now().UTC()
+	expiredAt := now.Add(-time.Second)
+
+	// Not yet picked up by the expiry job
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM holds WHERE id = $1 FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows(holdColumns).
+			AddRow(holdID, uuid.New(), "USDT", decimal.NewFromInt(100), "active", "withdrawal-8", expiredAt, now, now))
+	mock.ExpectRollback()
+
+	_, err := svc.CaptureHold(context.Background(), holdID, decimal.NewFromInt(60), model.ExternalAccountID)
+	assert.ErrorIs(t, err, service.ErrInvalidHold)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
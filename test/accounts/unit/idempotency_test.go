@@ -0,0 +1,294 @@
+package unit
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/internal/accounts/service"
+)
+
+func newIdempotentRequest(t *testing.T, e *echo.Echo, userID uuid.UUID, body string) (echo.Context, *httptest.ResponseRecorder) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/accounts/transfers", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(api.IdempotencyKeyHeader, "key-1")
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetPath("/accounts/transfers")
+	c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"sub": userID.String()}})
+	return c, rec
+}
+
+func TestIdempotency_FirstRequestIsRecorded(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	e := echo.New()
+	userID := uuid.New()
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys SET status_code")).
+		WithArgs(http.StatusCreated, []byte(`{"ok":true}`+"\n"), sqlmock.AnyArg(), userID, "key-1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	calls := 0
+	h := api.Idempotency(service.NewIdempotencyStore(db, 0))(func(c echo.Context) error {
+		calls++
+		return c.JSON(http.StatusCreated, map[string]bool{"ok": true})
+	})
+
+	c, rec := newIdempotentRequest(t, e, userID, `{"amount":"1"}`)
+	require.NoError(t, h(c))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, 1, calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_ReplaysStoredResponse(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	e := echo.New()
+	userID := uuid.New()
+	body := `{"amount":"1"}`
+
+	// Same method, route and body as the stored request
+	sum := sha256.Sum256([]byte("POST\x00/accounts/transfers\x00" + body))
+	hash := hex.EncodeToString(sum[:])
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", hash, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT request_hash, status_code, response_body")).
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(hash, http.StatusCreated, []byte(`{"id":"original"}`)))
+
+	calls := 0
+	h := api.Idempotency(service.NewIdempotencyStore(db, 0))(func(c echo.Context) error {
+		calls++
+		return c.NoContent(http.StatusCreated)
+	})
+
+	c, rec := newIdempotentRequest(t, e, userID, body)
+	require.NoError(t, h(c))
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get(api.IdempotentReplayedHeader))
+	assert.JSONEq(t, `{"id":"original"}`, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_DifferentPayloadIsRejected(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	e := echo.New()
+	userID := uuid.New()
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT request_hash, status_code, response_body")).
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow("some-other-hash", http.StatusCreated, []byte(`{}`)))
+
+	h := api.Idempotency(service.NewIdempotencyStore(db, 0))(func(c echo.Context) error {
+		t.Fatal("handler must not run")
+		return nil
+	})
+
+	c, rec := newIdempotentRequest(t, e, userID, `{"amount":"2"}`)
+	require.NoError(t, h(c))
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_SameKeyForAnotherAccountIsRejected(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	e := echo.New()
+	userID := uuid.New()
+	body := `{"amount":"10","asset":"USD"}`
+	first, second := uuid.NewString(), uuid.NewString()
+	hashFor := func(id string) string {
+		sum := sha256.Sum256([]byte("POST\x00/accounts/" + id + "/adjustments\x00" + body))
+		return hex.EncodeToString(sum[:])
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", hashFor(first), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys SET status_code")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// The retry targets another account
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", hashFor(second), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT request_hash, status_code, response_body")).
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(hashFor(first), http.StatusCreated, []byte(`{}`)))
+
+	adjusted := []string{}
+	h := api.Idempotency(service.NewIdempotencyStore(db, 0))(func(c echo.Context) error {
+		adjusted = append(adjusted, c.Param("id"))
+		return c.NoContent(http.StatusCreated)
+	})
+	call := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/accounts/"+id+"/adjustments", strings.NewReader(body))
+		req.Header.Set(api.IdempotencyKeyHeader, "key-1")
+		rec := httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetPath("/accounts/:id/adjustments")
+		c.SetParamNames("id")
+		c.SetParamValues(id)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"sub": userID.String()}})
+		require.NoError(t, h(c))
+		return rec
+	}
+
+	assert.Equal(t, http.StatusCreated, call(first).Code)
+	rec := call(second)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Empty(t, rec.Header().Get(api.IdempotentReplayedHeader))
+	assert.Equal(t, []string{first}, adjusted)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_StaleReservationIsTakenOver(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	userID := uuid.New()
+
+	// Reservations of crashed requests go once their lease ran out, like
+	// responses past the TTL
+	mock.ExpectExec(regexp.QuoteMeta(`AND (created_at < $3 OR (completed_at IS NULL AND created_at < $4))`)).
+		WithArgs(userID, "key-1", olderThan(service.DefaultIdempotencyTTL), olderThan(service.IdempotencyLease)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	token, stored, err := service.NewIdempotencyStore(db, 0).Reserve(context.Background(), userID, "key-1", "hash")
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, token)
+	assert.Nil(t, stored)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_TakenOverReservationIsLeftToItsNewHolder(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	store := service.NewIdempotencyStore(db, 0)
+	ctx := context.Background()
+	userID := uuid.New()
+	var stale, current capturedToken
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", "hash", &stale, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// The first request outlives its lease and a retry takes over
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", "hash", &current, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Whatever the first request does next misses the new reservation
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WithArgs(userID, "key-1", &stale).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys SET status_code")).
+		WithArgs(http.StatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg(), userID, "key-1", &stale).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE idempotency_keys SET status_code")).
+		WithArgs(http.StatusCreated, sqlmock.AnyArg(), sqlmock.AnyArg(), userID, "key-1", &current).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	first, _, err := store.Reserve(ctx, userID, "key-1", "hash")
+	require.NoError(t, err)
+	second, _, err := store.Reserve(ctx, userID, "key-1", "hash")
+	require.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	resp := service.StoredResponse{StatusCode: http.StatusCreated, Body: []byte(`{}`)}
+	require.NoError(t, store.Release(ctx, userID, "key-1", first))
+	require.NoError(t, store.Complete(ctx, userID, "key-1", first, resp))
+	require.NoError(t, store.Complete(ctx, userID, "key-1", second, resp))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotency_ReleasesAfterClientWentAway(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	e := echo.New()
+	userID := uuid.New()
+	var token capturedToken
+
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM idempotency_keys")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO idempotency_keys")).
+		WithArgs(userID, "key-1", sqlmock.AnyArg(), &token, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("AND reservation_token = $3 AND completed_at IS NULL")).
+		WithArgs(userID, "key-1", &token).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := api.Idempotency(service.NewIdempotencyStore(db, 0))(func(c echo.Context) error {
+		cancel()
+		return c.Request().Context().Err()
+	})
+
+	c, _ := newIdempotentRequest(t, e, userID, `{"amount":"1"}`)
+	c.SetRequest(c.Request().WithContext(ctx))
+	assert.ErrorIs(t, h(c), context.Canceled)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// capturedToken matches the reservation token it first sees, and only that
+// one afterwards.
+type capturedToken struct{ token uuid.UUID }
+
+func (c *capturedToken) Match(v driver.Value) bool {
+	id, err := uuid.Parse(fmt.Sprint(v))
+	if err != nil {
+		return false
+	}
+	if c.token == uuid.Nil {
+		c.token = id
+	}
+	return id == c.token
+}
+
+// olderThan matches a time about d ago.
+type olderThan time.Duration
+
+func (d olderThan) Match(v driver.Value) bool {
+	ts, ok := v.(time.Time)
+	return ok && time.Since(ts)-time.Duration(d) < time.Second && time.Since(ts) >= time.Duration(d)
+}
@@ -0,0 +1,168 @@
+package unit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/pkg/auth"
+)
+
+type testKey struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+}
+
+func newTestKey(t *testing.T, alg string) testKey {
+	t.Helper()
+	var (
+		priv crypto.Signer
+		err  error
+	)
+	if alg == auth.AlgRS256 {
+		priv, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, priv, err = ed25519.GenerateKey(rand.Reader)
+	}
+	require.NoError(t, err)
+	return testKey{kid: uuid.NewString(), alg: alg, priv: priv}
+}
+
+func (k testKey) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	token.Header["kid"] = k.kid
+	signed, err := token.SignedString(k.priv)
+	require.NoError(t, err)
+	return signed
+}
+
+// jwksServer publishes the keys *published points to and counts fetches.
+func jwksServer(t *testing.T, published *[]testKey, fetches *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		var set auth.JWKS
+		for _, k := range *published {
+			jwk, err := auth.NewJWK(k.kid, k.alg, k.priv.Public())
+			require.NoError(t, err)
+			set.Keys = append(set.Keys, jwk)
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(set))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestJWK_RoundTrip(t *testing.T) {
+	for _, alg := range auth.Algorithms {
+		key := newTestKey(t, alg)
+		jwk, err := auth.NewJWK(key.kid, alg, key.priv.Public())
+		require.NoError(t, err)
+		pub, err := jwk.PublicKey()
+		require.NoError(t, err)
+		assert.Equal(t, key.priv.Public(), pub, alg)
+	}
+}
+
+func TestJWKSCache_SelectsKeyByKID(t *testing.T) {
+	ed, rs := newTestKey(t, auth.AlgEdDSA), newTestKey(t, auth.AlgRS256)
+	published := []testKey{ed, rs}
+	var fetches atomic.Int32
+	cache := auth.NewJWKSCache(jwksServer(t, &published, &fetches).URL, nil)
+	require.NoError(t, cache.Refresh(context.Background()))
+
+	for _, key := range published {
+		token, err := jwt.Parse(key.sign(t, jwt.MapClaims{"sub": uuid.NewString()}), cache.Keyfunc)
+		require.NoError(t, err, key.alg)
+		assert.True(t, token.Valid)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// A key published for another algorithm does not verify
+	forged := testKey{kid: ed.kid, alg: auth.AlgRS256, priv: rs.priv}
+	_, err := jwt.Parse(forged.sign(t, jwt.MapClaims{"sub": uuid.NewString()}), cache.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestJWKSCache_FetchesRotatedKeys(t *testing.T) {
+	old := newTestKey(t, auth.AlgEdDSA)
+	published := []testKey{old}
+	var fetches atomic.Int32
+	cache := auth.NewJWKSCache(jwksServer(t, &published, &fetches).URL, nil)
+
+	// Nothing cached: the first token fetches the set
+	_, err := jwt.Parse(old.sign(t, jwt.MapClaims{}), cache.Keyfunc)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// A key rotated in right after is not refetched before the minimum
+	// interval, and unknown kids cannot force fetches either
+	rotated := newTestKey(t, auth.AlgEdDSA)
+	published = append(published, rotated)
+	_, err = jwt.Parse(rotated.sign(t, jwt.MapClaims{}), cache.Keyfunc)
+	assert.Error(t, err)
+	_, err = jwt.Parse(newTestKey(t, auth.AlgEdDSA).sign(t, jwt.MapClaims{}), cache.Keyfunc)
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+
+	// Retired keys stop verifying once the set no longer has them
+	published = []testKey{rotated}
+	require.NoError(t, cache.Refresh(context.Background()))
+	_, err = jwt.Parse(rotated.sign(t, jwt.MapClaims{}), cache.Keyfunc)
+	assert.NoError(t, err)
+	_, err = jwt.Parse(old.sign(t, jwt.MapClaims{}), cache.Keyfunc)
+	assert.Error(t, err)
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	key := newTestKey(t, auth.AlgEdDSA)
+	published := []testKey{key}
+	var fetches atomic.Int32
+	cache := auth.NewJWKSCache(jwksServer(t, &published, &fetches).URL, nil)
+	require.NoError(t, cache.Refresh(context.Background()))
+
+	e := echo.New()
+	g := e.Group("", api.JWT(cache.Keyfunc))
+	g.GET("/admin", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, api.RequireRole(api.RoleAdmin))
+
+	call := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	admin := jwt.MapClaims{"sub": uuid.NewString(), "token_use": auth.TokenUseAccess, "roles": []string{api.RoleAdmin}}
+	assert.Equal(t, http.StatusOK, call(key.sign(t, admin)))
+	assert.Equal(t, http.StatusForbidden, call(key.sign(t, jwt.MapClaims{"sub": uuid.NewString(), "token_use": auth.TokenUseAccess})))
+	// Login challenges are signed by the same keys
+	challenge := jwt.MapClaims{"sub": uuid.NewString(), "token_use": "mfa", "roles": []string{api.RoleAdmin}}
+	assert.Equal(t, http.StatusUnauthorized, call(key.sign(t, challenge)))
+	assert.Equal(t, http.StatusUnauthorized, call(newTestKey(t, auth.AlgEdDSA).sign(t, admin)))
+	assert.Equal(t, http.StatusUnauthorized, call(""))
+
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, admin)
+	hmac.Header["kid"] = key.kid
+	forged, err := hmac.SignedString([]byte("your-jwt-secret"))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, call(forged))
+}
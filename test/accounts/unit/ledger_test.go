@@ -0,0 +1,150 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+func TestJournalValidate(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+
+	cases := []struct {
+		name    string
+		journal service.Journal
+		valid   bool
+	}{
+		{"balanced", service.Journal{Reason: "transfer", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(-10)},
+			{AccountID: b, Asset: "BTC", Amount: decimal.NewFromInt(10)},
+		}}, true},
+		{"unbalanced", service.Journal{Reason: "transfer", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(-10)},
+			{AccountID: b, Asset: "BTC", Amount: decimal.NewFromInt(9)},
+		}}, false},
+		{"single leg", service.Journal{Reason: "transfer", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(10)},
+		}}, false},
+		{"zero leg", service.Journal{Reason: "transfer", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.Zero},
+			{AccountID: b, Asset: "BTC", Amount: decimal.Zero},
+		}}, false},
+		{"balanced per asset", service.Journal{Reason: "trade", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(-1)},
+			{AccountID: b, Asset: "BTC", Amount: decimal.NewFromInt(1)},
+			{AccountID: a, Asset: "USDT", Amount: decimal.NewFromInt(30000)},
+			{AccountID: b, Asset: "USDT", Amount: decimal.NewFromInt(-30000)},
+		}}, true},
+		{"mixed assets", service.Journal{Reason: "trade", Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(-1)},
+			{AccountID: b, Asset: "ETH", Amount: decimal.NewFromInt(1)},
+		}}, false},
+		{"missing reason", service.Journal{Postings: []service.Posting{
+			{AccountID: a, Asset: "BTC", Amount: decimal.NewFromInt(-1)},
+			{AccountID: b, Asset: "BTC", Amount: decimal.NewFromInt(1)},
+		}}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.journal.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, service.ErrInvalidJournal))
+		})
+	}
+}
+
+func TestPostJournal_UnbalancedTouchesNoRows(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	_, err := svc.PostJournal(context.Background(), service.Journal{
+		Reason: "correction",
+		Postings: []service.Posting{
+			{AccountID: uuid.New(), Asset: "USD", Amount: decimal.NewFromInt(5)},
+			{AccountID: model.ExternalAccountID, Asset: "USD", Amount: decimal.NewFromInt(-4)},
+		},
+	})
+	require.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostJournal_RejectsAmountsBeyondAssetScale(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "USD", 2, 1)
+	mock.ExpectRollback()
+
+	_, err := svc.PostJournal(context.Background(), service.Journal{
+		Reason: "correction",
+		Postings: []service.Posting{
+			{AccountID: uuid.New(), Asset: "USD", Amount: decimal.RequireFromString("0.001")},
+			{AccountID: model.ExternalAccountID, Asset: "USD", Amount: decimal.RequireFromString("-0.001")},
+		},
+	})
+	assert.True(t, errors.Is(err, service.ErrInvalidJournal))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostJournal_UnknownAsset(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT code, name, precision, scale FROM assets WHERE code = $1")).
+		WithArgs("DOGE").
+		WillReturnRows(sqlmock.NewRows([]string{"code", "name", "precision", "scale"}))
+	mock.ExpectRollback()
+
+	_, err := svc.PostJournal(context.Background(), service.Journal{
+		Reason: "deposit",
+		Postings: []service.Posting{
+			{AccountID: uuid.New(), Asset: "DOGE", Amount: decimal.NewFromInt(1)},
+			{AccountID: model.ExternalAccountID, Asset: "DOGE", Amount: decimal.NewFromInt(-1)},
+		},
+	})
+	assert.True(t, errors.Is(err, service.ErrUnknownAsset))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyBalance(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT b.asset, b.balance, COALESCE(SUM(l.amount), 0)")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"asset", "balance", "sum"}).
+			AddRow("BTC", "1.5", "1.5").
+			AddRow("USD", "150", "140"))
+
+	checks, err := svc.VerifyBalance(context.Background(), id)
+	require.NoError(t, err)
+	require.Len(t, checks, 2)
+	assert.True(t, checks[0].Consistent())
+	assert.False(t, checks[1].Consistent())
+	assert.True(t, checks[1].Ledger.Equal(decimal.NewFromInt(140)))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,55 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/pkg/auth"
+)
+
+func TestRequireMFA(t *testing.T) {
+	e := echo.New()
+	call := func(maxAge time.Duration, claims jwt.MapClaims) (*httptest.ResponseRecorder, error) {
+		rec := httptest.NewRecorder()
+		c := e.NewContext(httptest.NewRequest(http.MethodPost, "/accounts/transfers", nil), rec)
+		c.Set("user", &jwt.Token{Claims: claims})
+		return rec, api.RequireMFA(maxAge)(func(c echo.Context) error {
+			return c.NoContent(http.StatusNoContent)
+		})(c)
+	}
+	// Claims as decoded from JSON
+	claims := func(amr []interface{}, authTime time.Time) jwt.MapClaims {
+		return jwt.MapClaims{"sub": uuid.NewString(), "amr": amr, "auth_time": float64(authTime.Unix())}
+	}
+	otp := []interface{}{auth.AMRPassword, auth.AMROTP}
+
+	_, err := call(15*time.Minute, claims(otp, time.Now().Add(-time.Minute)))
+	assert.NoError(t, err)
+
+	for name, c := range map[string]jwt.MapClaims{
+		"password only": claims([]interface{}{auth.AMRPassword}, time.Now()),
+		"too old":       claims(otp, time.Now().Add(-time.Hour)),
+		"no auth_time":  {"sub": uuid.NewString(), "amr": otp},
+	} {
+		rec, err := call(15*time.Minute, c)
+		var he *echo.HTTPError
+		require.ErrorAs(t, err, &he, name)
+		assert.Equal(t, http.StatusForbidden, he.Code, name)
+		assert.Equal(t, `Bearer error="insufficient_user_authentication", max_age=900`, rec.Header().Get(echo.HeaderWWWAuthenticate), name)
+	}
+
+	// Any age
+	_, err = call(0, claims(otp, time.Now().Add(-24*time.Hour)))
+	assert.NoError(t, err)
+	_, err = call(0, claims([]interface{}{auth.AMRPassword}, time.Now()))
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package unit
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/db"
+)
+
+func TestEmbeddedMigrationsAreSequential(t *testing.T) {
+	conn, _, err := sqlmock.New()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	m, err := db.NewMigrator(conn)
+	require.NoError(t, err)
+
+	sources := m.ListSources()
+	require.NotEmpty(t, sources)
+	for i, s := range sources {
+		assert.Equal(t, int64(i+1), s.Version, s.Path)
+	}
+}
@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+var accountColumns = []string{"id", "owner_id", "account_type", "status", "created_at", "updated_at"}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := service.Cursor{Sort: service.SortCreatedDesc, CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC), ID: uuid.New()}
+	got, err := service.DecodeCursor(c.Encode())
+	require.NoError(t, err)
+	assert.True(t, c.CreatedAt.Equal(got.CreatedAt))
+	assert.Equal(t, c.ID, got.ID)
+
+	for _, token := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, err := service.DecodeCursor(token)
+		assert.True(t, errors.Is(err, service.ErrInvalidCursor), token)
+	}
+}
+
+func TestListAccounts_KeysetPages(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	ownerID := uuid.New()
+	now := time.Now().UTC()
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+
+	// First page of 2: three rows come back, so there is a next page
+	rows := sqlmock.NewRows(accountColumns)
+	for i, id := range ids {
+		rows.AddRow(id, ownerID, "spot", "active", now.Add(-time.Duration(i)*time.Minute), now)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts a WHERE a.owner_id = $1 ORDER BY")).
+		WithArgs(ownerID, 3).
+		WillReturnRows(rows)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+
+	page, err := svc.ListAccounts(context.Background(), service.AccountQuery{OwnerID: ownerID, Size: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Accounts, 2)
+	require.NotEmpty(t, page.NextCursor)
+
+	cursor, err := service.DecodeCursor(page.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, ids[1], cursor.ID)
+
+	// Second page continues after the cursor and is the last one
+	mock.ExpectQuery(regexp.QuoteMeta("AND (a.created_at, a.id) < ($2, $3) ORDER BY a.created_at DESC, a.id DESC LIMIT $4")).
+		WithArgs(ownerID, cursor.CreatedAt, cursor.ID, 3).
+		WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(ids[2], ownerID, "spot", "active", now.Add(-2*time.Minute), now))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+
+	page, err = svc.ListAccounts(context.Background(), service.AccountQuery{OwnerID: ownerID, Cursor: page.NextCursor, Size: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Accounts, 1)
+	assert.Empty(t, page.NextCursor)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAccounts_PageSize(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	ownerID := uuid.New()
+
+	for _, tt := range []struct{ requested, limit int }{
+		{0, service.DefaultPageSize + 1},
+		{10_000, service.MaxPageSize + 1},
+	} {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM accounts a WHERE a.owner_id = $1")).
+			WithArgs(ownerID, tt.limit).
+			WillReturnRows(sqlmock.NewRows(accountColumns))
+		page, err := svc.ListAccounts(context.Background(), service.AccountQuery{OwnerID: ownerID, Size: tt.requested})
+		require.NoError(t, err)
+		assert.Empty(t, page.Accounts)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
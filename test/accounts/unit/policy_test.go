@@ -0,0 +1,111 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/service"
+	"cex/pkg/apiutil"
+	"cex/pkg/errors"
+)
+
+func TestParseBalancePolicy(t *testing.T) {
+	policy, err := service.ParseBalancePolicy("futures:usdt=10000, futures:USD=500")
+	require.NoError(t, err)
+	assert.True(t, policy["futures"].CreditLimit("USDT").Equal(decimal.NewFromInt(10000)))
+	assert.True(t, policy["futures"].CreditLimit("USD").Equal(decimal.NewFromInt(500)))
+	assert.True(t, policy["spot"].CreditLimit("USDT").IsZero())
+
+	empty, err := service.ParseBalancePolicy("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	for _, spec := range []string{"futures:USDT", "USDT=5", "futures:USDT=abc", "futures:USDT=-1"} {
+		_, err := service.ParseBalancePolicy(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestBalancePolicy_Allows(t *testing.T) {
+	policy := service.BalancePolicy{
+		"futures": {CreditLimits: map[string]decimal.Decimal{"USDT": decimal.NewFromInt(100)}},
+	}
+
+	assert.True(t, policy.Allows("spot", "USDT", decimal.Zero))
+	assert.False(t, policy.Allows("spot", "USDT", decimal.RequireFromString("-0.01")))
+	assert.True(t, policy.Allows("futures", "USDT", decimal.NewFromInt(-100)))
+	assert.False(t, policy.Allows("futures", "USDT", decimal.NewFromInt(-101)))
+	assert.False(t, policy.Allows("futures", "BTC", decimal.NewFromInt(-1)))
+}
+
+// expectDebitUpTo expects UpdateBalance to reach the balance lock of the
+// debited account.
+func expectDebitUpTo(mock sqlmock.Sqlmock, id uuid.UUID, accountType string, balance, locked decimal.Decimal) {
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "USDT", 6, 2)
+	expectLockBalanceOf(mock, id, accountType, "USDT", balance, locked)
+}
+
+func TestUpdateBalance_RejectsDebitBeyondAvailable(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+	delta := decimal.NewFromInt(-60)
+
+	// Total 100, of which 50 is held: only 50 is available
+	expectDebitUpTo(mock, id, "spot", decimal.NewFromInt(100), decimal.NewFromInt(50))
+	mock.ExpectRollback()
+
+	err := svc.UpdateBalance(context.Background(), id, "USDT", delta)
+	require.True(t, errors.Is(err, service.ErrInsufficientFunds))
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// The typed error renders as 409 with its kind
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)
+	require.NoError(t, apiutil.HandleServiceError(c, err))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "InsufficientFunds", body["kind"])
+}
+
+func TestUpdateBalance_FuturesCreditLimit(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	policy, err := service.ParseBalancePolicy("futures:USDT=1000")
+	require.NoError(t, err)
+	svc := service.NewAccountService(db).WithBalancePolicy(policy)
+	id := uuid.New()
+
+	// 100 - 1100 = -1000 is exactly the credit limit
+	delta := decimal.NewFromInt(-1100)
+	expectDebitUpTo(mock, id, "futures", decimal.NewFromInt(100), decimal.Zero)
+	expectJournal(mock, "manual-update", nil)
+	expectExternalLeg(mock, "USDT", delta.Neg())
+	expectBalanceLeg(mock, id, "USDT", decimal.NewFromInt(100), delta)
+	expectEnqueue(mock, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	require.NoError(t, svc.UpdateBalance(context.Background(), id, "USDT", delta))
+
+	// One more unit crosses the limit
+	expectDebitUpTo(mock, id, "futures", decimal.NewFromInt(-1000), decimal.Zero)
+	mock.ExpectRollback()
+	err = svc.UpdateBalance(context.Background(), id, "USDT", decimal.NewFromInt(-1))
+	assert.True(t, errors.Is(err, service.ErrInsufficientFunds))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
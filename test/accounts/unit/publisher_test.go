@@ -0,0 +1,281 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/queue"
+	"cex/pkg/apiutil"
+	"cex/pkg/events"
+)
+
+var outboxColumns = []string{
+	"id", "event_id", "aggregate_id", "event_type", "payload", "attempts", "correlation_id", "sequence", "created_at",
+}
+
+// expectClaim expects a relay to lease rows in a single statement before
+// publishing them.
+func expectClaim(mock sqlmock.Sqlmock, batchSize int, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE account_outbox SET locked_by = $1")).
+		WithArgs(sqlmock.AnyArg(), (30 * time.Second).Milliseconds(), batchSize).
+		WillReturnRows(rows)
+}
+
+// expectPublished expects outbox row id to be marked published.
+func expectPublished(mock sqlmock.Sqlmock, id int64) {
+	mock.ExpectExec(regexp.QuoteMeta(
+		"UPDATE account_outbox SET published_at = $1, locked_by = NULL, locked_until = NULL WHERE id = $2")).
+		WithArgs(sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectAttempt expects a failed publish of outbox row id to be counted.
+func expectAttempt(mock sqlmock.Sqlmock, id int64, lastError string) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_outbox SET attempts = attempts + 1, last_error = $1 WHERE id = $2")).
+		WithArgs(lastError, id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectRelease expects a relay to drop its leases on unpublished rows.
+func expectRelease(mock sqlmock.Sqlmock, released int64) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_outbox SET locked_by = NULL, locked_until = NULL")).
+		WithArgs(sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, released))
+}
+
+// accountPublisher fails to publish the events of one account.
+type accountPublisher struct {
+	*queue.MemoryPublisher
+	failing uuid.UUID
+}
+
+func (p accountPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	if env.AggregateID == p.failing {
+		return errors.New("partition unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, env)
+}
+
+func TestRelayBatch_PublishesEnvelopes(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	pub := queue.NewMemoryPublisher()
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+	accountID, eventID := uuid.New(), uuid.New()
+	createdAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	// RETURNING does not keep the order of the ids
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(2, uuid.New(), accountID, queue.EventBalanceUpdated, []byte(`{"asset":"BTC","new_balance":"3"}`), 0, nil, 8, createdAt).
+		AddRow(1, eventID, accountID, queue.EventBalanceUpdated, []byte(`{"asset":"BTC","new_balance":"2"}`), 0, "req-1", 7, createdAt))
+	// Published outside the claiming transaction
+	expectPublished(mock, 1)
+	expectPublished(mock, 2)
+	expectRelease(mock, 0)
+
+	n, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	pub.AssertCount(t, queue.EventBalanceUpdated, 2)
+	published := pub.Events()
+	assert.Equal(t, eventID, published[0].ID)
+	assert.Equal(t, accountID, published[0].AggregateID)
+	assert.Equal(t, uint64(7), published[0].Sequence)
+	assert.Equal(t, "req-1", published[0].CorrelationID)
+	assert.Equal(t, queue.EventVersion(queue.EventBalanceUpdated), published[0].Version)
+	assert.True(t, createdAt.Equal(published[0].OccurredAt))
+
+	var ev apiutil.BalanceUpdatedEvent
+	env := pub.RequirePublished(t, queue.EventBalanceUpdated, &ev)
+	assert.Equal(t, uint64(8), env.Sequence)
+	assert.Equal(t, "3", ev.NewBalance)
+}
+
+func TestRelayBatch_HoldsBackAccountAfterFailure(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	pub := queue.NewMemoryPublisher()
+	pub.Err = errors.New("backend down")
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+	accountID := uuid.New()
+
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(1, uuid.New(), accountID, queue.EventAccountCreated, []byte(`{}`), 0, nil, 1, time.Now()).
+		AddRow(2, uuid.New(), accountID, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 2, time.Now()))
+	// Only the first event is attempted; the second waits for it
+	expectAttempt(mock, 1, "backend down")
+	expectRelease(mock, 2)
+
+	n, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+	pub.AssertNonePublished(t)
+}
+
+func TestRelayBatch_CountsAttemptsPerFailedAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	failing, healthy := uuid.New(), uuid.New()
+	pub := accountPublisher{MemoryPublisher: queue.NewMemoryPublisher(), failing: failing}
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(1, uuid.New(), failing, queue.EventBalanceUpdated, []byte(`{}`), 3, nil, 4, time.Now()).
+		AddRow(2, uuid.New(), healthy, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 1, time.Now()).
+		AddRow(3, uuid.New(), failing, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 5, time.Now()).
+		AddRow(4, uuid.New(), healthy, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 2, time.Now()))
+	// The failed account does not hold back the other one
+	expectAttempt(mock, 1, "partition unavailable")
+	expectPublished(mock, 2)
+	expectPublished(mock, 4)
+	expectRelease(mock, 2)
+
+	n, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	published := pub.Events()
+	require.Len(t, published, 2)
+	assert.Equal(t, uint64(1), published[0].Sequence)
+	assert.Equal(t, uint64(2), published[1].Sequence)
+}
+
+func TestRelayBatch_ReleasesLeasesWhenMarkingFails(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	pub := queue.NewMemoryPublisher()
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+	accountID := uuid.New()
+
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(1, uuid.New(), accountID, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 1, time.Now()).
+		AddRow(2, uuid.New(), accountID, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 2, time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE account_outbox SET published_at = $1")).
+		WillReturnError(errors.New("connection reset"))
+	expectRelease(mock, 2)
+
+	n, err := relay.RelayBatch(context.Background())
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRelayBatch_ClaimsNothingWhenAnotherRelayWins(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	pub := queue.NewMemoryPublisher()
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE account_outbox SET locked_by = $1")).
+		WillReturnError(&pq.Error{Code: "40001", Message: "restart transaction"})
+	expectRelease(mock, 0)
+
+	n, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+	pub.AssertNonePublished(t)
+}
+
+func TestRelayBatch_RetriesFailuresOnTheNextPoll(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	backend := &flakyPublisher{failures: fastRetry.MaxAttempts}
+	pub := queue.NewResilientPublisher("test-relay", backend, fastRetry, queue.BreakerSettings{}, zap.NewNop())
+	relay := queue.NewRelay(db, pub, queue.RelayConfig{BatchSize: 10}, zap.NewNop())
+	accountID, eventID := uuid.New(), uuid.New()
+
+	// The first poll gives up on the event once its retries ran out
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(1, eventID, accountID, queue.EventBalanceUpdated, []byte(`{}`), 0, nil, 1, time.Now()))
+	expectAttempt(mock, 1, "broker unavailable")
+	expectRelease(mock, 1)
+	n, err := relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 3, backend.calls)
+
+	expectClaim(mock, 10, sqlmock.NewRows(outboxColumns).
+		AddRow(1, eventID, accountID, queue.EventBalanceUpdated, []byte(`{}`), 1, nil, 1, time.Now()))
+	expectPublished(mock, 1)
+	expectRelease(mock, 0)
+	n, err = relay.RelayBatch(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 4, backend.calls)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestFilePublisher_AppendsNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	ctx := context.Background()
+	first, err := events.New(uuid.New(), queue.EventAccountCreated, 1, time.Now(), "", map[string]string{"account_type": "spot"})
+	require.NoError(t, err)
+	second, err := events.New(uuid.New(), queue.EventBalanceUpdated, 1, time.Now(), "", map[string]string{"asset": "BTC"})
+	require.NoError(t, err)
+
+	pub, err := queue.NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, pub.Publish(ctx, first))
+	require.NoError(t, pub.Close())
+
+	// Reopening appends instead of truncating
+	pub, err = queue.NewFilePublisher(path)
+	require.NoError(t, err)
+	require.NoError(t, pub.Publish(ctx, second))
+	require.NoError(t, pub.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	var got []events.Envelope
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var env events.Envelope
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &env))
+		got = append(got, env)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, got, 2)
+	assert.Equal(t, first.ID, got[0].ID)
+	assert.Equal(t, second.Type, got[1].Type)
+}
+
+func TestNewEventPublisher_SelectsBackend(t *testing.T) {
+	pub, err := queue.NewEventPublisher(queue.PublisherConfig{Backend: queue.BackendMemory})
+	require.NoError(t, err)
+	assert.IsType(t, &queue.MemoryPublisher{}, pub)
+
+	pub, err = queue.NewEventPublisher(queue.PublisherConfig{
+		Backend: queue.BackendFile,
+		File:    filepath.Join(t.TempDir(), "events.ndjson"),
+	})
+	require.NoError(t, err)
+	assert.IsType(t, &queue.FilePublisher{}, pub)
+	require.NoError(t, pub.Close())
+
+	_, err = queue.NewEventPublisher(queue.PublisherConfig{})
+	assert.Error(t, err, "kafka backend without brokers")
+	_, err = queue.NewEventPublisher(queue.PublisherConfig{Backend: queue.BackendFile})
+	assert.Error(t, err)
+	_, err = queue.NewEventPublisher(queue.PublisherConfig{Backend: "rabbitmq"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/reconcile"
+	"cex/pkg/events"
+)
+
+func TestLedgerBalancesExcludeExternalAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM ledger_entries")).
+		WithArgs(model.ExternalAccountID).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "sum"}).
+			AddRow(id, "BTC", "1.5").
+			AddRow(id, "USD", "-20"))
+
+	balances, err := reconcile.LedgerBalances(context.Background(), db)
+	require.NoError(t, err)
+	assert.Len(t, balances, 2)
+	assert.True(t, balances[reconcile.Key{AccountID: id, Asset: "BTC"}].Equal(decimal.RequireFromString("1.5")))
+	assert.True(t, balances[reconcile.Key{AccountID: id, Asset: "USD"}].Equal(decimal.RequireFromString("-20")))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompareReportsDiscrepancies(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	dec := decimal.RequireFromString
+	ledger := reconcile.Balances{
+		{AccountID: a, Asset: "BTC"}: dec("1.5"),
+		{AccountID: a, Asset: "USD"}: dec("100"),
+		{AccountID: b, Asset: "USD"}: dec("7"),
+	}
+	projected := reconcile.Balances{
+		{AccountID: a, Asset: "BTC"}: dec("1.50"),
+		{AccountID: a, Asset: "USD"}: dec("90"),
+		{AccountID: b, Asset: "USD"}: dec("7"),
+	}
+	events := reconcile.Balances{
+		{AccountID: a, Asset: "BTC"}: dec("1.5"),
+		{AccountID: a, Asset: "USD"}: dec("100"),
+	}
+
+	report := reconcile.Compare(ledger, projected, events)
+	assert.Equal(t, 3, report.Checked)
+	assert.True(t, report.EventsChecked)
+	require.Len(t, report.Discrepancies, 2)
+
+	byKey := map[string]reconcile.Discrepancy{}
+	for _, d := range report.Discrepancies {
+		byKey[d.Source+"/"+d.AccountID.String()] = d
+	}
+	proj := byKey[reconcile.SourceProjection+"/"+a.String()]
+	assert.Equal(t, "USD", proj.Asset)
+	assert.True(t, proj.Actual.Equal(dec("90")))
+	assert.False(t, proj.Missing)
+	ev := byKey[reconcile.SourceEvents+"/"+b.String()]
+	assert.True(t, ev.Ledger.Equal(dec("7")))
+	assert.True(t, ev.Missing)
+}
+
+func TestCompareWithoutEvents(t *testing.T) {
+	k := reconcile.Key{AccountID: uuid.New(), Asset: "USD"}
+	report := reconcile.Compare(
+		reconcile.Balances{k: decimal.NewFromInt(5)},
+		reconcile.Balances{k: decimal.NewFromInt(5)},
+		nil,
+	)
+	assert.False(t, report.EventsChecked)
+	assert.Empty(t, report.Discrepancies)
+}
+
+func TestEventProjectionKeepsLatestBalance(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	proj := reconcile.NewEventProjection()
+	balanceUpdated := func(balance, at string) events.Envelope {
+		return events.Envelope{
+			Type:    queue.EventBalanceUpdated,
+			Version: 1,
+			Payload: json.RawMessage(`{"account_id":"` + id.String() + `","asset":"USD","new_balance":"` + balance + `","timestamp":"` + at + `"}`),
+		}
+	}
+
+	require.NoError(t, proj.Apply(ctx, balanceUpdated("30", "2024-06-02T00:00:00Z")))
+	// Delivered late from another partition
+	require.NoError(t, proj.Apply(ctx, balanceUpdated("10", "2024-06-01T00:00:00Z")))
+	// Other event types carry no balance
+	require.NoError(t, proj.Apply(ctx, events.Envelope{
+		Type:    queue.EventAccountCreated,
+		Payload: json.RawMessage(`{"account_id":"` + id.String() + `","asset":"USD","account_type":"spot"}`),
+	}))
+	assert.Error(t, proj.Apply(ctx, events.Envelope{Payload: json.RawMessage(`not json`)}))
+
+	balances := proj.Balances()
+	assert.Len(t, balances, 1)
+	assert.True(t, balances[reconcile.Key{AccountID: id, Asset: "USD"}].Equal(decimal.NewFromInt(30)))
+}
+
+func TestEventProjectionReadsLegacyEvents(t *testing.T) {
+	ctx := context.Background()
+	id := uuid.New()
+	proj := reconcile.NewEventProjection()
+
+	// Published before envelopes: no headers, the value is the bare event
+	env, err := events.FromMessage(kafka.Message{
+		Value: []byte(`{"account_id":"` + id.String() + `","asset":"BTC","new_balance":"0.5","timestamp":"2024-06-01T00:00:00Z"}`),
+	})
+	require.NoError(t, err)
+	require.NoError(t, proj.Apply(ctx, env))
+	assert.True(t, proj.Balances()[reconcile.Key{AccountID: id, Asset: "BTC"}].Equal(decimal.RequireFromString("0.5")))
+}
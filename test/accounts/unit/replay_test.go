@@ -0,0 +1,183 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/queue"
+	"cex/internal/accounts/reconcile"
+	"cex/internal/accounts/replay"
+	"cex/pkg/events"
+)
+
+// writeEventsFile publishes balance updates of account id through the file
+// backend, one per balance, an hour apart from 2024-06-01.
+func writeEventsFile(t *testing.T, id uuid.UUID, balances ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	pub, err := queue.NewFilePublisher(path)
+	require.NoError(t, err)
+	defer pub.Close()
+
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i, balance := range balances {
+		at := start.Add(time.Duration(i) * time.Hour)
+		payload := `{"account_id":"` + id.String() + `","asset":"USD","new_balance":"` + balance + `","timestamp":"` + at.Format(time.RFC3339) + `"}`
+		env, err := events.New(uuid.New(), queue.EventBalanceUpdated, 1, at, "", json.RawMessage(payload))
+		require.NoError(t, err)
+		env.AggregateID = id
+		env.Sequence = uint64(i + 1)
+		require.NoError(t, pub.Publish(context.Background(), env))
+	}
+	return path
+}
+
+func TestReplay_RebuildsBalancesFromFile(t *testing.T) {
+	id := uuid.New()
+	path := writeEventsFile(t, id, "10", "25", "40")
+	src, err := replay.NewFileSource(path, replay.Start{})
+	require.NoError(t, err)
+	defer src.Close()
+
+	var reports []replay.Progress
+	r := replay.New(replay.Options{
+		ProgressInterval: time.Nanosecond,
+		OnProgress:       func(p replay.Progress) { reports = append(reports, p) },
+	})
+	balances, sequences := reconcile.NewEventProjection(), replay.NewSequences()
+	r.Register(balances, sequences)
+
+	progress, err := r.Run(context.Background(), src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), progress.Read)
+	assert.Equal(t, int64(3), progress.Applied["balances"])
+	assert.Equal(t, int64(3), progress.Applied["sequences"])
+	assert.Equal(t, "line 3", progress.Position)
+	assert.NotEmpty(t, reports)
+	assert.Equal(t, progress.Read, reports[len(reports)-1].Read)
+
+	assert.True(t, balances.Balances()[reconcile.Key{AccountID: id, Asset: "USD"}].Equal(decimal.NewFromInt(40)))
+	report := sequences.Report().(replay.SequenceReport)
+	assert.Equal(t, 1, report.Accounts)
+	assert.Empty(t, report.Gaps)
+}
+
+func TestReplay_DryRunDoesNotApply(t *testing.T) {
+	id := uuid.New()
+	src, err := replay.NewFileSource(writeEventsFile(t, id, "10", "25"), replay.Start{})
+	require.NoError(t, err)
+	defer src.Close()
+
+	r := replay.New(replay.Options{DryRun: true})
+	balances := reconcile.NewEventProjection()
+	r.Register(balances)
+
+	progress, err := r.Run(context.Background(), src)
+	require.NoError(t, err)
+	assert.True(t, progress.DryRun)
+	assert.Equal(t, int64(2), progress.Applied["balances"])
+	assert.Empty(t, balances.Balances())
+}
+
+func TestReplay_FileSourceStart(t *testing.T) {
+	id := uuid.New()
+	path := writeEventsFile(t, id, "10", "25", "40")
+	read := func(from replay.Start) []uint64 {
+		src, err := replay.NewFileSource(path, from)
+		require.NoError(t, err)
+		defer src.Close()
+		var seqs []uint64
+		for {
+			rec, err := src.Next(context.Background())
+			if err != nil {
+				return seqs
+			}
+			seqs = append(seqs, rec.Envelope.Sequence)
+		}
+	}
+
+	assert.Equal(t, []uint64{1, 2, 3}, read(replay.Start{}))
+	assert.Equal(t, []uint64{1, 2, 3}, read(replay.Start{AfterOffset: true, Offset: 0}))
+	assert.Equal(t, []uint64{3}, read(replay.Start{AfterOffset: true, Offset: 2}))
+	assert.Equal(t, []uint64{2, 3}, read(replay.Start{Time: time.Date(2024, 6, 1, 1, 0, 0, 0, time.UTC)}))
+}
+
+func TestStart_PartitionStartIsAfterOffset(t *testing.T) {
+	// Without -from-offset every retained message is read
+	assert.Equal(t, int64(0), replay.Start{}.PartitionStart(0))
+	assert.Equal(t, int64(4), replay.Start{}.PartitionStart(4))
+	// Offset 0 is a message of its own, unlike line 0 of a file
+	assert.Equal(t, int64(1), replay.Start{AfterOffset: true, Offset: 0}.PartitionStart(0))
+	assert.Equal(t, int64(3), replay.Start{AfterOffset: true, Offset: 2}.PartitionStart(0))
+	// Offsets that are no longer retained are clamped
+	assert.Equal(t, int64(7), replay.Start{AfterOffset: true, Offset: 2}.PartitionStart(7))
+}
+
+// failingProjection rejects every event.
+type failingProjection struct{}
+
+func (failingProjection) Name() string        { return "failing" }
+func (failingProjection) Handles(string) bool { return true }
+func (failingProjection) Apply(context.Context, events.Envelope) error {
+	return errors.New("boom")
+}
+
+func TestReplay_StopsAtFailingEvent(t *testing.T) {
+	src, err := replay.NewFileSource(writeEventsFile(t, uuid.New(), "10", "25"), replay.Start{AfterOffset: true, Offset: 1})
+	require.NoError(t, err)
+	defer src.Close()
+
+	r := replay.New(replay.Options{})
+	r.Register(failingProjection{})
+	progress, err := r.Run(context.Background(), src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: failing")
+	assert.Equal(t, int64(1), progress.Read)
+	assert.Zero(t, progress.Applied["failing"])
+}
+
+func TestReplay_MalformedLine(t *testing.T) {
+	src := replay.NewReaderSource(strings.NewReader("{\"type\":\"balance.updated\"}\nnot json\n"), replay.Start{})
+	r := replay.New(replay.Options{})
+	r.Register(replay.NewSequences())
+
+	_, err := r.Run(context.Background(), src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestReplay_RequiresProjection(t *testing.T) {
+	_, err := replay.New(replay.Options{}).Run(context.Background(), replay.NewReaderSource(&bytes.Buffer{}, replay.Start{}))
+	assert.Error(t, err)
+}
+
+func TestSequences_ReportsGapsAndStaleEvents(t *testing.T) {
+	ctx := context.Background()
+	a, b := uuid.New(), uuid.New()
+	env := func(id uuid.UUID, seq uint64) events.Envelope {
+		return events.Envelope{Type: queue.EventBalanceUpdated, AggregateID: id, Sequence: seq}
+	}
+
+	s := replay.NewSequences()
+	// b starts mid-stream: its first event is the baseline, not a gap
+	for _, e := range []events.Envelope{env(a, 1), env(b, 7), env(a, 2), env(a, 5), env(b, 8), env(a, 3), {}} {
+		require.NoError(t, s.Apply(ctx, e))
+	}
+
+	report := s.Report().(replay.SequenceReport)
+	assert.Equal(t, 2, report.Accounts)
+	assert.Equal(t, int64(1), report.Stale)
+	assert.Equal(t, int64(1), report.Unsequenced)
+	assert.Equal(t, []replay.SequenceGap{{AccountID: a.String(), Expected: 3, Got: 5}}, report.Gaps)
+}
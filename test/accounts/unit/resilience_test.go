@@ -0,0 +1,152 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"github.com/sony/gobreaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"cex/internal/accounts/metrics"
+	"cex/internal/accounts/queue"
+	"cex/pkg/events"
+)
+
+// flakyPublisher fails its first failures publishes.
+type flakyPublisher struct {
+	queue.MemoryPublisher
+	failures int
+	calls    int
+}
+
+func (p *flakyPublisher) Publish(ctx context.Context, env events.Envelope) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("broker unavailable")
+	}
+	return p.MemoryPublisher.Publish(ctx, env)
+}
+
+var fastRetry = queue.RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     2 * time.Millisecond,
+}
+
+func TestRetryPolicy_BackoffGrowsWithinJitter(t *testing.T) {
+	p := queue.RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Jitter:         0.5,
+	}
+	for attempt, base := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		9: time.Second,
+	} {
+		for range 20 {
+			d := p.Backoff(attempt)
+			assert.LessOrEqual(t, d, base, "attempt %d", attempt)
+			assert.GreaterOrEqual(t, d, base/2, "attempt %d", attempt)
+		}
+	}
+}
+
+func TestRetryPolicy_WaitHonorsContext(t *testing.T) {
+	p := queue.RetryPolicy{InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := p.Wait(ctx, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestRetryPolicy_DoStopsOnRejectedErrors(t *testing.T) {
+	permanent := errors.New("bad request")
+	calls := 0
+	attempts, err := fastRetry.Do(context.Background(),
+		func(err error) bool { return !errors.Is(err, permanent) },
+		func(ctx context.Context) error {
+			calls++
+			return permanent
+		})
+	assert.ErrorIs(t, err, permanent)
+	assert.Equal(t, 1, attempts)
+	assert.Equal(t, 1, calls)
+}
+
+func TestResilientPublisher_RetriesTransientFailures(t *testing.T) {
+	backend := &flakyPublisher{failures: 2}
+	pub := queue.NewResilientPublisher("test-retry", backend, fastRetry, queue.BreakerSettings{}, zap.NewNop())
+
+	require.NoError(t, pub.Publish(context.Background(), events.Envelope{Type: queue.EventAccountCreated}))
+	assert.Equal(t, 3, backend.calls)
+	backend.AssertCount(t, queue.EventAccountCreated, 1)
+	assert.Equal(t, gobreaker.StateClosed, pub.State())
+}
+
+func TestResilientPublisher_BreakerOpensAndExportsState(t *testing.T) {
+	backend := &flakyPublisher{failures: 100}
+	pub := queue.NewResilientPublisher("test-breaker", backend, fastRetry, queue.BreakerSettings{
+		FailureThreshold: 4,
+		Timeout:          time.Hour,
+	}, zap.NewNop())
+	state := metrics.BreakerState.WithLabelValues("test-breaker")
+	assert.Equal(t, 0.0, testutil.ToFloat64(state))
+
+	// Three attempts, then one more trips the breaker on the second publish
+	ctx := context.Background()
+	assert.Error(t, pub.Publish(ctx, events.Envelope{}))
+	assert.Equal(t, 3, backend.calls)
+	err := pub.Publish(ctx, events.Envelope{})
+	assert.ErrorIs(t, err, gobreaker.ErrOpenState)
+	assert.Equal(t, 4, backend.calls, "no retries once the breaker is open")
+	assert.Equal(t, gobreaker.StateOpen, pub.State())
+	assert.Equal(t, 2.0, testutil.ToFloat64(state))
+
+	// Open breakers fail fast without reaching the backend
+	assert.ErrorIs(t, pub.Publish(ctx, events.Envelope{}), gobreaker.ErrOpenState)
+	assert.Equal(t, 4, backend.calls)
+}
+
+func TestResilientPublisher_WriterSharesTheBreaker(t *testing.T) {
+	backend := &flakyPublisher{failures: 100}
+	pub := queue.NewResilientPublisher("test-writer", backend, fastRetry, queue.BreakerSettings{
+		FailureThreshold: 3,
+		Timeout:          time.Hour,
+	}, zap.NewNop())
+	ctx := context.Background()
+	dlq := &fakeWriter{}
+	w := pub.Writer(dlq)
+
+	// Writes are retried like publishes
+	require.NoError(t, w.WriteMessages(ctx, kafka.Message{Value: []byte("dead")}))
+	assert.Len(t, dlq.written, 1)
+
+	// Failed publishes open the breaker for writes too
+	assert.Error(t, pub.Publish(ctx, events.Envelope{}))
+	assert.ErrorIs(t, w.WriteMessages(ctx, kafka.Message{}), gobreaker.ErrOpenState)
+	assert.Equal(t, 1, dlq.calls)
+}
+
+func TestResilientPublisher_GivesUpOnCancel(t *testing.T) {
+	backend := &flakyPublisher{failures: 100}
+	slow := queue.RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	pub := queue.NewResilientPublisher("test-cancel", backend, slow, queue.BreakerSettings{}, zap.NewNop())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, pub.Publish(ctx, events.Envelope{}))
+	assert.Equal(t, 1, backend.calls)
+	assert.Less(t, time.Since(start), time.Second)
+}
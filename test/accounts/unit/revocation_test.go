@@ -0,0 +1,106 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/pkg/auth"
+)
+
+// revocationServer serves list and records the since parameter of every
+// request.
+func revocationServer(t *testing.T, list *auth.RevocationList, since *[]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*since = append(*since, r.URL.Query().Get("since"))
+		require.NoError(t, json.NewEncoder(w).Encode(list))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDenylist_Refresh(t *testing.T) {
+	now := time.Now().UTC()
+	revokedAt := now.Add(-time.Second).Truncate(time.Millisecond)
+	list := &auth.RevocationList{Revocations: []auth.Revocation{
+		{JTI: "live", ExpiresAt: now.Add(time.Minute), RevokedAt: revokedAt},
+		{JTI: "expired", ExpiresAt: now.Add(-time.Minute), RevokedAt: revokedAt.Add(-time.Hour)},
+	}}
+	var since []string
+	srv := revocationServer(t, list, &since)
+
+	d := auth.NewDenylist(srv.URL, nil)
+	assert.False(t, d.IsRevoked("live"))
+	require.NoError(t, d.Refresh(context.Background()))
+	assert.True(t, d.IsRevoked("live"))
+	assert.False(t, d.IsRevoked("expired"))
+	assert.False(t, d.IsRevoked("other"))
+
+	// Later polls only ask for recent revocations, with some overlap
+	list.Revocations = nil
+	require.NoError(t, d.Refresh(context.Background()))
+	require.Len(t, since, 2)
+	assert.Empty(t, since[0])
+	polled, err := time.Parse(time.RFC3339Nano, since[1])
+	require.NoError(t, err)
+	assert.True(t, polled.Before(revokedAt), since[1])
+	assert.True(t, d.IsRevoked("live"), "entries stay until the token expires")
+}
+
+func TestDenylist_RefreshFailureKeepsEntries(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(auth.RevocationList{Revocations: []auth.Revocation{
+			{JTI: "live", ExpiresAt: time.Now().Add(time.Minute), RevokedAt: time.Now()},
+		}})
+	}))
+	defer srv.Close()
+
+	d := auth.NewDenylist(srv.URL, nil)
+	require.NoError(t, d.Refresh(context.Background()))
+	status = http.StatusBadGateway
+	assert.Error(t, d.Refresh(context.Background()))
+	assert.True(t, d.IsRevoked("live"))
+}
+
+func TestRejectRevoked(t *testing.T) {
+	revoked := uuid.NewString()
+	var since []string
+	srv := revocationServer(t, &auth.RevocationList{Revocations: []auth.Revocation{
+		{JTI: revoked, ExpiresAt: time.Now().Add(time.Minute), RevokedAt: time.Now()},
+	}}, &since)
+	d := auth.NewDenylist(srv.URL, nil)
+	require.NoError(t, d.Refresh(context.Background()))
+
+	e := echo.New()
+	h := api.RejectRevoked(d)(func(c echo.Context) error {
+		return c.NoContent(http.StatusNoContent)
+	})
+	call := func(claims jwt.MapClaims) error {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/accounts", nil), httptest.NewRecorder())
+		c.Set("user", &jwt.Token{Claims: claims})
+		return h(c)
+	}
+
+	var he *echo.HTTPError
+	require.ErrorAs(t, call(jwt.MapClaims{"sub": uuid.NewString(), "jti": revoked}), &he)
+	assert.Equal(t, http.StatusUnauthorized, he.Code)
+	assert.NoError(t, call(jwt.MapClaims{"sub": uuid.NewString(), "jti": uuid.NewString()}))
+	// Tokens without a jti cannot be revoked
+	assert.NoError(t, call(jwt.MapClaims{"sub": uuid.NewString()}))
+}
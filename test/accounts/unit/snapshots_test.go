@@ -0,0 +1,105 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+func TestBalanceAt(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+	at := time.Date(2024, 6, 30, 23, 59, 59, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(id, uuid.New(), "spot", "active", at, at))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+	// Latest snapshot at or before at, plus the entries after it
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE account_id = a.account_id AND asset = a.asset AND taken_at <= $2")).
+		WithArgs(id, at).
+		WillReturnRows(sqlmock.NewRows([]string{"asset", "balance"}).
+			AddRow("BTC", "1.25").
+			AddRow("USD", "300"))
+
+	balances, err := svc.BalanceAt(context.Background(), id, at)
+	require.NoError(t, err)
+	assert.True(t, balances["BTC"].Equal(decimal.RequireFromString("1.25")))
+	assert.True(t, balances["USD"].Equal(decimal.NewFromInt(300)))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBalanceAt_UnknownAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows(accountColumns))
+
+	_, err := svc.BalanceAt(context.Background(), id, time.Now())
+	assert.True(t, errors.Is(err, service.ErrAccountNotFound))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectSnapshotCutoff expects the lookup of the time snapshots requested at
+// at are taken at.
+func expectSnapshotCutoff(mock sqlmock.Sqlmock, at, takenAt time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT LEAST($1::timestamptz, now() - $2 * interval '1 millisecond')")).
+		WithArgs(at, service.SnapshotLag.Milliseconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"least"}).AddRow(takenAt))
+}
+
+func TestTakeSnapshots(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	at := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	expectSnapshotCutoff(mock, at, at)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO balance_snapshots (account_id, asset, taken_at, balance)")).
+		WithArgs(at).
+		WillReturnResult(sqlmock.NewResult(0, 42))
+
+	takenAt, n, err := svc.TakeSnapshots(context.Background(), at)
+	require.NoError(t, err)
+	assert.Equal(t, at, takenAt)
+	assert.Equal(t, int64(42), n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTakeSnapshots_StaysSnapshotLagBehindTheDatabaseClock(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	dbNow := time.Date(2024, 7, 1, 0, 0, 30, 0, time.UTC)
+
+	// Postings stamped up to now may still be in flight
+	expectSnapshotCutoff(mock, dbNow, dbNow.Add(-service.SnapshotLag))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO balance_snapshots (account_id, asset, taken_at, balance)")).
+		WithArgs(dbNow.Add(-service.SnapshotLag)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	takenAt, _, err := svc.TakeSnapshots(context.Background(), dbNow)
+	require.NoError(t, err)
+	assert.Equal(t, dbNow.Add(-service.SnapshotLag), takenAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Postings commit within TxTimeout of their stamp, so the lag covers them
+	assert.Less(t, 2*service.TxTimeout, service.SnapshotLag)
+}
@@ -0,0 +1,110 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/model"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+func expectLockAccountStatus(mock sqlmock.Sqlmock, id uuid.UUID, status model.AccountStatus) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status FROM accounts WHERE id = $1 FOR UPDATE")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(status))
+}
+
+func TestAccountStatus_Transitions(t *testing.T) {
+	assert.True(t, model.AccountActive.CanTransitionTo(model.AccountFrozen))
+	assert.True(t, model.AccountFrozen.CanTransitionTo(model.AccountActive))
+	assert.True(t, model.AccountActive.CanTransitionTo(model.AccountClosed))
+	assert.False(t, model.AccountFrozen.CanTransitionTo(model.AccountClosed))
+	assert.False(t, model.AccountClosed.CanTransitionTo(model.AccountActive))
+	assert.False(t, model.AccountActive.CanTransitionTo(model.AccountActive))
+}
+
+func TestFreezeAccount_AuditsAndPublishes(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, operatorID, ownerID := uuid.New(), uuid.New(), uuid.New()
+	now := time.Now().UTC()
+
+	mock.ExpectBegin()
+	expectLockAccountStatus(mock, id, model.AccountActive)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE accounts SET status = $1")).
+		WithArgs(model.AccountFrozen, sqlmock.AnyArg(), id).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO account_status_changes")).
+		WithArgs(sqlmock.AnyArg(), id, model.AccountActive, model.AccountFrozen, "sanctions screening hit", operatorID, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEnqueue(mock, id, "account.frozen", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "account_type", "status", "created_at", "updated_at"}).
+			AddRow(id, ownerID, "spot", "frozen", now, now))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+
+	acct, err := svc.FreezeAccount(context.Background(), id, operatorID, "sanctions screening hit")
+	require.NoError(t, err)
+	assert.Equal(t, model.AccountFrozen, acct.Status)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangeStatus_Rejects(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id, actorID := uuid.New(), uuid.New()
+
+	// Closed accounts stay closed
+	mock.ExpectBegin()
+	expectLockAccountStatus(mock, id, model.AccountClosed)
+	mock.ExpectRollback()
+	_, err := svc.UnfreezeAccount(context.Background(), id, actorID, "mistake")
+	assert.True(t, errors.Is(err, service.ErrInvalidStatusTransition))
+
+	// Closing requires zero balances
+	mock.ExpectBegin()
+	expectLockAccountStatus(mock, id, model.AccountActive)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS")).
+		WithArgs(id).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectRollback()
+	_, err = svc.CloseAccount(context.Background(), id, actorID, "no longer needed")
+	assert.True(t, errors.Is(err, service.ErrAccountNotEmpty))
+
+	_, err = svc.FreezeAccount(context.Background(), id, actorID, "")
+	assert.True(t, errors.Is(err, service.ErrInvalidStatusChange))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateBalance_FrozenAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+	delta := decimal.NewFromInt(-10)
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "USDT", 6, 2)
+	// Rejected before anything is written
+	expectLockAccountBalance(mock, id, "spot", model.AccountFrozen, "USDT", decimal.NewFromInt(100), decimal.Zero)
+	mock.ExpectRollback()
+
+	err := svc.UpdateBalance(context.Background(), id, "USDT", delta)
+	assert.True(t, errors.Is(err, service.ErrAccountFrozen))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,19 @@
+
+$4e5f6a7b-8c9d-4e0f-a1b2-c3d4e5f6a7b8account.closed"Ȩ*req-422
+
+
+new_statusclosed
+
+reasoncompliance review
+2
+actor_id&$0b9d8c7e-6f5a-4b3c-8d2e-1f0a9b8c7d6e
+#
+	timestamp2024-06-01T12:30:00Z
+2
+event_id&$4e5f6a7b-8c9d-4e0f-a1b2-c3d4e5f6a7b8
+4
+
+account_id&$6f1c2a0e-8d7b-4c35-9a41-2b7e5f0c9d13
+
+
+old_statusactive
\ No newline at end of file
@@ -0,0 +1,13 @@
+
+$3d1e6a52-0c7b-4f8e-9b2a-5e4d3c2b1a09account.created"Ȩ*req-422
+2
+event_id&$3d1e6a52-0c7b-4f8e-9b2a-5e4d3c2b1a09
+4
+
+account_id&$6f1c2a0e-8d7b-4c35-9a41-2b7e5f0c9d13
+2
+owner_id&$9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d
+
+account_typespot
+#
+	timestamp2024-06-01T12:30:00Z
\ No newline at end of file
@@ -0,0 +1,22 @@
+
+$7c5d4e3f-2a1b-4c0d-9e8f-7a6b5c4d3e2fbalance.updated"Ȩ*req-422
+
+reason
+withdrawal
+4
+
+account_id&$6f1c2a0e-8d7b-4c35-9a41-2b7e5f0c9d13
+%
+new_balance0.750000000000000001
+2
+event_id&$7c5d4e3f-2a1b-4c0d-9e8f-7a6b5c4d3e2f
+
+assetBTC
+5
+operator_id&$0b9d8c7e-6f5a-4b3c-8d2e-1f0a9b8c7d6e
+#
+	timestamp2024-06-01T12:30:00Z
+%
+old_balance1.000000000000000001
+
+delta-0.25
\ No newline at end of file
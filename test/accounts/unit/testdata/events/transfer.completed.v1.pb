@@ -0,0 +1,16 @@
+
+$1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5dtransfer.completed"Ȩ*req-422
+
+amount125.5
+#
+	timestamp2024-06-01T12:30:00Z
+2
+event_id&$1a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d
+5
+transfer_id&$5d4c3b2a-1f0e-4d9c-8b7a-6f5e4d3c2b1a
+9
+from_account_id&$6f1c2a0e-8d7b-4c35-9a41-2b7e5f0c9d13
+7
+to_account_id&$2c3d4e5f-6a7b-4c8d-9e0f-1a2b3c4d5e6f
+
+assetUSDT
\ No newline at end of file
@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/accounts/api"
+	"cex/internal/accounts/service"
+	"cex/pkg/errors"
+)
+
+func TestTransfer_LocksAccountsInIDOrder(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+
+	from, to := uuid.New(), uuid.New()
+	first, second := from, to
+	if bytes.Compare(to[:], from[:]) < 0 {
+		first, second = to, from
+	}
+	amount := decimal.NewFromInt(25)
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "BTC", 8, 2)
+	deltas := map[uuid.UUID]decimal.Decimal{from: amount.Neg(), to: amount}
+	for _, id := range []uuid.UUID{first, second} {
+		expectLockBalance(mock, id, "BTC", decimal.NewFromInt(100), decimal.Zero)
+	}
+	// Stamped once both balances are locked
+	createdAt := expectJournal(mock, "transfer", nil)
+	for _, id := range []uuid.UUID{first, second} {
+		expectBalanceLeg(mock, id, "BTC", decimal.NewFromInt(100), deltas[id])
+	}
+	// Two BalanceUpdated events and the TransferCompleted event
+	expectEnqueue(mock, first, "balance.updated", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEnqueue(mock, second, "balance.updated", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	expectEnqueue(mock, from, "transfer.completed", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	transfer, err := svc.Transfer(context.Background(), from, to, "BTC", amount)
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, transfer.ID)
+	assert.True(t, transfer.Amount.Equal(amount))
+	assert.Equal(t, createdAt, transfer.CreatedAt)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransfer_Rejects(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	id := uuid.New()
+
+	_, err := svc.Transfer(context.Background(), id, id, "BTC", decimal.NewFromInt(1))
+	assert.True(t, errors.Is(err, service.ErrInvalidTransfer))
+
+	_, err = svc.Transfer(context.Background(), id, uuid.New(), "BTC", decimal.NewFromInt(-1))
+	assert.True(t, errors.Is(err, service.ErrInvalidTransfer))
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransfer_UnknownAccount(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+
+	mock.ExpectBegin()
+	expectAssetLookups(mock, "BTC", 8, 2)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT account_type, status FROM accounts WHERE id = $1 FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows([]string{"account_type", "status"}))
+	mock.ExpectRollback()
+
+	_, err := svc.Transfer(context.Background(), uuid.New(), uuid.New(), "BTC", decimal.NewFromInt(1))
+	assert.True(t, errors.Is(err, service.ErrAccountNotFound))
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTransferHandler_HidesAccountsOfOtherUsers(t *testing.T) {
+	db, mock, _ := sqlmock.New()
+	defer db.Close()
+	svc := service.NewAccountService(db)
+	userID, own, foreign, missing := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	now := time.Now()
+
+	transfer := func(to uuid.UUID) *httptest.ResponseRecorder {
+		body := `{"from_account_id":"` + own.String() + `","to_account_id":"` + to.String() + `","asset":"USD","amount":"5"}`
+		req := httptest.NewRequest(http.MethodPost, "/accounts/transfers", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set("user", &jwt.Token{Claims: jwt.MapClaims{"sub": userID.String()}})
+		require.NoError(t, api.TransferHandler(svc)(c))
+		return rec
+	}
+	expectAccount := func(id, ownerID uuid.UUID) {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows(accountColumns).AddRow(id, ownerID, "spot", "active", now, now))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM account_balances WHERE account_id = ANY($1)")).
+			WillReturnRows(sqlmock.NewRows([]string{"account_id", "asset", "balance", "locked", "updated_at"}))
+	}
+
+	expectAccount(own, userID)
+	expectAccount(foreign, uuid.New())
+	notYours := transfer(foreign)
+
+	expectAccount(own, userID)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM accounts WHERE id = $1")).
+		WithArgs(missing).
+		WillReturnRows(sqlmock.NewRows(accountColumns))
+	notFound := transfer(missing)
+
+	// Both look the same, so account IDs of other users cannot be probed
+	assert.Equal(t, http.StatusNotFound, notYours.Code)
+	assert.Equal(t, notFound.Code, notYours.Code)
+	assert.JSONEq(t, notFound.Body.String(), notYours.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,191 @@
+package unit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/api"
+	"cex/internal/users/model"
+	"cex/internal/users/service"
+	"cex/pkg/apiutil"
+	"cex/pkg/auth"
+	"cex/pkg/errors"
+)
+
+func newTestAPI(t *testing.T) (*echo.Echo, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := newMockDB(t)
+	tokens := newTokenIssuer(t)
+	users, err := service.NewUserService(db, tokens, fastHashing, mfaConfig)
+	require.NoError(t, err)
+	return api.New(slog.New(slog.DiscardHandler), users, tokens, testKeys).Handler(), mock
+}
+
+func serve(e *echo.Echo, method, path, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPI_RegisterAndLogin(t *testing.T) {
+	e, mock := newTestAPI(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	rec := serve(e, http.MethodPost, "/api/v1/auth/register", `{"email":"alice@example.com","password":"correct horse battery"}`, "")
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	assert.NotContains(t, rec.Body.String(), "password")
+
+	id := uuid.New()
+	expectUserByEmail(t, mock, id, "alice@example.com", "correct horse battery")
+	expectSessionInsert(mock, id)
+	rec = serve(e, http.MethodPost, "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse battery"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var pair service.Tokens
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.NotEmpty(t, pair.RefreshToken)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPI_Errors(t *testing.T) {
+	e, mock := newTestAPI(t)
+
+	rec := serve(e, http.MethodPost, "/api/v1/auth/register", `{"email":"alice@example.com"}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "InvalidRequest")
+
+	rec = serve(e, http.MethodPost, "/api/v1/auth/register", `{"email":"alice@example.com","password":"short"}`, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "InvalidRegistration")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "users" WHERE email`)).WillReturnRows(sqlmock.NewRows(userColumns))
+	rec = serve(e, http.MethodPost, "/api/v1/auth/login", `{"email":"bob@example.com","password":"whatever it is"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "InvalidCredentials")
+
+	rec = serve(e, http.MethodGet, "/nope", "", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestErrorHandler_UsesStatusOfServiceErrors(t *testing.T) {
+	handle := apiutil.ErrorHandler(slog.New(slog.DiscardHandler))
+	respond := func(err error) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handle(err, echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec))
+		return rec
+	}
+
+	// The status travels as a StatusCode value inside the error chain
+	rec := respond(errors.Conflict.Reason("EmailTaken").Explain("email is taken"))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "EmailTaken", body["kind"])
+	assert.Equal(t, "email is taken", body["message"])
+
+	// Server errors keep their status but not their details
+	rec = respond(fmt.Errorf("login: %w", errors.Unavailable.Explain("database down")))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	rec = respond(fmt.Errorf("boom"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Body.String())
+}
+
+func TestAPI_MeRequiresAccessToken(t *testing.T) {
+	e, mock := newTestAPI(t)
+	id := uuid.New()
+	token, _, err := newTokenIssuer(t).IssueAccess(userWithID(id), model.Session{ID: uuid.New()})
+	require.NoError(t, err)
+
+	rec := serve(e, http.MethodGet, "/api/v1/users/me", "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = serve(e, http.MethodGet, "/api/v1/users/me", "", "not-a-jwt")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	expectNotRevoked(mock)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs(id, 1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(id, "alice@example.com", "x", "{}", now, now))
+	rec = serve(e, http.MethodGet, "/api/v1/users/me", "", token)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Contains(t, rec.Body.String(), id.String())
+
+	// Logged out since
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "revoked_tokens" WHERE jti = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	rec = serve(e, http.MethodGet, "/api/v1/users/me", "", token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPI_LogoutRevokesSession(t *testing.T) {
+	e, mock := newTestAPI(t)
+	id, sid := uuid.New(), uuid.New()
+	token, claims, err := newTokenIssuer(t).IssueAccess(userWithID(id), model.Session{ID: sid})
+	require.NoError(t, err)
+
+	expectNotRevoked(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL FOR UPDATE`)).
+		WithArgs(sid, id).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow(sid, id, "hash", claims.ID, claims.ExpiresAt.Time, time.Now().Add(time.Hour), nil, nil, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "revoked_tokens"`)).
+		WithArgs(claims.ID, id, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "revoked_at"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	rec := serve(e, http.MethodPost, "/api/v1/auth/logout", "", token)
+	assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPI_Revocations(t *testing.T) {
+	e, mock := newTestAPI(t)
+	revokedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "revoked_tokens" WHERE revoked_at > $1 AND expires_at > $2 ORDER BY revoked_at`)).
+		WithArgs(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"jti", "user_id", "expires_at", "revoked_at"}).
+			AddRow("jti-1", uuid.New(), expiresAt, revokedAt))
+
+	rec := serve(e, http.MethodGet, "/api/v1/auth/revocations?since=2024-06-01T00:00:00Z", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var list auth.RevocationList
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	require.Len(t, list.Revocations, 1)
+	assert.Equal(t, "jti-1", list.Revocations[0].JTI)
+	assert.True(t, list.Revocations[0].ExpiresAt.Equal(expiresAt))
+	assert.NotContains(t, rec.Body.String(), "user_id")
+
+	rec = serve(e, http.MethodGet, "/api/v1/auth/revocations?since=yesterday", "", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,92 @@
+package unit
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"cex/internal/users/model"
+	"cex/internal/users/service"
+	"cex/pkg/auth"
+)
+
+// testKeys sign the tokens of the tests.
+var testKeys = newKeySet(auth.AlgEdDSA)
+
+func newKeySet(alg string) *service.KeySet {
+	key, err := service.GenerateSigningKey(alg)
+	if err != nil {
+		panic(err)
+	}
+	return service.NewKeySet(key)
+}
+
+// mfaConfig seals the TOTP secrets of the tests.
+var mfaConfig = service.MFAConfig{Secret: []byte("mfa-secret")}
+
+// fastHashing keeps argon2id cheap in tests.
+var fastHashing = service.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+// newMockDB returns a gorm DB on top of sqlmock, configured like the
+// service's own (unique violations translated).
+func newMockDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{
+		Logger:         logger.Discard,
+		TranslateError: true,
+	})
+	require.NoError(t, err)
+	return db, mock
+}
+
+func newTokenIssuer(t *testing.T) *service.TokenIssuer {
+	t.Helper()
+	tokens, err := service.NewTokenIssuer(service.TokenConfig{}, testKeys)
+	require.NoError(t, err)
+	return tokens
+}
+
+func newUserService(t *testing.T) (*service.UserService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := newMockDB(t)
+	users, err := service.NewUserService(db, newTokenIssuer(t), fastHashing, mfaConfig)
+	require.NoError(t, err)
+	return users, mock
+}
+
+// userColumns are the columns of the users table.
+var userColumns = []string{"id", "email", "password_hash", "roles", "created_at", "updated_at"}
+
+func userWithID(id uuid.UUID) model.User {
+	return model.User{ID: id, Email: "alice@example.com"}
+}
+
+// sessionColumns are the columns of the sessions table.
+var sessionColumns = []string{
+	"id", "user_id", "refresh_hash", "access_jti", "access_expires_at", "expires_at", "mfa_at", "revoked_at", "created_at", "updated_at",
+}
+
+// expectSessionInsert expects a login to open a session of userID.
+func expectSessionInsert(mock sqlmock.Sqlmock, userID uuid.UUID) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "sessions"`)).
+		WithArgs(sqlmock.AnyArg(), userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// expectNotRevoked expects the revocation check of an access token.
+func expectNotRevoked(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "revoked_tokens" WHERE jti = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
@@ -0,0 +1,188 @@
+package unit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/service"
+	"cex/pkg/auth"
+)
+
+var keyConfig = service.KeyConfig{Secret: []byte("key-secret"), Retain: 15 * time.Minute}
+
+// capture matches any argument and records it.
+type capture struct{ value driver.Value }
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+// storedKey is a row of the signing_keys table.
+type storedKey struct {
+	kid, alg   string
+	privateKey []byte
+	createdAt  time.Time
+}
+
+var signingKeyColumns = []string{"kid", "algorithm", "private_key", "created_at"}
+
+func signingKeyRows(keys ...storedKey) *sqlmock.Rows {
+	rows := sqlmock.NewRows(signingKeyColumns)
+	for _, k := range keys {
+		rows.AddRow(k.kid, k.alg, k.privateKey, k.createdAt)
+	}
+	return rows
+}
+
+func expectKeysLocked(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "signing_keys" ORDER BY created_at FOR UPDATE`)).
+		WillReturnRows(rows)
+}
+
+// expectKeyInsert expects a new key to be stored and records it.
+func expectKeyInsert(mock sqlmock.Sqlmock) func() storedKey {
+	kid, alg, privateKey := &capture{}, &capture{}, &capture{}
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "signing_keys" ("kid","algorithm","private_key","created_at")`)).
+		WithArgs(kid, alg, privateKey, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	return func() storedKey {
+		return storedKey{kid: kid.value.(string), alg: alg.value.(string), privateKey: privateKey.value.([]byte)}
+	}
+}
+
+// newStoredKey generates a key the way the store does, created at createdAt.
+func newStoredKey(t *testing.T, createdAt time.Time) storedKey {
+	t.Helper()
+	db, mock := newMockDB(t)
+	store, err := service.NewKeyStore(db, keyConfig, &service.KeySet{})
+	require.NoError(t, err)
+	expectKeysLocked(mock, signingKeyRows())
+	inserted := expectKeyInsert(mock)
+	mock.ExpectCommit()
+	require.NoError(t, store.Sync(context.Background()))
+	key := inserted()
+	key.createdAt = createdAt
+	return key
+}
+
+func newKeyStore(t *testing.T) (*service.KeyStore, *service.KeySet, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock := newMockDB(t)
+	keys := &service.KeySet{}
+	store, err := service.NewKeyStore(db, keyConfig, keys)
+	require.NoError(t, err)
+	return store, keys, mock
+}
+
+func TestKeyStore_GeneratesFirstKey(t *testing.T) {
+	store, keys, mock := newKeyStore(t)
+	expectKeysLocked(mock, signingKeyRows())
+	inserted := expectKeyInsert(mock)
+	mock.ExpectCommit()
+
+	require.NoError(t, store.Sync(context.Background()))
+	stored := inserted()
+	assert.Equal(t, auth.AlgEdDSA, stored.alg)
+	signer, err := keys.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, stored.kid, signer.ID)
+
+	// Reloaded as is, although not published for PublishDelay yet
+	stored.createdAt = time.Now()
+	expectKeysLocked(mock, signingKeyRows(stored))
+	mock.ExpectCommit()
+	require.NoError(t, store.Sync(context.Background()))
+	reloaded, err := keys.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, signer.Private, reloaded.Private)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyStore_PublishesNewKeyBeforeSigning(t *testing.T) {
+	store, keys, mock := newKeyStore(t)
+	old := newStoredKey(t, time.Now().Add(-31*24*time.Hour))
+	expectKeysLocked(mock, signingKeyRows(old))
+	inserted := expectKeyInsert(mock)
+	mock.ExpectCommit()
+
+	require.NoError(t, store.Sync(context.Background()))
+	signer, err := keys.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, old.kid, signer.ID)
+	set, err := keys.JWKS()
+	require.NoError(t, err)
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, old.kid, set.Keys[0].KeyID)
+	assert.Equal(t, inserted().kid, set.Keys[1].KeyID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyStore_DropsExpiredKeys(t *testing.T) {
+	store, keys, mock := newKeyStore(t)
+	old := newStoredKey(t, time.Now().Add(-40*24*time.Hour))
+	previous := newStoredKey(t, time.Now().Add(-10*24*time.Hour))
+	// Replaced 5 minutes ago, its tokens have not expired yet
+	current := newStoredKey(t, time.Now().Add(-10*time.Minute))
+	expectKeysLocked(mock, signingKeyRows(old, previous, current))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "signing_keys" WHERE kid IN ($1)`)).
+		WithArgs(old.kid).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	require.NoError(t, store.Sync(context.Background()))
+	signer, err := keys.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, current.kid, signer.ID)
+	_, ok := keys.Key(previous.kid)
+	assert.True(t, ok)
+	_, ok = keys.Key(old.kid)
+	assert.False(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestKeyStore_RejectsWrongSecret(t *testing.T) {
+	db, mock := newMockDB(t)
+	store, err := service.NewKeyStore(db, service.KeyConfig{Secret: []byte("another-secret")}, &service.KeySet{})
+	require.NoError(t, err)
+	expectKeysLocked(mock, signingKeyRows(newStoredKey(t, time.Now())))
+	mock.ExpectCommit()
+
+	assert.Error(t, store.Sync(context.Background()))
+}
+
+func TestNewKeyStore_Validation(t *testing.T) {
+	db, _ := newMockDB(t)
+	_, err := service.NewKeyStore(db, service.KeyConfig{}, &service.KeySet{})
+	assert.Error(t, err)
+	_, err = service.NewKeyStore(db, service.KeyConfig{Secret: []byte("s"), Algorithm: "HS256"}, &service.KeySet{})
+	assert.Error(t, err)
+}
+
+func TestAPI_JWKS(t *testing.T) {
+	e, _ := newTestAPI(t)
+
+	rec := serve(e, http.MethodGet, "/.well-known/jwks.json", "", "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var set auth.JWKS
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &set))
+	require.Len(t, set.Keys, 1)
+	signer, err := testKeys.Signer()
+	require.NoError(t, err)
+	assert.Equal(t, signer.ID, set.Keys[0].KeyID)
+	assert.Equal(t, "OKP", set.Keys[0].KeyType)
+	pub, err := set.Keys[0].PublicKey()
+	require.NoError(t, err)
+	assert.Equal(t, signer.Private.Public(), pub)
+	assert.NotContains(t, rec.Body.String(), `"d"`)
+}
@@ -0,0 +1,284 @@
+package unit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/service"
+	"cex/pkg/auth"
+)
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	// The last six digits of the SHA-1 vectors of RFC 6238 appendix B
+	for unix, code := range map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	} {
+		assert.Equal(t, code, service.TOTPCode(secret, time.Unix(unix, 0)), unix)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(service.TOTPURI("CEX", "alice@example.com", []byte("12345678901234567890")))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/CEX:alice@example.com", uri.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri.Query().Get("secret"))
+	assert.Equal(t, "CEX", uri.Query().Get("issuer"))
+}
+
+// totpUserColumns are the columns of the users table read by two-factor
+// verification.
+var totpUserColumns = []string{
+	"id", "email", "password_hash", "roles", "totp_secret", "totp_enabled_at", "totp_last_step", "mfa_failures", "mfa_failed_at", "created_at", "updated_at",
+}
+
+// totpUser is a user with two-factor authentication enabled.
+type totpUser struct {
+	id       uuid.UUID
+	secret   []byte
+	sealed   []byte
+	lastStep int64
+	failures int
+	failedAt *time.Time
+}
+
+func (u totpUser) row() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(totpUserColumns).
+		AddRow(u.id, "alice@example.com", "x", "{}", u.sealed, now, u.lastStep, u.failures, u.failedAt, now, now)
+}
+
+// hashOf is the stored hash of a recovery code.
+func hashOf(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func expectUserLock(mock sqlmock.Sqlmock, u totpUser) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(u.id, 1).
+		WillReturnRows(u.row())
+}
+
+// enrollTOTP starts the TOTP enrollment of a user and returns it with its
+// secret as stored.
+func enrollTOTP(t *testing.T, svc *service.UserService, mock sqlmock.Sqlmock) totpUser {
+	t.Helper()
+	u := totpUser{id: uuid.New()}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs(u.id, 1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(u.id, "alice@example.com", "x", "{}", now, now))
+	sealed := &capture{}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "totp_secret"=$1,"updated_at"=$2 WHERE id = $3 AND totp_enabled_at IS NULL`)).
+		WithArgs(sealed, sqlmock.AnyArg(), u.id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	enrollment, err := svc.EnrollTOTP(context.Background(), u.id)
+	require.NoError(t, err)
+	u.secret, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	u.sealed = sealed.value.([]byte)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/CEX:alice@example.com?")
+	return u
+}
+
+func TestConfirmTOTP_EnablesAndReturnsRecoveryCodes(t *testing.T) {
+	svc, mock := newUserService(t)
+	u := enrollTOTP(t, svc, mock)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(u.id, 1).
+		WillReturnRows(sqlmock.NewRows(totpUserColumns).
+			AddRow(u.id, "alice@example.com", "x", "{}", u.sealed, nil, 0, 0, nil, time.Now(), time.Now()))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "mfa_failures"=$1,"totp_enabled_at"=$2,"totp_last_step"=$3`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "recovery_codes" WHERE user_id = $1`)).
+		WithArgs(u.id).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "recovery_codes"`)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+
+	codes, err := svc.ConfirmTOTP(context.Background(), u.id, service.TOTPCode(u.secret, time.Now()))
+	require.NoError(t, err)
+	assert.Len(t, codes.Codes, 10)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, codes.Codes[0])
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_TOTPUserGetsChallenge(t *testing.T) {
+	svc, mock := newUserService(t)
+	hash, err := service.HashPassword("correct horse battery", fastHashing)
+	require.NoError(t, err)
+	id, now := uuid.New(), time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows(totpUserColumns).
+			AddRow(id, "alice@example.com", hash, "{}", []byte("sealed"), now, 0, 0, nil, now, now))
+
+	// No session is opened before the second factor
+	result, err := svc.Login(context.Background(), "alice@example.com", "correct horse battery")
+	require.NoError(t, err)
+	assert.Nil(t, result.Tokens)
+	require.NotNil(t, result.MFA)
+	assert.Equal(t, 300, result.MFA.ExpiresIn)
+
+	// The challenge is no access token
+	_, err = newTokenIssuer(t).ParseAccess(result.MFA.MFAToken)
+	assert.Error(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCompleteLogin_OpensElevatedSession(t *testing.T) {
+	svc, mock := newUserService(t)
+	u := enrollTOTP(t, svc, mock)
+	challenge, err := newTokenIssuer(t).IssueMFA(userWithID(u.id))
+	require.NoError(t, err)
+
+	expectUserLock(mock, u)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "totp_last_step"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "sessions"`)).
+		WithArgs(sqlmock.AnyArg(), u.id, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pair, err := svc.CompleteLogin(context.Background(), challenge, service.TOTPCode(u.secret, time.Now()))
+	require.NoError(t, err)
+	claims, err := newTokenIssuer(t).ParseAccess(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.AMRPassword, auth.AMROTP}, claims.AMR)
+	assert.WithinDuration(t, time.Now(), claims.AuthTime.Time, 5*time.Second)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	// Access tokens are no challenges either
+	_, err = svc.CompleteLogin(context.Background(), pair.AccessToken, "123456")
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+}
+
+func TestCompleteLogin_RejectsReplayedCode(t *testing.T) {
+	svc, mock := newUserService(t)
+	u := enrollTOTP(t, svc, mock)
+	challenge, err := newTokenIssuer(t).IssueMFA(userWithID(u.id))
+	require.NoError(t, err)
+
+	// The current code was accepted already
+	now := time.Now()
+	u.lastStep = now.Unix() / 30
+	expectUserLock(mock, u)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "mfa_failed_at"=$1,"mfa_failures"=$2`)).
+		WithArgs(sqlmock.AnyArg(), 1, sqlmock.AnyArg(), u.id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Committed so the failure counts
+	mock.ExpectCommit()
+
+	_, err = svc.CompleteLogin(context.Background(), challenge, service.TOTPCode(u.secret, now))
+	assert.ErrorIs(t, err, service.ErrInvalidMFACode)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSecondFactor_LockedAfterFailures(t *testing.T) {
+	svc, mock := newUserService(t)
+	u := enrollTOTP(t, svc, mock)
+
+	failedAt := time.Now().Add(-time.Minute)
+	u.failures, u.failedAt = 5, &failedAt
+	expectUserLock(mock, u)
+	mock.ExpectRollback()
+
+	// Even the right code
+	_, err := svc.RegenerateRecoveryCodes(context.Background(), u.id, service.TOTPCode(u.secret, time.Now()))
+	assert.ErrorIs(t, err, service.ErrMFALocked)
+
+	// The lockout ends
+	failedAt = time.Now().Add(-time.Hour)
+	expectUserLock(mock, u)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "totp_last_step"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "mfa_failures"=$1`)).
+		WithArgs(0, sqlmock.AnyArg(), u.id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "recovery_codes"`)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "recovery_codes"`)).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+	codes, err := svc.RegenerateRecoveryCodes(context.Background(), u.id, service.TOTPCode(u.secret, time.Now()))
+	require.NoError(t, err)
+	assert.Len(t, codes.Codes, 10)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStepUp_WithRecoveryCode(t *testing.T) {
+	svc, mock := newUserService(t)
+	u := enrollTOTP(t, svc, mock)
+	sid := uuid.New()
+
+	expectUserLock(mock, u)
+	// Recovery codes are compared by hash, whatever the case and dashes
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "recovery_codes" SET "used_at"=$1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`)).
+		WithArgs(sqlmock.AnyArg(), u.id, hashOf("abcdefghij")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL LIMIT $3 FOR UPDATE`)).
+		WithArgs(sid, u.id, 1).
+		WillReturnRows(sessionRow(sid, u.id, "secret", "old-jti"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "mfa_at"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "revoked_tokens"`)).
+		WithArgs("old-jti", u.id, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRotatedInsert(mock, sid, "secret")
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "access_expires_at"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pair, err := svc.StepUp(context.Background(), u.id, sid, " ABCDE-FGHIJ ")
+	require.NoError(t, err)
+	claims, err := newTokenIssuer(t).ParseAccess(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Contains(t, claims.AMR, auth.AMROTP)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPI_LoginChallenge(t *testing.T) {
+	e, mock := newTestAPI(t)
+	hash, err := service.HashPassword("correct horse battery", fastHashing)
+	require.NoError(t, err)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows(totpUserColumns).
+			AddRow(uuid.New(), "alice@example.com", hash, "{}", []byte("sealed"), now, 0, 0, nil, now, now))
+
+	rec := serve(e, http.MethodPost, "/api/v1/auth/login", `{"email":"alice@example.com","password":"correct horse battery"}`, "")
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.NotContains(t, body, "access_token")
+	assert.Contains(t, body["mfa"], "mfa_token")
+
+	rec = serve(e, http.MethodPost, "/api/v1/auth/login/mfa", `{"mfa_token":"nope","code":"123456"}`, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
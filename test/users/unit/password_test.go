@@ -0,0 +1,46 @@
+package unit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/service"
+)
+
+func TestHashPassword_RoundTrip(t *testing.T) {
+	hash, err := service.HashPassword("correct horse battery", fastHashing)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$"), hash)
+
+	ok, err := service.VerifyPassword("correct horse battery", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = service.VerifyPassword("correct horse battery staple", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestHashPassword_SaltsEveryHash(t *testing.T) {
+	a, err := service.HashPassword("same password", fastHashing)
+	require.NoError(t, err)
+	b, err := service.HashPassword("same password", fastHashing)
+	require.NoError(t, err)
+	assert.NotEqual(t, a, b)
+}
+
+func TestVerifyPassword_RejectsMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$2a$10$bcryptbcryptbcryptbcryptbcryptbcryptbcryptbcryptbcrypt",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$!!!$aGFzaA",
+	} {
+		_, err := service.VerifyPassword("password", hash)
+		assert.Error(t, err, hash)
+	}
+}
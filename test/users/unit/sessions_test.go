@@ -0,0 +1,159 @@
+package unit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/service"
+)
+
+// sessionRow is a live session whose current refresh token secret is secret.
+func sessionRow(sid, userID uuid.UUID, secret, accessJTI string) *sqlmock.Rows {
+	sum := sha256.Sum256([]byte(secret))
+	now := time.Now()
+	return sqlmock.NewRows(sessionColumns).
+		AddRow(sid, userID, hex.EncodeToString(sum[:]), accessJTI, now.Add(5*time.Minute), now.Add(time.Hour), nil, nil, now, now)
+}
+
+// expectRotated expects the lookup of secret among the rotated refresh
+// secrets of session sid, found n times.
+func expectRotated(mock sqlmock.Sqlmock, sid uuid.UUID, secret string, n int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "rotated_refresh_tokens" WHERE hash = $1 AND session_id = $2`)).
+		WithArgs(hashOf(secret), sid).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(n))
+}
+
+func expectRotatedInsert(mock sqlmock.Sqlmock, sid uuid.UUID, secret string) {
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "rotated_refresh_tokens" ("hash","session_id","expires_at")`)).
+		WithArgs(hashOf(secret), sid, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectSessionLock(mock sqlmock.Sqlmock, sid uuid.UUID, rows *sqlmock.Rows) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE id = $1 LIMIT $2 FOR UPDATE`)).
+		WithArgs(sid, 1).
+		WillReturnRows(rows)
+}
+
+func TestRefresh_RotatesToken(t *testing.T) {
+	svc, mock := newUserService(t)
+	sid, userID := uuid.New(), uuid.New()
+
+	expectSessionLock(mock, sid, sessionRow(sid, userID, "current-secret", "old-jti"))
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE id = $1`)).
+		WithArgs(userID, 1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(userID, "alice@example.com", "x", "{}", now, now))
+	// The previous access token stops working
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "revoked_tokens"`)).
+		WithArgs("old-jti", userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The previous refresh token is remembered to detect its reuse
+	expectRotatedInsert(mock, sid, "current-secret")
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "access_expires_at"=$1,"access_jti"=$2,"expires_at"=$3,"refresh_hash"=$4`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	pair, err := svc.Refresh(context.Background(), sid.String()+".current-secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(pair.RefreshToken, sid.String()+"."))
+	assert.NotEqual(t, sid.String()+".current-secret", pair.RefreshToken)
+	claims, err := newTokenIssuer(t).ParseAccess(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, sid.String(), claims.SessionID)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_ReuseRevokesSession(t *testing.T) {
+	svc, mock := newUserService(t)
+	sid, userID := uuid.New(), uuid.New()
+
+	expectSessionLock(mock, sid, sessionRow(sid, userID, "current-secret", "live-jti"))
+	expectRotated(mock, sid, "rotated-secret", 1)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "revoked_tokens"`)).
+		WithArgs("live-jti", userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "revoked_at"=$1`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Committed although the refresh fails
+	mock.ExpectCommit()
+
+	_, err := svc.Refresh(context.Background(), sid.String()+".rotated-secret")
+	assert.ErrorIs(t, err, service.ErrRefreshTokenReused)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_UnknownSecretHasNoSideEffects(t *testing.T) {
+	svc, mock := newUserService(t)
+	sid, userID := uuid.New(), uuid.New()
+
+	// Anyone who saw an access token knows its sid
+	expectSessionLock(mock, sid, sessionRow(sid, userID, "current-secret", "live-jti"))
+	expectRotated(mock, sid, "guessed", 0)
+	mock.ExpectRollback()
+
+	_, err := svc.Refresh(context.Background(), sid.String()+".guessed")
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefresh_RevokedOrUnknownSession(t *testing.T) {
+	svc, mock := newUserService(t)
+	sid, userID := uuid.New(), uuid.New()
+
+	now := time.Now()
+	expectSessionLock(mock, sid, sqlmock.NewRows(sessionColumns).
+		AddRow(sid, userID, "hash", "jti", now, now.Add(time.Hour), nil, now, now, now))
+	mock.ExpectRollback()
+	_, err := svc.Refresh(context.Background(), sid.String()+".secret")
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	expectSessionLock(mock, sid, sqlmock.NewRows(sessionColumns))
+	mock.ExpectRollback()
+	_, err = svc.Refresh(context.Background(), sid.String()+".secret")
+	assert.ErrorIs(t, err, service.ErrInvalidToken)
+
+	for _, token := range []string{"", "no-dot", "not-a-uuid.secret", sid.String() + "."} {
+		_, err = svc.Refresh(context.Background(), token)
+		assert.ErrorIs(t, err, service.ErrInvalidToken, token)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogoutAll_RevokesEverySession(t *testing.T) {
+	svc, mock := newUserService(t)
+	userID := uuid.New()
+	a, b := uuid.New(), uuid.New()
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "sessions" WHERE user_id = $1 AND revoked_at IS NULL FOR UPDATE`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow(a, userID, "h", "jti-a", now.Add(time.Minute), now.Add(time.Hour), nil, nil, now, now).
+			// Its access token expired already: nothing to deny
+			AddRow(b, userID, "h", "jti-b", now.Add(-time.Minute), now.Add(time.Hour), nil, nil, now, now))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "revoked_tokens"`)).
+		WithArgs("jti-a", userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "sessions" SET "revoked_at"=$1,"updated_at"=$2 WHERE id IN ($3,$4)`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), a, b).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	n, err := svc.LogoutAll(context.Background(), userID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,123 @@
+package unit
+
+import (
+	"crypto/x509"
+	"testing"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/model"
+	"cex/internal/users/service"
+	"cex/pkg/auth"
+)
+
+func TestTokenIssuer_AccessTokenVerifiesWithJWKS(t *testing.T) {
+	for _, alg := range auth.Algorithms {
+		t.Run(alg, func(t *testing.T) {
+			keys := newKeySet(alg)
+			tokens, err := service.NewTokenIssuer(service.TokenConfig{}, keys)
+			require.NoError(t, err)
+			user := model.User{ID: uuid.New(), Email: "a@example.com", Roles: pq.StringArray{"admin"}}
+			sid := uuid.New()
+
+			token, issued, err := tokens.IssueAccess(user, model.Session{ID: sid})
+			require.NoError(t, err)
+
+			// The way the accounts service reads it, with the published key
+			set, err := keys.JWKS()
+			require.NoError(t, err)
+			require.Len(t, set.Keys, 1)
+			parsed, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
+				assert.Equal(t, set.Keys[0].KeyID, token.Header["kid"])
+				assert.Equal(t, set.Keys[0].Algorithm, token.Method.Alg())
+				return set.Keys[0].PublicKey()
+			})
+			require.NoError(t, err)
+			claims := parsed.Claims.(jwt.MapClaims)
+			assert.Equal(t, user.ID.String(), claims["sub"])
+			assert.Equal(t, []any{"admin"}, claims["roles"])
+			assert.Equal(t, issued.ID, claims["jti"])
+			assert.Equal(t, sid.String(), claims["sid"])
+
+			access, err := tokens.ParseAccess(token)
+			require.NoError(t, err)
+			assert.Equal(t, service.TokenUseAccess, access.TokenUse)
+			assert.Equal(t, "a@example.com", access.Email)
+		})
+	}
+}
+
+func TestTokenIssuer_VerifiesRetiredKeys(t *testing.T) {
+	old, err := service.GenerateSigningKey(auth.AlgRS256)
+	require.NoError(t, err)
+	current, err := service.GenerateSigningKey(auth.AlgEdDSA)
+	require.NoError(t, err)
+
+	before, err := service.NewTokenIssuer(service.TokenConfig{}, service.NewKeySet(old))
+	require.NoError(t, err)
+	token, _, err := before.IssueAccess(model.User{ID: uuid.New()}, model.Session{ID: uuid.New()})
+	require.NoError(t, err)
+
+	after, err := service.NewTokenIssuer(service.TokenConfig{}, service.NewKeySet(current, old))
+	require.NoError(t, err)
+	_, err = after.ParseAccess(token)
+	assert.NoError(t, err)
+
+	dropped, err := service.NewTokenIssuer(service.TokenConfig{}, service.NewKeySet(current))
+	require.NoError(t, err)
+	_, err = dropped.ParseAccess(token)
+	assert.Error(t, err)
+}
+
+func TestTokenIssuer_RejectsForeignTokens(t *testing.T) {
+	tokens := newTokenIssuer(t)
+	other, err := service.NewTokenIssuer(service.TokenConfig{}, newKeySet(auth.AlgEdDSA))
+	require.NoError(t, err)
+	token, _, err := other.IssueAccess(model.User{ID: uuid.New()}, model.Session{ID: uuid.New()})
+	require.NoError(t, err)
+
+	_, err = tokens.ParseAccess(token)
+	assert.Error(t, err)
+
+	signer, err := testKeys.Signer()
+	require.NoError(t, err)
+	claims := jwt.MapClaims{"sub": uuid.NewString(), "token_use": "access", "iss": "users"}
+
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, claims)
+	none.Header["kid"] = signer.ID
+	unsigned, err := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = tokens.ParseAccess(unsigned)
+	assert.Error(t, err)
+
+	// HMAC keyed with the public key, which anyone can fetch
+	pub, err := x509.MarshalPKIXPublicKey(signer.Private.Public())
+	require.NoError(t, err)
+	hmac := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	hmac.Header["kid"] = signer.ID
+	forged, err := hmac.SignedString(pub)
+	require.NoError(t, err)
+	_, err = tokens.ParseAccess(forged)
+	assert.Error(t, err)
+
+	wrongUse := jwt.NewWithClaims(jwt.SigningMethodEdDSA, jwt.MapClaims{"sub": uuid.NewString(), "token_use": "refresh", "iss": "users"})
+	wrongUse.Header["kid"] = signer.ID
+	signed, err := wrongUse.SignedString(signer.Private)
+	require.NoError(t, err)
+	_, err = tokens.ParseAccess(signed)
+	assert.Error(t, err)
+}
+
+func TestNewTokenIssuer_RequiresKeys(t *testing.T) {
+	_, err := service.NewTokenIssuer(service.TokenConfig{}, nil)
+	assert.Error(t, err)
+
+	tokens, err := service.NewTokenIssuer(service.TokenConfig{}, &service.KeySet{})
+	require.NoError(t, err)
+	_, _, err = tokens.IssueAccess(model.User{ID: uuid.New()}, model.Session{ID: uuid.New()})
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package unit
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"cex/internal/users/service"
+)
+
+func TestRegister_CreatesUser(t *testing.T) {
+	svc, mock := newUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(sqlmock.AnyArg(), "alice@example.com", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), nil, 0, 0, nil, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	user, err := svc.Register(context.Background(), "  Alice@Example.com ", "correct horse battery")
+	require.NoError(t, err)
+	assert.NotEqual(t, uuid.Nil, user.ID)
+	assert.Equal(t, "alice@example.com", user.Email)
+	ok, err := service.VerifyPassword("correct horse battery", user.PasswordHash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegister_DuplicateEmail(t *testing.T) {
+	svc, mock := newUserService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WillReturnError(&pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"})
+	mock.ExpectRollback()
+
+	_, err := svc.Register(context.Background(), "alice@example.com", "correct horse battery")
+	assert.ErrorIs(t, err, service.ErrEmailTaken)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegister_Validation(t *testing.T) {
+	svc, mock := newUserService(t)
+
+	for _, tc := range []struct{ email, password string }{
+		{"not-an-email", "correct horse battery"},
+		{"Alice <alice@example.com>", "correct horse battery"},
+		{"alice@example.com", "short"},
+	} {
+		_, err := svc.Register(context.Background(), tc.email, tc.password)
+		assert.ErrorIs(t, err, service.ErrInvalidRegistration, tc)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectUserByEmail expects the login lookup of email.
+func expectUserByEmail(t *testing.T, mock sqlmock.Sqlmock, id uuid.UUID, email, password string) {
+	t.Helper()
+	hash, err := service.HashPassword(password, fastHashing)
+	require.NoError(t, err)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1 LIMIT $2`)).
+		WithArgs(email, 1).
+		WillReturnRows(sqlmock.NewRows(userColumns).AddRow(id, email, hash, "{admin}", now, now))
+}
+
+func TestLogin_IssuesTokens(t *testing.T) {
+	svc, mock := newUserService(t)
+	id := uuid.New()
+	expectUserByEmail(t, mock, id, "alice@example.com", "correct horse battery")
+	expectSessionInsert(mock, id)
+
+	pair, err := svc.Login(context.Background(), "ALICE@example.com", "correct horse battery")
+	require.NoError(t, err)
+	claims, err := newTokenIssuer(t).ParseAccess(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, id.String(), claims.Subject)
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.True(t, strings.HasPrefix(pair.RefreshToken, claims.SessionID+"."), pair.RefreshToken)
+	assert.Equal(t, 900, pair.ExpiresIn)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_WrongPassword(t *testing.T) {
+	svc, mock := newUserService(t)
+	expectUserByEmail(t, mock, uuid.New(), "alice@example.com", "correct horse battery")
+
+	_, err := svc.Login(context.Background(), "alice@example.com", "wrong password!")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogin_UnknownEmail(t *testing.T) {
+	svc, mock := newUserService(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WillReturnRows(sqlmock.NewRows(userColumns))
+
+	_, err := svc.Login(context.Background(), "nobody@example.com", "correct horse battery")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	require.NoError(t, mock.ExpectationsWereMet())
+}